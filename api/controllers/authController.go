@@ -2,12 +2,14 @@ package controllers
 
 import (
 	"errors"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/ariefsn/book-store/api/helper"
 	"github.com/ariefsn/book-store/api/models"
-	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/imroc/req"
 )
@@ -16,7 +18,8 @@ type AuthController struct {
 	BaseController
 }
 
-var authUrl = "http://" + os.Getenv("URL_AUTH")
+// Auth service, its timeout, retries and circuit breaker are shared with the proxy
+var authService = helper.GetUpstream("auth")
 
 func NewAuthController() *AuthController {
 	c := new(AuthController)
@@ -24,25 +27,15 @@ func NewAuthController() *AuthController {
 	return c
 }
 
-func (c *AuthController) BaseUrl() string {
-	return authUrl
-}
-
-func (c *AuthController) Hi(w http.ResponseWriter, r *http.Request) {
-	req := req.New()
-
-	res, err := req.Get(authUrl + "/")
-
-	if err != nil {
-		render.Render(w, r, helper.ResponseError(res.Response().StatusCode, errors.New(res.Response().Status)))
-		return
-	}
-
-	newRes := helper.ResponseModel{}
+// Check login needs verified email, configurable through EMAIL_VERIFICATION_REQUIRED
+func emailVerificationRequired() bool {
+	required, _ := strconv.ParseBool(os.Getenv("EMAIL_VERIFICATION_REQUIRED"))
 
-	res.ToJSON(&newRes)
+	return required
+}
 
-	render.Render(w, r, helper.Response(&newRes))
+func (c *AuthController) BaseUrl() string {
+	return authService.URL.String()
 }
 
 // Handler for login user and get token
@@ -54,122 +47,75 @@ func (c *AuthController) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	header := req.Header{
-		"Accept": "application/json",
-		"Claims": c.BuildClaims(map[string]interface{}{
-			"id":    payload.ID,
-			"email": payload.Email,
-		}),
-	}
+	// auth service records attempts and locks out by client address
+	header := c.clientHeader(r)
 
-	req := req.New()
+	client := authService.Request()
 
-	res, err := req.Get(authUrl+"/user/me", header)
+	res, err := client.Post(authService.Url("/login"), header, req.BodyJSON(map[string]interface{}{
+		"email":    payload.Email,
+		"password": payload.Password,
+	}), r.Context())
 
-	if err != nil || res.Response().StatusCode != 200 {
-		render.Render(w, r, helper.ResponseError(res.Response().StatusCode, errors.New(res.Response().Status)))
+	if err != nil {
+		err = authService.Failure(err)
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
 	newRes := helper.ResponseModel{}
 
-	res.ToJSON(&newRes)
-
-	if !newRes.Success {
-		render.Render(w, r, helper.ResponseError(newRes.HTTPStatusCode, errors.New(newRes.Message)))
+	if err := authService.Decode(res, &newRes); err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
-	user := newRes.Data.(map[string]interface{})
-
-	passwordMatch := helper.CheckPasswordHash(payload.Password, user["password"].(string))
-
-	if !passwordMatch {
-		render.Render(w, r, helper.ResponseError(http.StatusUnauthorized, errors.New("wrong password")))
+	if !newRes.Success {
+		if retryAfter := res.Response().Header.Get("Retry-After"); retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
 
+		render.Render(w, r, helper.Response(&newRes))
 		return
 	}
 
-	_, token, _ := helper.EncodeJwt(map[string]interface{}{
-		"id":    user["id"],
-		"email": user["email"],
-	})
-
-	render.Render(w, r, helper.ResponseSuccess(token))
-}
-
-// Handler for check profile
-func (c *AuthController) Profile(w http.ResponseWriter, r *http.Request) {
-	_, claims, _ := helper.DecodeJwt(r)
-
-	header := req.Header{
-		"Accept": "application/json",
-		"Claims": c.BuildClaims(claims),
-	}
-
-	req := req.New()
-
-	res, err := req.Get(authUrl+"/user/me", header)
+	user, ok := newRes.Data.(map[string]interface{})
 
-	if err != nil {
-		render.Render(w, r, helper.ResponseError(res.Response().StatusCode, errors.New(res.Response().Status)))
+	if !ok {
+		err := authService.Failure(errors.New("user isn't an object"))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
-	newRes := helper.ResponseModel{}
-
-	res.ToJSON(&newRes)
-
-	if !newRes.Success {
-		render.Render(w, r, helper.ResponseError(newRes.HTTPStatusCode, errors.New(newRes.Message)))
+	if emailVerificationRequired() && user["emailVerifiedAt"] == nil {
+		render.Render(w, r, helper.ResponseError(http.StatusForbidden, errors.New("email not verified")))
 		return
 	}
 
-	render.Render(w, r, helper.Response(&newRes))
+	res, err = client.Post(authService.Url("/token"), header, req.BodyJSON(map[string]interface{}{
+		"userId": user["id"],
+	}), r.Context())
+
+	c.renderToken(w, r, res, err)
 }
 
-// Handler for create new user
-func (c *AuthController) Create(w http.ResponseWriter, r *http.Request) {
-	_, claims, _ := helper.DecodeJwt(r)
-
-	payload := models.UserModel{}
+// Handler for complete login challenge with two-factor code and get token
+func (c *AuthController) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	payload := models.ChallengeModel{}
 
 	if err := render.Bind(r, &payload); err != nil {
 		render.Render(w, r, helper.ResponseError(422, err))
 		return
 	}
 
-	header := req.Header{
-		"Accept": "application/json",
-		"Claims": c.BuildClaims(claims),
-	}
-
-	body := req.BodyJSON(&payload)
-
-	req := req.New()
-
-	res, err := req.Post(authUrl+"/user/", header, body)
-
-	if err != nil {
-		render.Render(w, r, helper.ResponseError(res.Response().StatusCode, errors.New(res.Response().Status)))
-		return
-	}
-
-	newRes := helper.ResponseModel{}
-
-	res.ToJSON(&newRes)
-
-	if !newRes.Success {
-		render.Render(w, r, helper.ResponseError(newRes.HTTPStatusCode, errors.New(newRes.Message)))
-		return
-	}
+	res, err := authService.Request().Post(authService.Url("/token/2fa"), c.clientHeader(r), req.BodyJSON(&payload), r.Context())
 
-	render.Render(w, r, helper.Response(&newRes))
+	c.renderToken(w, r, res, err)
 }
 
-// Handler for register user
-func (c *AuthController) Register(w http.ResponseWriter, r *http.Request) {
-	payload := models.UserModel{}
+// Handler for exchange refresh token with a new token pair
+func (c *AuthController) Refresh(w http.ResponseWriter, r *http.Request) {
+	payload := models.RefreshTokenModel{}
 
 	if err := render.Bind(r, &payload); err != nil {
 		render.Render(w, r, helper.ResponseError(422, err))
@@ -178,206 +124,145 @@ func (c *AuthController) Register(w http.ResponseWriter, r *http.Request) {
 
 	body := req.BodyJSON(&payload)
 
-	req := req.New()
-
-	res, err := req.Post(authUrl+"/register", body)
-
-	if err != nil {
-		render.Render(w, r, helper.ResponseError(res.Response().StatusCode, errors.New(res.Response().Status)))
-		return
-	}
-
-	newRes := helper.ResponseModel{}
-
-	res.ToJSON(&newRes)
+	res, err := authService.Request().Post(authService.Url("/token/refresh"), c.clientHeader(r), body, r.Context())
 
-	if !newRes.Success {
-		render.Render(w, r, helper.ResponseError(newRes.HTTPStatusCode, errors.New(newRes.Message)))
-		return
-	}
-
-	render.Render(w, r, helper.Response(&newRes))
+	c.renderToken(w, r, res, err)
 }
 
-// Handler for update profile for active user
-func (c *AuthController) UpdateMe(w http.ResponseWriter, r *http.Request) {
+// Handler for logout, revoke refresh tokens of the current session
+func (c *AuthController) Logout(w http.ResponseWriter, r *http.Request) {
 	_, claims, _ := helper.DecodeJwt(r)
 
-	payload := models.UserModel{}
+	familyId, _ := claims["fid"].(string)
 
-	if err := render.Bind(r, &payload); err != nil {
-		render.Render(w, r, helper.ResponseError(422, err))
+	// API keys and tokens issued before sessions have no family to revoke
+	if familyId == "" {
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, errors.New("no session to log out")))
 		return
 	}
 
-	header := req.Header{
-		"Accept": "application/json",
-		"Claims": c.BuildClaims(claims),
-	}
-
-	body := req.BodyJSON(&payload)
-
-	req := req.New()
-
-	res, err := req.Put(authUrl+"/user/me", header, body)
+	res, err := authService.Request().Delete(authService.Url("/token/family/"+familyId), c.header(c.Identity(claims)), r.Context())
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(res.Response().StatusCode, errors.New(res.Response().Status)))
+		err = authService.Failure(err)
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
 	newRes := helper.ResponseModel{}
 
-	res.ToJSON(&newRes)
-
-	if !newRes.Success {
-		render.Render(w, r, helper.ResponseError(newRes.HTTPStatusCode, errors.New(newRes.Message)))
+	if err := authService.Decode(res, &newRes); err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
 	render.Render(w, r, helper.Response(&newRes))
 }
 
-// Handler for update user
-func (c *AuthController) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	_, claims, _ := helper.DecodeJwt(r)
-
-	payload := models.UserModel{}
+// Header for request the gateway makes itself to auth service on behalf of identity
+func (c *AuthController) header(identity helper.Identity) req.Header {
+	identity.Internal = true
+	signed, _ := helper.SignIdentity(identity, "auth")
 
-	if err := render.Bind(r, &payload); err != nil {
-		render.Render(w, r, helper.ResponseError(422, err))
-		return
-	}
-
-	header := req.Header{
-		"Accept": "application/json",
-		"Claims": c.BuildClaims(claims),
+	return req.Header{
+		"Accept":              "application/json",
+		helper.IdentityHeader: signed,
 	}
+}
 
-	body := req.BodyJSON(&payload)
+// Header for request to auth service on behalf of the client, whose address and user agent are recorded for logins and sessions
+func (c *AuthController) clientHeader(r *http.Request) req.Header {
+	header := c.header(helper.Identity{})
 
-	req := req.New()
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		header["X-Forwarded-For"] = host
+	}
 
-	id := chi.URLParam(r, "id")
+	header["User-Agent"] = r.UserAgent()
 
-	res, err := req.Put(authUrl+"/user/"+id, header, body)
+	return header
+}
 
+// Sign access token for refresh token issued by auth service
+func (c *AuthController) renderToken(w http.ResponseWriter, r *http.Request, res *req.Resp, err error) {
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(res.Response().StatusCode, errors.New(res.Response().Status)))
+		err = authService.Failure(err)
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
 	newRes := helper.ResponseModel{}
 
-	res.ToJSON(&newRes)
-
-	if !newRes.Success {
-		render.Render(w, r, helper.ResponseError(newRes.HTTPStatusCode, errors.New(newRes.Message)))
+	if err := authService.Decode(res, &newRes); err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
-	render.Render(w, r, helper.Response(&newRes))
-}
-
-// Handler for delete user
-func (c *AuthController) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	_, claims, _ := helper.DecodeJwt(r)
-
-	payload := models.UserModel{}
-
-	if err := render.Bind(r, &payload); err != nil {
-		render.Render(w, r, helper.ResponseError(422, err))
+	if !newRes.Success {
+		render.Render(w, r, helper.Response(&newRes))
 		return
 	}
 
-	header := req.Header{
-		"Accept": "application/json",
-		"Claims": c.BuildClaims(claims),
-	}
-
-	body := req.BodyJSON(&payload)
+	refresh, ok := newRes.Data.(map[string]interface{})
 
-	req := req.New()
-
-	id := chi.URLParam(r, "id")
-
-	res, err := req.Delete(authUrl+"/user/"+id, header, body)
-
-	if err != nil {
-		render.Render(w, r, helper.ResponseError(res.Response().StatusCode, errors.New(res.Response().Status)))
+	if !ok {
+		err := authService.Failure(errors.New("token isn't an object"))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
-	newRes := helper.ResponseModel{}
-
-	res.ToJSON(&newRes)
-
-	if !newRes.Success {
-		render.Render(w, r, helper.ResponseError(newRes.HTTPStatusCode, errors.New(newRes.Message)))
+	// two-factor authentication, token is issued by TwoFactor once the challenge is completed
+	if _, ok := refresh["challenge"]; ok {
+		render.Render(w, r, helper.ResponseSuccess(refresh))
 		return
 	}
 
-	render.Render(w, r, helper.Response(&newRes))
-}
-
-// Handler for get all user
-func (c *AuthController) All(w http.ResponseWriter, r *http.Request) {
-	_, claims, _ := helper.DecodeJwt(r)
-
-	header := req.Header{
-		"Accept": "application/json",
-		"Claims": c.BuildClaims(claims),
-	}
-
-	req := req.New()
-
-	res, err := req.Get(authUrl+"/user", header)
+	_, accessToken, err := helper.EncodeJwt(map[string]interface{}{
+		"id":    refresh["userId"],
+		"email": refresh["email"],
+		"fid":   refresh["familyId"],
+		"roles": refresh["roles"],
+	})
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(res.Response().StatusCode, errors.New(res.Response().Status)))
+		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
 		return
 	}
 
-	newRes := helper.ResponseModel{}
+	refreshToken, ok := refresh["refreshToken"].(string)
 
-	res.ToJSON(&newRes)
-
-	if !newRes.Success {
-		render.Render(w, r, helper.ResponseError(newRes.HTTPStatusCode, errors.New(newRes.Message)))
+	if !ok {
+		err := authService.Failure(errors.New("token has no refresh token"))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
-	render.Render(w, r, helper.Response(&newRes))
-}
-
-// Handler for find user
-func (c *AuthController) Find(w http.ResponseWriter, r *http.Request) {
-	_, claims, _ := helper.DecodeJwt(r)
-
-	header := req.Header{
-		"Accept": "application/json",
-		"Claims": c.BuildClaims(claims),
+	token := models.TokenModel{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(helper.AccessTokenTTL().Seconds()),
+		RefreshToken: refreshToken,
 	}
 
-	req := req.New()
-
-	id := chi.URLParam(r, "id")
+	if codes, ok := refresh["recoveryCodes"].([]interface{}); ok {
+		for _, code := range codes {
+			if code, ok := code.(string); ok {
+				token.RecoveryCodes = append(token.RecoveryCodes, code)
+			}
+		}
+	}
 
-	res, err := req.Get(authUrl+"/user/"+id, header)
+	expiresAt, ok := refresh["expiresAt"].(string)
 
-	if err != nil {
-		render.Render(w, r, helper.ResponseError(res.Response().StatusCode, errors.New(res.Response().Status)))
+	if !ok {
+		err := authService.Failure(errors.New("token has no expiry"))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
-	newRes := helper.ResponseModel{}
-
-	res.ToJSON(&newRes)
-
-	if !newRes.Success {
-		render.Render(w, r, helper.ResponseError(newRes.HTTPStatusCode, errors.New(newRes.Message)))
-		return
+	if expiresAt, err := time.Parse(time.RFC3339, expiresAt); err == nil {
+		token.RefreshExpiresAt = &expiresAt
 	}
 
-	render.Render(w, r, helper.Response(&newRes))
+	render.Render(w, r, helper.ResponseSuccess(token))
 }
@@ -1,11 +1,11 @@
 package controllers
 
 import (
-	"encoding/base64"
-	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/ariefsn/book-store/api/helper"
+	"github.com/go-chi/jwtauth/v5"
 	"github.com/go-chi/render"
 )
 
@@ -15,13 +15,43 @@ func (c *BaseController) Hi(w http.ResponseWriter, r *http.Request) {
 	render.Render(w, r, helper.ResponseSuccess("Hi, Welcome to API Gateway Version 1"))
 }
 
-func (c *BaseController) BuildClaims(claims map[string]interface{}) string {
-	id := claims["id"]
-	email := claims["email"]
+// Identity of the user from access token claims
+func (c *BaseController) Identity(claims map[string]interface{}) helper.Identity {
+	identity := helper.Identity{}
 
-	claimsString := fmt.Sprintf("%v*%s", id, email)
-	data := []byte(claimsString)
-	encoded := base64.StdEncoding.EncodeToString([]byte(data))
+	switch id := claims["id"].(type) {
+	case float64:
+		identity.Subject = strconv.FormatFloat(id, 'f', -1, 64)
+	case int:
+		identity.Subject = strconv.Itoa(id)
+	case string:
+		identity.Subject = id
+	}
 
-	return encoded
+	identity.Email, _ = claims["email"].(string)
+	identity.Session, _ = claims["fid"].(string)
+
+	switch roles := claims["roles"].(type) {
+	case []string:
+		identity.Roles = roles
+	case []interface{}:
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				identity.Roles = append(identity.Roles, s)
+			}
+		}
+	}
+
+	return identity
+}
+
+// Identity of the authenticated request, from its API key or else its access token
+func (c *BaseController) RequestIdentity(r *http.Request) helper.Identity {
+	identity := *helper.IdentityFromContext(r.Context())
+
+	if token, claims, err := jwtauth.FromContext(r.Context()); err == nil && token != nil && identity.Subject == "" {
+		identity = c.Identity(claims)
+	}
+
+	return identity
 }
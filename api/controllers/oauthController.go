@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ariefsn/book-store/api/helper"
+	"github.com/ariefsn/book-store/api/models"
+	"github.com/go-chi/render"
+	"github.com/imroc/req"
+)
+
+// OpenID Connect provider, the auth service keeps clients, consents and codes while the gateway signs tokens
+type OAuthController struct {
+	AuthController
+}
+
+// Parameters of an authorization request
+var authorizeParams = []string{"response_type", "client_id", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method"}
+
+// Errors which are sent back to the redirect URI, others mean the client or its redirect URI can't be trusted
+var redirectableErrors = []string{"invalid_request", "invalid_scope", "access_denied", "unsupported_response_type"}
+
+func NewOAuthController() *OAuthController {
+	c := new(OAuthController)
+
+	return c
+}
+
+// Issuer of ID tokens, configurable through OIDC_ISSUER
+func oidcIssuer() string {
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		return strings.TrimSuffix(issuer, "/")
+	}
+
+	return "http://localhost:3001"
+}
+
+// Page of the frontend which logs the user in and asks for consent, configurable through OIDC_LOGIN_URL
+func oidcLoginUrl() string {
+	return os.Getenv("OIDC_LOGIN_URL")
+}
+
+// Add query parameters to redirect URI of the client
+func redirectTo(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return uri
+	}
+
+	q := u.Query()
+
+	for k, v := range params {
+		q[k] = v
+	}
+
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Post to OAuth endpoint of auth service, a failed response is returned as OAuth error with its status
+func (c *OAuthController) call(path string, identity helper.Identity, body interface{}, data interface{}) (*models.OAuthErrorModel, int, error) {
+	res, err := authService.Request().Post(authService.Url(path), c.header(identity), req.BodyJSON(body))
+
+	if err != nil {
+		return nil, 0, authService.Failure(err)
+	}
+
+	newRes := struct {
+		Success bool            `json:"success"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}{}
+
+	if err := res.ToJSON(&newRes); err != nil {
+		return nil, 0, authService.Failure(err)
+	}
+
+	if !newRes.Success {
+		oauthErr := &models.OAuthErrorModel{}
+
+		json.Unmarshal(newRes.Data, oauthErr)
+
+		if oauthErr.Error == "" {
+			oauthErr.Error = "server_error"
+			oauthErr.ErrorDescription = newRes.Message
+		}
+
+		return oauthErr, res.Response().StatusCode, nil
+	}
+
+	return nil, http.StatusOK, json.Unmarshal(newRes.Data, data)
+}
+
+// Render OAuth error in the response envelope
+func (c *OAuthController) renderError(w http.ResponseWriter, r *http.Request, status int, oauthErr *models.OAuthErrorModel) {
+	res := helper.ResponseError(status, errors.New(oauthErr.Error+": "+oauthErr.ErrorDescription)).(*helper.ResponseModel)
+	res.Data = oauthErr
+
+	render.Render(w, r, res)
+}
+
+// Render OAuth error as is, for endpoints called by clients
+func (c *OAuthController) renderClientError(w http.ResponseWriter, r *http.Request, status int, oauthErr *models.OAuthErrorModel) {
+	w.Header().Set("Cache-Control", "no-store")
+	render.Status(r, status)
+	render.JSON(w, r, oauthErr)
+}
+
+// Handler for OpenID Connect discovery document
+func (c *OAuthController) Discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := oidcIssuer()
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	render.JSON(w, r, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": helper.SigningAlgorithms(),
+		"scopes_supported":                      []string{"openid", "profile", "email", "address"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "given_name", "family_name", "birthdate", "updated_at", "email", "email_verified", "address"},
+	})
+}
+
+// Handler for authorization request of a client, the user is sent to the login page with the same query
+func (c *OAuthController) Authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	payload := map[string]string{}
+
+	for _, param := range authorizeParams {
+		payload[param] = query.Get(param)
+	}
+
+	info := map[string]interface{}{}
+
+	oauthErr, status, err := c.call("/oauth/request", helper.Identity{}, payload, &info)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	if oauthErr != nil {
+		if !contains(redirectableErrors, oauthErr.Error) {
+			c.renderError(w, r, status, oauthErr)
+			return
+		}
+
+		http.Redirect(w, r, redirectTo(payload["redirect_uri"], url.Values{
+			"error":             {oauthErr.Error},
+			"error_description": {oauthErr.ErrorDescription},
+			"state":             {payload["state"]},
+		}), http.StatusFound)
+		return
+	}
+
+	if loginUrl := oidcLoginUrl(); loginUrl != "" {
+		http.Redirect(w, r, redirectTo(loginUrl, query), http.StatusFound)
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(info))
+}
+
+// Handler for details of authorization request shown to the logged in user, including whether it was consented before
+func (c *OAuthController) ConsentInfo(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	payload := map[string]string{}
+
+	for _, param := range authorizeParams {
+		payload[param] = query.Get(param)
+	}
+
+	info := map[string]interface{}{}
+
+	oauthErr, status, err := c.call("/oauth/request", c.RequestIdentity(r), payload, &info)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	if oauthErr != nil {
+		c.renderError(w, r, status, oauthErr)
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(info))
+}
+
+// Handler for approve or deny authorization request, responds with the URI the user agent goes back to the client with
+func (c *OAuthController) Consent(w http.ResponseWriter, r *http.Request) {
+	payload := models.OAuthConsentModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	payload.ResponseType = "code"
+
+	data := struct {
+		Code string `json:"code"`
+	}{}
+
+	oauthErr, status, err := c.call("/oauth/consent", c.RequestIdentity(r), &payload, &data)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	params := url.Values{"code": {data.Code}, "state": {payload.State}}
+
+	if oauthErr != nil {
+		if !contains(redirectableErrors, oauthErr.Error) {
+			c.renderError(w, r, status, oauthErr)
+			return
+		}
+
+		params = url.Values{"error": {oauthErr.Error}, "error_description": {oauthErr.ErrorDescription}, "state": {payload.State}}
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(map[string]string{"redirectTo": redirectTo(payload.RedirectURI, params)}))
+}
+
+// Handler for exchange authorization code for ID token and access token.
+// Clients authenticate with HTTP Basic or form parameters, public clients with the PKCE verifier only.
+func (c *OAuthController) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		c.renderClientError(w, r, http.StatusBadRequest, &models.OAuthErrorModel{Error: "invalid_request", ErrorDescription: err.Error()})
+		return
+	}
+
+	if grantType := r.PostForm.Get("grant_type"); grantType != "authorization_code" {
+		c.renderClientError(w, r, http.StatusBadRequest, &models.OAuthErrorModel{Error: "unsupported_grant_type", ErrorDescription: "only authorization_code is supported"})
+		return
+	}
+
+	clientId, clientSecret, basic := r.BasicAuth()
+
+	if basic {
+		// credentials are form encoded before they're put in the header
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	grant := models.OAuthGrantModel{}
+
+	oauthErr, status, err := c.call("/oauth/code", helper.Identity{}, map[string]string{
+		"code":         r.PostForm.Get("code"),
+		"clientId":     clientId,
+		"clientSecret": clientSecret,
+		"redirectUri":  r.PostForm.Get("redirect_uri"),
+		"codeVerifier": r.PostForm.Get("code_verifier"),
+	}, &grant)
+
+	if err != nil {
+		c.renderClientError(w, r, helper.ErrorStatus(err), &models.OAuthErrorModel{Error: "server_error", ErrorDescription: err.Error()})
+		return
+	}
+
+	if oauthErr != nil {
+		if status == http.StatusUnauthorized && basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+
+		c.renderClientError(w, r, status, oauthErr)
+		return
+	}
+
+	issuer := oidcIssuer()
+	subject := strconv.Itoa(grant.UserID)
+	scope := strings.Join(grant.Scopes, " ")
+
+	idClaims := map[string]interface{}{}
+
+	for k, v := range grant.Claims {
+		idClaims[k] = v
+	}
+
+	idClaims["iss"] = issuer
+	idClaims["sub"] = subject
+	idClaims["aud"] = grant.ClientID
+	idClaims["auth_time"] = grant.AuthTime
+
+	if grant.Nonce != "" {
+		idClaims["nonce"] = grant.Nonce
+	}
+
+	_, idToken, err := helper.EncodeJwt(idClaims)
+
+	if err != nil {
+		c.renderClientError(w, r, http.StatusInternalServerError, &models.OAuthErrorModel{Error: "server_error"})
+		return
+	}
+
+	// access token has no session family, so it's only accepted by the userinfo endpoint and not by the API
+	_, accessToken, err := helper.EncodeJwt(map[string]interface{}{
+		"iss":       issuer,
+		"sub":       subject,
+		"aud":       grant.ClientID,
+		"client_id": grant.ClientID,
+		"scope":     scope,
+	})
+
+	if err != nil {
+		c.renderClientError(w, r, http.StatusInternalServerError, &models.OAuthErrorModel{Error: "server_error"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	render.JSON(w, r, models.OAuthTokenModel{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(helper.AccessTokenTTL().Seconds()),
+		IDToken:     idToken,
+		Scope:       scope,
+	})
+}
+
+// Handler for claims of the user an access token was issued for, released by its scopes
+func (c *OAuthController) UserInfo(w http.ResponseWriter, r *http.Request) {
+	token, claims, err := helper.DecodeJwt(r)
+
+	clientId, _ := claims["client_id"].(string)
+
+	if err != nil || token == nil || clientId == "" || token.Subject() == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.renderClientError(w, r, http.StatusUnauthorized, &models.OAuthErrorModel{Error: "invalid_token"})
+		return
+	}
+
+	scope, _ := claims["scope"].(string)
+	scopes := strings.Fields(scope)
+
+	if !contains(scopes, "openid") {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		c.renderClientError(w, r, http.StatusForbidden, &models.OAuthErrorModel{Error: "insufficient_scope"})
+		return
+	}
+
+	info := map[string]interface{}{}
+
+	oauthErr, status, err := c.call("/oauth/userinfo", helper.Identity{Subject: token.Subject()}, map[string]interface{}{"scopes": scopes}, &info)
+
+	if err != nil {
+		c.renderClientError(w, r, helper.ErrorStatus(err), &models.OAuthErrorModel{Error: "server_error", ErrorDescription: err.Error()})
+		return
+	}
+
+	if oauthErr != nil {
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			oauthErr = &models.OAuthErrorModel{Error: "invalid_token"}
+		}
+
+		c.renderClientError(w, r, status, oauthErr)
+		return
+	}
+
+	render.JSON(w, r, info)
+}
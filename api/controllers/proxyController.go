@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ariefsn/book-store/api/helper"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+// Downstream service requests are proxied to
+type Upstream struct {
+	*helper.Upstream
+	proxy *httputil.ReverseProxy
+}
+
+// Gateway path forwarded to upstream.
+// Path ending with "/*" matches the path itself and everything below it,
+// the matched part is replaced with Target and the rest is kept.
+// Below such a path, PublicPaths don't require a token and Internal paths, only called by the gateway itself, aren't forwarded.
+// Both are relative to Path, e.g. "/register" or "/password/*".
+// Timeout overrides the one of the upstream, e.g. for slow endpoints.
+type Route struct {
+	Path        string
+	Upstream    *Upstream
+	Target      string
+	Public      bool
+	PublicPaths []string
+	Internal    []string
+	Timeout     time.Duration
+}
+
+type ProxyController struct {
+	BaseController
+}
+
+func NewProxyController() *ProxyController {
+	c := new(ProxyController)
+
+	return c
+}
+
+// Create upstream for host, e.g. "auth-service:3002"
+func (c *ProxyController) NewUpstream(name string, host string) *Upstream {
+	u := &Upstream{Upstream: helper.UseUpstream(name, host)}
+
+	u.proxy = &httputil.ReverseProxy{
+		Transport: u.Upstream,
+		Director: func(r *http.Request) {
+			r.URL.Scheme = u.URL.Scheme
+			r.URL.Host = u.URL.Host
+			r.Host = u.URL.Host
+
+			// identity only comes from the verified token or API key, never from the client
+			r.Header.Del("Authorization")
+			r.Header.Del(helper.APIKeyHeader)
+
+			// the proxy sets the address of the client, one sent by the client is dropped
+			r.Header.Del("X-Forwarded-For")
+
+			identity := c.RequestIdentity(r)
+			identity.Internal = false
+
+			signed, _ := helper.SignIdentity(identity, u.Name)
+
+			r.Header.Set(helper.IdentityHeader, signed)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			err = u.Failure(err)
+
+			render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		},
+	}
+
+	return u
+}
+
+// Register routes of the table, routes which aren't public require a valid bearer token
+func (c *ProxyController) Mount(r chi.Router, routes []Route) {
+	for _, route := range routes {
+		handler := c.Forward(route)
+
+		if strings.HasSuffix(route.Path, "/*") {
+			r.Handle(strings.TrimSuffix(route.Path, "/*"), handler)
+		}
+
+		r.Handle(route.Path, handler)
+	}
+}
+
+// Handler for forward request to upstream of the route.
+// Below a prefix the decoded and cleaned path is matched and forwarded,
+// so "/token/", "/%74oken" or "/x/../token" are all "/token".
+func (c *ProxyController) Forward(route Route) http.Handler {
+	prefix := strings.HasSuffix(route.Path, "/*")
+	base := strings.TrimSuffix(route.Path, "/*")
+	authenticated := chi.Chain(helper.Verifier, helper.Authenticator)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := route.Target
+		rest := ""
+
+		if prefix {
+			clean := path.Clean(r.URL.Path)
+
+			if clean != base && !strings.HasPrefix(clean, base+"/") {
+				render.Render(w, r, helper.ResponseError(http.StatusNotFound, errors.New("route not found")))
+				return
+			}
+
+			rest = strings.TrimPrefix(clean, base)
+			target = strings.TrimSuffix(route.Target, "/") + rest
+
+			if target == "" {
+				target = "/"
+			}
+		}
+
+		if matchPath(route.Internal, rest) {
+			render.Render(w, r, helper.ResponseError(http.StatusNotFound, errors.New("route not found")))
+			return
+		}
+
+		var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if route.Timeout > 0 {
+				var cancel context.CancelFunc
+
+				ctx, cancel = context.WithTimeout(ctx, route.Timeout)
+				defer cancel()
+			}
+
+			outReq := r.Clone(ctx)
+			outReq.URL.Path = target
+			outReq.URL.RawPath = ""
+
+			route.Upstream.proxy.ServeHTTP(w, outReq)
+		})
+
+		if !route.Public && !matchPath(route.PublicPaths, rest) {
+			handler = authenticated.Handler(handler)
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Whether path relative to the route is one of paths, one ending with "/*" also matches everything below it
+func matchPath(paths []string, rel string) bool {
+	for _, p := range paths {
+		dir := strings.TrimSuffix(p, "/*")
+
+		if rel == dir || (dir != p && strings.HasPrefix(rel, dir+"/")) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,138 @@
+package helper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imroc/req"
+)
+
+// Header for API keys, they're also accepted as bearer token
+const APIKeyHeader = "X-API-Key"
+
+const apiKeyPrefix = "bk_"
+
+var ErrAPIKeyInvalid = errors.New("invalid api key")
+
+// How long a key verified by auth service counts as client of the rate limiter
+const apiKeyVerifiedTTL = 5 * time.Minute
+
+// Hashes of keys verified by auth service, with the time they were
+var (
+	verifiedAPIKeys   = map[string]time.Time{}
+	verifiedAPIKeysMu sync.Mutex
+)
+
+func apiKeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Remember whether key was accepted by auth service
+func markAPIKey(key string, valid bool) {
+	verifiedAPIKeysMu.Lock()
+	defer verifiedAPIKeysMu.Unlock()
+
+	now := time.Now()
+
+	for hash, at := range verifiedAPIKeys {
+		if now.Sub(at) > apiKeyVerifiedTTL {
+			delete(verifiedAPIKeys, hash)
+		}
+	}
+
+	if valid {
+		verifiedAPIKeys[apiKeyHash(key)] = now
+	} else {
+		delete(verifiedAPIKeys, apiKeyHash(key))
+	}
+}
+
+// Check key was accepted by auth service lately
+func apiKeyVerified(key string) bool {
+	verifiedAPIKeysMu.Lock()
+	defer verifiedAPIKeysMu.Unlock()
+
+	at, ok := verifiedAPIKeys[apiKeyHash(key)]
+
+	return ok && time.Since(at) <= apiKeyVerifiedTTL
+}
+
+// API key sent with the request, empty when the request has none
+func APIKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+
+	bearer := r.Header.Get("Authorization")
+
+	if len(bearer) > 7 && strings.EqualFold(bearer[:7], "Bearer ") && strings.HasPrefix(bearer[7:], apiKeyPrefix) {
+		return bearer[7:]
+	}
+
+	return ""
+}
+
+// Check API key on auth service and get identity of its user, limited to the key scopes
+func verifyAPIKey(r *http.Request, key string) (*Identity, error) {
+	signed, _ := SignIdentity(Identity{Internal: true}, "auth")
+
+	header := req.Header{
+		"Accept":       "application/json",
+		IdentityHeader: signed,
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		header["X-Forwarded-For"] = host
+	}
+
+	res, err := authService.Request().Post(authService.Url("/token/key"), header, req.BodyJSON(map[string]string{"key": key}), r.Context())
+
+	if err != nil {
+		return nil, authService.Failure(err)
+	}
+
+	if res.Response().StatusCode >= http.StatusInternalServerError {
+		return nil, authService.Failure(errors.New(res.Response().Status))
+	}
+
+	if res.Response().StatusCode != http.StatusOK {
+		markAPIKey(key, false)
+		return nil, ErrAPIKeyInvalid
+	}
+
+	newRes := struct {
+		Data struct {
+			UserID int      `json:"userId"`
+			Email  string   `json:"email"`
+			Roles  []string `json:"roles"`
+			Scopes []string `json:"scopes"`
+		} `json:"data"`
+	}{}
+
+	if err := res.ToJSON(&newRes); err != nil {
+		return nil, err
+	}
+
+	if len(newRes.Data.Scopes) == 0 {
+		markAPIKey(key, false)
+		return nil, ErrAPIKeyInvalid
+	}
+
+	markAPIKey(key, true)
+
+	return &Identity{
+		Subject: strconv.Itoa(newRes.Data.UserID),
+		Email:   newRes.Data.Email,
+		Roles:   newRes.Data.Roles,
+		Scopes:  newRes.Data.Scopes,
+	}, nil
+}
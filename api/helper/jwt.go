@@ -1,42 +1,388 @@
 package helper
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/go-chi/jwtauth/v5"
 	"github.com/go-chi/render"
+	"github.com/imroc/req"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/lestrrat-go/jwx/jwt"
 )
 
-var tokenAuth *jwtauth.JWTAuth
+// Private key access tokens are signed with from its activation on
+type SigningKey struct {
+	ID         string
+	Algorithm  jwa.SignatureAlgorithm
+	ActiveFrom time.Time
+	key        jwk.Key
+}
+
+var (
+	signingKeys []SigningKey
+	publicKeys  jwk.Set
+)
+
+var accessTokenTTL = 15 * time.Minute
+
+// Auth service checking sessions and API keys, shared with the proxy and controllers
+var authService = GetUpstream("auth")
+
+// Check gateway runs in production, configured through APP_ENV
+func production() bool {
+	return os.Getenv("APP_ENV") == "production"
+}
+
+// Load signing keys from JWT_KEYS, a comma separated list of "kid=path" with optional "@activation" in RFC 3339.
+// Keys are PEM encoded RSA (RS256) or Ed25519 (EdDSA) private keys.
+// Without keys an ephemeral key is generated, except in production where it's an error.
+func InitJwt() error {
+	if d, err := time.ParseDuration(os.Getenv("JWT_ACCESS_TTL")); err == nil && d > 0 {
+		accessTokenTTL = d
+	}
+
+	keys, err := ParseSigningKeys(os.Getenv("JWT_KEYS"))
+
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		if production() {
+			return errors.New("JWT_KEYS is required in production")
+		}
+
+		fmt.Println("[Warning] JWT_KEYS is empty, tokens are signed with an ephemeral key and won't survive a restart")
+
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+
+		if err != nil {
+			return err
+		}
+
+		key, err := NewSigningKey("ephemeral", private, time.Time{})
+
+		if err != nil {
+			return err
+		}
+
+		keys = append(keys, *key)
+	}
+
+	return SetSigningKeys(keys)
+}
+
+// Parse JWT_KEYS value and read the key files
+func ParseSigningKeys(config string) ([]SigningKey, error) {
+	keys := []SigningKey{}
+
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid JWT_KEYS entry %q, expected kid=path", entry)
+		}
+
+		path := parts[1]
+		activeFrom := time.Time{}
+
+		if i := strings.LastIndex(path, "@"); i >= 0 {
+			t, err := time.Parse(time.RFC3339, path[i+1:])
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid activation of key %s: %w", parts[0], err)
+			}
+
+			path, activeFrom = path[:i], t
+		}
+
+		data, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			return nil, fmt.Errorf("can't read key %s: %w", parts[0], err)
+		}
+
+		private, err := parsePrivateKey(data)
+
+		if err != nil {
+			return nil, fmt.Errorf("can't parse key %s: %w", parts[0], err)
+		}
+
+		key, err := NewSigningKey(parts[0], private, activeFrom)
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, *key)
+	}
+
+	return keys, nil
+}
+
+func parsePrivateKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	return nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+}
+
+// Signing key for an RSA or Ed25519 private key
+func NewSigningKey(id string, private interface{}, activeFrom time.Time) (*SigningKey, error) {
+	alg := jwa.SignatureAlgorithm("")
+
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("key %s: RSA keys must have at least 2048 bits", id)
+		}
+
+		alg = jwa.RS256
+	case ed25519.PrivateKey:
+		alg = jwa.EdDSA
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T, use RSA or Ed25519", id, private)
+	}
+
+	key, err := jwk.New(private)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key.Set(jwk.KeyIDKey, id)
+	key.Set(jwk.AlgorithmKey, alg)
+	key.Set(jwk.KeyUsageKey, "sig")
+
+	return &SigningKey{ID: id, Algorithm: alg, ActiveFrom: activeFrom, key: key}, nil
+}
+
+// Replace signing keys, every key is published and accepted, the newest active one signs
+func SetSigningKeys(keys []SigningKey) error {
+	set := jwk.NewSet()
+	ids := map[string]bool{}
+
+	for _, k := range keys {
+		if ids[k.ID] {
+			return fmt.Errorf("duplicate key id %s", k.ID)
+		}
+
+		ids[k.ID] = true
+
+		public, err := jwk.PublicKeyOf(k.key)
 
-func InitJwt() {
-	secret := "This is default secret jwt"
+		if err != nil {
+			return err
+		}
+
+		set.Add(public)
+	}
+
+	sorted := append([]SigningKey{}, keys...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ActiveFrom.Before(sorted[j].ActiveFrom)
+	})
+
+	signingKeys = sorted
+	publicKeys = set
+
+	return nil
+}
 
-	if os.Getenv("JWT_SECRET") != "" {
-		secret = os.Getenv("JWT_SECRET")
+// Newest key active at t, keys activated later are already published so verifiers can fetch them in time
+func currentSigningKey(t time.Time) (*SigningKey, error) {
+	for i := len(signingKeys) - 1; i >= 0; i-- {
+		if !signingKeys[i].ActiveFrom.After(t) {
+			return &signingKeys[i], nil
+		}
+	}
+
+	return nil, errors.New("no active signing key")
+}
+
+// Public keys for verifying access tokens, as JSON Web Key Set
+func PublicKeys() jwk.Set {
+	return publicKeys
+}
+
+// Algorithms of the signing keys, for the OpenID Connect discovery document
+func SigningAlgorithms() []string {
+	algorithms := []string{}
+	seen := map[jwa.SignatureAlgorithm]bool{}
+
+	for _, k := range signingKeys {
+		if !seen[k.Algorithm] {
+			seen[k.Algorithm] = true
+			algorithms = append(algorithms, k.Algorithm.String())
+		}
 	}
 
-	tokenAuth = jwtauth.New("HS256", []byte(secret), nil)
+	return algorithms
 }
 
+// Encode short lived access token, iat and exp are set from the configured TTL
 func EncodeJwt(claims map[string]interface{}) (token jwt.Token, tokenString string, err error) {
-	return tokenAuth.Encode(claims)
+	key, err := currentSigningKey(time.Now())
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	jwtauth.SetIssuedNow(claims)
+	jwtauth.SetExpiryIn(claims, accessTokenTTL)
+
+	token = jwt.New()
+
+	for k, v := range claims {
+		token.Set(k, v)
+	}
+
+	signed, err := jwt.Sign(token, key.Algorithm, key.key)
+
+	return token, string(signed), err
+}
+
+// Verify access token with the key of its kid, the algorithm comes from the key and not from the token
+func VerifyJwt(tokenString string) (jwt.Token, error) {
+	token, err := jwt.ParseString(tokenString, jwt.WithKeySet(publicKeys))
+
+	if err != nil {
+		return nil, jwtauth.ErrUnauthorized
+	}
+
+	if err := jwt.Validate(token); err != nil {
+		return token, jwtauth.ErrorReason(err)
+	}
+
+	return token, nil
+}
+
+// Middleware for verify bearer token of request, result is stored for Authenticator
+func Verifier(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// already verified, e.g. for the rate limiter
+		if r.Context().Value(jwtauth.TokenCtxKey) != nil || r.Context().Value(jwtauth.ErrorCtxKey) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var token jwt.Token
+		err := jwtauth.ErrNoTokenFound
+
+		for _, find := range []func(*http.Request) string{jwtauth.TokenFromHeader, jwtauth.TokenFromCookie} {
+			if s := find(r); s != "" {
+				token, err = VerifyJwt(s)
+				break
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), token, err)))
+	})
+}
+
+// Handler for JSON Web Key Set of access token keys
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	render.JSON(w, r, publicKeys)
 }
 
 func DecodeJwt(r *http.Request) (token jwt.Token, claims map[string]interface{}, err error) {
 	return jwtauth.FromContext(r.Context())
 }
 
-func TokenAuth() *jwtauth.JWTAuth {
-	return tokenAuth
+func AccessTokenTTL() time.Duration {
+	return accessTokenTTL
 }
 
+// Check session of the access token hasn't been terminated on auth service, which also records its activity
+func checkTokenFamily(r *http.Request, claims map[string]interface{}) error {
+	familyId, _ := claims["fid"].(string)
+
+	if familyId == "" {
+		return errors.New("token revoked")
+	}
+
+	signed, _ := SignIdentity(Identity{Internal: true}, "auth")
+
+	header := req.Header{
+		"Accept":       "application/json",
+		IdentityHeader: signed,
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		header["X-Forwarded-For"] = host
+	}
+
+	res, err := authService.Request().Get(authService.Url("/token/family/"+familyId), header, r.Context())
+
+	if err != nil {
+		return authService.Failure(err)
+	}
+
+	if res.Response().StatusCode >= http.StatusInternalServerError {
+		return authService.Failure(errors.New(res.Response().Status))
+	}
+
+	if res.Response().StatusCode != http.StatusOK {
+		return errors.New("token revoked")
+	}
+
+	return nil
+}
+
+// Middleware for allow requests with a valid access token or API key.
+// Identity of an API key is put in the request context for the proxy.
 func Authenticator(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, _, err := jwtauth.FromContext(r.Context())
+		if key := APIKeyFromRequest(r); key != "" {
+			identity, err := verifyAPIKey(r, key)
+
+			if errors.Is(err, ErrUpstream) {
+				render.Render(w, r, ResponseError(ErrorStatus(err), err))
+				return
+			}
+
+			if err != nil {
+				render.Render(w, r, ResponseError(http.StatusUnauthorized, ErrAPIKeyInvalid))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+			return
+		}
+
+		token, claims, err := jwtauth.FromContext(r.Context())
 
 		if err != nil {
 			render.Render(w, r, ResponseError(http.StatusUnauthorized, err))
@@ -49,6 +395,19 @@ func Authenticator(next http.Handler) http.Handler {
 			return
 		}
 
+		err = checkTokenFamily(r, claims)
+
+		// an unavailable auth service doesn't mean the token was revoked
+		if errors.Is(err, ErrUpstream) {
+			render.Render(w, r, ResponseError(ErrorStatus(err), err))
+			return
+		}
+
+		if err != nil {
+			render.Render(w, r, ResponseError(http.StatusUnauthorized, err))
+			return
+		}
+
 		// Token is authenticated, pass it through
 		next.ServeHTTP(w, r)
 	})
@@ -0,0 +1,88 @@
+package helper
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Path metrics are served at, answered before identity or token are checked
+const MetricsPath = "/metrics"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Requests handled, by method, route pattern and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time to handle requests, by method, route pattern and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	upstreamRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_requests_total",
+		Help: "Attempts to call upstream services, by upstream, method and status, \"error\" without response and \"circuit_open\" when not sent.",
+	}, []string{"upstream", "method", "status"})
+
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "upstream_request_duration_seconds",
+		Help:    "Time until upstream services responded to an attempt, by upstream and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"upstream", "method"})
+
+	upstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_retries_total",
+		Help: "Retries of idempotent requests to upstream services.",
+	}, []string{"upstream"})
+
+	upstreamCircuit = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "upstream_circuit_state",
+		Help: "State of the circuit breaker of upstream services: 0 closed, 1 open, 2 half-open.",
+	}, []string{"upstream"})
+)
+
+// Middleware for serve metrics at MetricsPath and count requests with their duration.
+// Requests are labeled by route pattern, e.g. "/book/{id}", so the number of series stays small.
+func Metrics(next http.Handler) http.Handler {
+	metrics := promhttp.Handler()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == MetricsPath {
+			metrics.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := prometheus.Labels{"method": r.Method, "route": routePattern(r), "status": strconv.Itoa(status)}
+
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Route pattern request matched, "unmatched" when none did
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+
+	return "unmatched"
+}
@@ -0,0 +1,464 @@
+package helper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-chi/render"
+	"github.com/go-redis/redis/v8"
+)
+
+var ErrRateLimited = errors.New("rate limit exceeded, try again later")
+
+// Token bucket holding up to Requests tokens, refilled with Requests tokens per Period. Every request takes one.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Limit of requests to a gateway path, Path ending with "/*" matches the path itself and everything below it
+type RouteLimit struct {
+	Method string
+	Path   string
+	Limit  RateLimit
+}
+
+// State of bucket after taking a token
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token when not allowed
+}
+
+// Store of token buckets, shared by every gateway instance when it's Redis
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+	// Give back token taken from bucket, when another bucket rejected the request
+	Return(ctx context.Context, key string, limit RateLimit) error
+}
+
+// Limits clients by API key, user of the access token or IP, each with a bucket of its role or the default limit
+// and one per matching route limit. A request must get a token of every bucket.
+type RateLimiter struct {
+	Store   RateLimitStore
+	Default RateLimit
+	Roles   map[string]RateLimit
+	Routes  []RouteLimit
+}
+
+// Parse limit like "100/1m", i.e. 100 requests per minute
+func ParseRateLimit(s string) (RateLimit, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "/", 2)
+
+	if len(parts) != 2 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, e.g. 100/1m", s)
+	}
+
+	requests, err := strconv.Atoi(parts[0])
+
+	if err != nil || requests <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid requests of rate limit %q", s)
+	}
+
+	period, err := time.ParseDuration(parts[1])
+
+	if err != nil || period <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid period of rate limit %q", s)
+	}
+
+	return RateLimit{Requests: requests, Period: period}, nil
+}
+
+// Policy of the limit as in the RateLimit-Policy header, e.g. "100;w=60"
+func (l RateLimit) Policy() string {
+	return fmt.Sprintf("%d;w=%d", l.Requests, int(math.Ceil(l.Period.Seconds())))
+}
+
+// Tokens refilled per nanosecond
+func (l RateLimit) rate() float64 {
+	return float64(l.Requests) / float64(l.Period)
+}
+
+// Take token from bucket with tokens, elapsed since it was last updated, returns the tokens left
+func (l RateLimit) take(tokens float64, elapsed time.Duration) (float64, RateLimitResult) {
+	tokens = math.Min(float64(l.Requests), tokens+float64(elapsed)*l.rate())
+	allowed := tokens >= 1
+
+	if allowed {
+		tokens--
+	}
+
+	return tokens, l.result(tokens, allowed)
+}
+
+// Result of bucket with tokens left
+func (l RateLimit) result(tokens float64, allowed bool) RateLimitResult {
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     time.Duration((float64(l.Requests) - tokens) / l.rate()),
+	}
+
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / l.rate())
+	}
+
+	return result
+}
+
+// Create rate limiter configured through RATE_LIMIT (default 120/1m), RATE_LIMIT_ROLES, e.g. "admin=600/1m",
+// RATE_LIMIT_ROUTES, e.g. "POST /auth/token=5/1m,/auth/register=10/1h", and RATE_LIMIT_STORE, "memory" (default)
+// or "redis" at REDIS_URL
+func NewRateLimiter() (*RateLimiter, error) {
+	limiter := &RateLimiter{Roles: map[string]RateLimit{}}
+
+	var err error
+
+	limiter.Default, err = ParseRateLimit(envString("RATE_LIMIT", "120/1m"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range splitList(os.Getenv("RATE_LIMIT_ROLES")) {
+		parts := strings.SplitN(entry, "=", 2)
+
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid role rate limit %q, e.g. admin=600/1m", entry)
+		}
+
+		if limiter.Roles[parts[0]], err = ParseRateLimit(parts[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range splitList(os.Getenv("RATE_LIMIT_ROUTES")) {
+		parts := strings.SplitN(entry, "=", 2)
+
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid route rate limit %q, e.g. POST /auth/token=5/1m", entry)
+		}
+
+		route := RouteLimit{Path: parts[0]}
+
+		if fields := strings.Fields(parts[0]); len(fields) == 2 {
+			route.Method, route.Path = strings.ToUpper(fields[0]), fields[1]
+		}
+
+		if route.Limit, err = ParseRateLimit(parts[1]); err != nil {
+			return nil, err
+		}
+
+		limiter.Routes = append(limiter.Routes, route)
+	}
+
+	switch store := envString("RATE_LIMIT_STORE", "memory"); store {
+	case "memory":
+		limiter.Store = NewMemoryRateLimitStore()
+	case "redis":
+		options, err := redis.ParseURL(envString("REDIS_URL", "redis://localhost:6379/0"))
+
+		if err != nil {
+			return nil, err
+		}
+
+		limiter.Store = NewRedisRateLimitStore(redis.NewClient(options))
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", store)
+	}
+
+	return limiter, nil
+}
+
+func envString(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func splitList(s string) []string {
+	list := []string{}
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// Client of request, by API key, user of a verified access token or IP.
+// API keys count as client once the gateway verified them, until then made up keys are limited by IP.
+func rateLimitClient(r *http.Request) (string, []string) {
+	if key := APIKeyFromRequest(r); key != "" && apiKeyVerified(key) {
+		// only the visible prefix, so the secret is never stored
+		if parts := strings.SplitN(key, "_", 3); len(parts) == 3 {
+			return "key:" + parts[0] + "_" + parts[1], nil
+		}
+
+		sum := sha256.Sum256([]byte(key))
+
+		return "key:" + hex.EncodeToString(sum[:8]), nil
+	}
+
+	if token, claims, err := jwtauth.FromContext(r.Context()); err == nil && token != nil {
+		// tokens of OpenID Connect clients carry the user as subject
+		user := token.Subject()
+
+		if id, ok := claims["id"]; ok {
+			user = fmt.Sprint(id)
+		}
+
+		roles := []string{}
+
+		if list, ok := claims["roles"].([]interface{}); ok {
+			for _, role := range list {
+				if s, ok := role.(string); ok {
+					roles = append(roles, s)
+				}
+			}
+		}
+
+		if user != "" {
+			return "user:" + user, roles
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host, nil
+}
+
+// Limit of client with roles, the most generous one of its roles
+func (l *RateLimiter) clientLimit(roles []string) RateLimit {
+	limit, found := l.Default, false
+
+	for _, role := range roles {
+		if roleLimit, ok := l.Roles[role]; ok && (!found || roleLimit.rate() > limit.rate()) {
+			limit, found = roleLimit, true
+		}
+	}
+
+	return limit
+}
+
+func (route RouteLimit) matches(r *http.Request) bool {
+	if route.Method != "" && route.Method != r.Method {
+		return false
+	}
+
+	if strings.HasSuffix(route.Path, "/*") {
+		base := strings.TrimSuffix(route.Path, "/*")
+
+		return r.URL.Path == base || strings.HasPrefix(r.URL.Path, base+"/")
+	}
+
+	return r.URL.Path == route.Path
+}
+
+// Middleware for limit requests of clients, responds 429 with Retry-After when a bucket is empty,
+// tokens taken from the other buckets are given back then. The bucket with the fewest remaining requests
+// is described by the RateLimit headers. Requests are let through when the store fails,
+// the gateway must not go down with it.
+func (l *RateLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, roles := rateLimitClient(r)
+
+		buckets := map[string]RateLimit{client: l.clientLimit(roles)}
+
+		for _, route := range l.Routes {
+			if route.matches(r) {
+				buckets[client+"|"+route.Method+" "+route.Path] = route.Limit
+			}
+		}
+
+		var tightest *RateLimitResult
+		var tightestLimit RateLimit
+
+		taken := map[string]RateLimit{}
+
+		for key, limit := range buckets {
+			result, err := l.Store.Take(r.Context(), key, limit)
+
+			if err != nil {
+				fmt.Println("[Error] rate limit:", err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if result.Allowed {
+				taken[key] = limit
+			}
+
+			if tightest == nil || !result.Allowed && tightest.Allowed || result.Allowed == tightest.Allowed && result.Remaining < tightest.Remaining {
+				tightest, tightestLimit = &result, limit
+			}
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(tightestLimit.Requests))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(tightest.Reset.Seconds()))))
+		w.Header().Set("RateLimit-Policy", tightestLimit.Policy())
+
+		if !tightest.Allowed {
+			for key, limit := range taken {
+				if err := l.Store.Return(r.Context(), key, limit); err != nil {
+					fmt.Println("[Error] rate limit:", err.Error())
+				}
+			}
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tightest.RetryAfter.Seconds()))))
+			render.Render(w, r, ResponseError(http.StatusTooManyRequests, ErrRateLimited))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Token buckets of a single gateway instance
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*memoryBucket{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// buckets which are full again are the same as new ones
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, b := range s.buckets {
+			if now.After(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+
+	if !ok {
+		b = &memoryBucket{tokens: float64(limit.Requests), updated: now}
+		s.buckets[key] = b
+	}
+
+	tokens, result := limit.take(b.tokens, now.Sub(b.updated))
+
+	b.tokens, b.updated, b.full = tokens, now, now.Add(result.Reset)
+
+	return result, nil
+}
+
+func (s *MemoryRateLimitStore) Return(ctx context.Context, key string, limit RateLimit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.buckets[key]; ok {
+		b.tokens = math.Min(float64(limit.Requests), b.tokens+1)
+	}
+
+	return nil
+}
+
+// Token buckets in Redis, updated atomically by a script
+type RedisRateLimitStore struct {
+	client redis.UniversalClient
+}
+
+// Refill bucket by elapsed time and take a token, returns whether it was taken and the tokens left.
+// Time comes from the gateway, as scripts writing data can't read the clock of Redis.
+var takeTokenScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// Give token back to bucket, unless it expired meanwhile
+var returnTokenScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local tokens = tonumber(redis.call("HGET", KEYS[1], "tokens"))
+if tokens then
+	redis.call("HSET", KEYS[1], "tokens", tostring(math.min(capacity, tokens + 1)))
+end
+return 1
+`)
+
+func NewRedisRateLimitStore(client redis.UniversalClient) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client}
+}
+
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	// tokens per millisecond
+	rate := limit.rate() * float64(time.Millisecond)
+
+	res, err := takeTokenScript.Run(ctx, s.client, []string{"ratelimit:" + key}, limit.Requests, rate, time.Now().UnixNano()/int64(time.Millisecond)).Slice()
+
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	if len(res) != 2 {
+		return RateLimitResult{}, errors.New("unexpected reply of rate limit script")
+	}
+
+	tokens, err := strconv.ParseFloat(fmt.Sprint(res[1]), 64)
+
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	allowed, _ := res[0].(int64)
+
+	return limit.result(tokens, allowed == 1), nil
+}
+
+func (s *RedisRateLimitStore) Return(ctx context.Context, key string, limit RateLimit) error {
+	return returnTokenScript.Run(ctx, s.client, []string{"ratelimit:" + key}, limit.Requests).Err()
+}
@@ -1,9 +1,12 @@
 package helper
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/go-chi/render"
@@ -23,6 +26,13 @@ func (e *ResponseModel) Render(w http.ResponseWriter, r *http.Request) error {
 		e.Message = fmt.Sprintf("%s: %s", e.HTTPStatusText, e.Message)
 	}
 
+	// clients may try again once the circuit breaker of the upstream lets requests through
+	upstream := &UpstreamError{}
+
+	if errors.As(e.Error, &upstream) && upstream.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(upstream.RetryAfter.Seconds()))))
+	}
+
 	render.Status(r, e.HTTPStatusCode)
 
 	return nil
@@ -44,12 +54,18 @@ func statusText(code int) string {
 		statusText = "Not Found"
 	case 405:
 		statusText = "Method Not Allowed"
+	case 409:
+		statusText = "Conflict"
+	case 429:
+		statusText = "Too Many Requests"
 	case 500:
 		statusText = "Internal Server Error"
 	case 502:
 		statusText = "Bad Gateway"
 	case 503:
 		statusText = "Server Unavailable"
+	case 504:
+		statusText = "Gateway Timeout"
 	}
 
 	return statusText
@@ -60,7 +76,19 @@ func Response(response *ResponseModel) render.Renderer {
 		return ResponseSuccess(response.Data)
 	}
 
-	return ResponseError(response.HTTPStatusCode, errors.New(strings.Replace(response.Message, statusText(response.HTTPStatusCode)+": ", "", 1)))
+	res := ResponseError(response.HTTPStatusCode, errors.New(strings.Replace(response.Message, statusText(response.HTTPStatusCode)+": ", "", 1))).(*ResponseModel)
+
+	// details of the error, e.g. failing fields, are passed through
+	res.Data = response.Data
+
+	// failing fields are typed again, so they are listed in problem details
+	fields := []FieldError{}
+
+	if body, err := json.Marshal(response.Data); err == nil && json.Unmarshal(body, &fields) == nil && len(fields) > 0 && fields[0].Code != "" {
+		res.Data = fields
+	}
+
+	return res
 }
 
 func ResponseSuccess(data interface{}) render.Renderer {
@@ -74,7 +102,7 @@ func ResponseSuccess(data interface{}) render.Renderer {
 }
 
 func ResponseError(errCode int, err error) render.Renderer {
-	return &ResponseModel{
+	res := &ResponseModel{
 		Success:        false,
 		Data:           nil,
 		HTTPStatusCode: errCode,
@@ -82,4 +110,13 @@ func ResponseError(errCode int, err error) render.Renderer {
 		Error:          err,
 		Message:        strings.Replace(err.Error(), statusText(errCode)+": ", "", 1),
 	}
+
+	// failing fields are listed, so clients can show them next to their inputs
+	validation := &ValidationError{}
+
+	if errors.As(err, &validation) {
+		res.Data = validation.Fields
+	}
+
+	return res
 }
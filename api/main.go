@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -11,59 +12,73 @@ import (
 	"github.com/ariefsn/book-store/api/helper"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/jwtauth/v5"
 	"github.com/go-chi/render"
 )
 
 func main() {
-	helper.InitJwt()
+	if err := helper.InitJwt(); err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
+
+	if err := helper.InitIdentity("gateway"); err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
+
+	shutdown, err := helper.InitTracing("gateway")
+
+	if err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
+
+	defer shutdown(context.Background())
+
+	limiter, err := helper.NewRateLimiter()
+
+	if err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
 
 	r := chi.NewRouter()
 
 	r.Use(middleware.Logger)
 	r.Use(middleware.Heartbeat("/ping"))
+	r.Use(helper.Metrics)
+	r.Use(helper.Tracing)
+	r.Use(helper.Verifier)
+	r.Use(limiter.Handler)
 
 	base := controllers.BaseController{}
 	auth := controllers.NewAuthController()
-	book := controllers.NewBookController()
+	proxy := controllers.NewProxyController()
+	oauth := controllers.NewOAuthController()
 
 	r.Get("/", base.Hi)
+	r.Get("/.well-known/jwks.json", helper.JWKS)
+	r.Get("/.well-known/openid-configuration", oauth.Discovery)
 
-	r.Route("/auth", func(r chi.Router) {
-		r.Get("/", auth.Hi)
-
-		r.Post("/register", auth.Register)
-		r.Post("/token", auth.Login)
+	r.Post("/auth/token", auth.Login)
+	r.Post("/auth/token/2fa", auth.TwoFactor)
+	r.Post("/auth/token/refresh", auth.Refresh)
 
-		r.Group(func(r chi.Router) {
-			r.Use(jwtauth.Verifier(helper.TokenAuth()))
-			r.Use(helper.Authenticator)
+	r.Get("/oauth/authorize", oauth.Authorize)
+	r.Post("/oauth/token", oauth.Token)
+	r.Get("/oauth/userinfo", oauth.UserInfo)
+	r.Post("/oauth/userinfo", oauth.UserInfo)
 
-			r.Get("/me", auth.Profile)
-			r.Put("/me", auth.UpdateMe)
+	r.Group(func(r chi.Router) {
+		r.Use(helper.Verifier)
+		r.Use(helper.Authenticator)
 
-			r.Get("/user", auth.All)
-			r.Get("/user/{id}", auth.Find)
-			r.Post("/user", auth.Create)
-			r.Put("/user/{id}", auth.UpdateUser)
-			r.Delete("/user/{id}", auth.DeleteUser)
-		})
+		r.Post("/auth/logout", auth.Logout)
+		r.Get("/oauth/consent", oauth.ConsentInfo)
+		r.Post("/oauth/consent", oauth.Consent)
 	})
 
-	r.Route("/book", func(r chi.Router) {
-		r.Get("/hi", book.Hi)
-
-		r.Group(func(r chi.Router) {
-			r.Use(jwtauth.Verifier(helper.TokenAuth()))
-			r.Use(helper.Authenticator)
-
-			r.Get("/", book.All)
-			r.Get("/{id}", book.Find)
-			r.Post("/", book.Create)
-			r.Put("/{id}", book.UpdateBook)
-			r.Delete("/{id}", book.DeleteBook)
-		})
-	})
+	proxy.Mount(r, routeTable(proxy))
 
 	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, helper.ResponseError(http.StatusMethodNotAllowed, errors.New("method not allowed")))
@@ -0,0 +1,884 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ariefsn/book-store/api/controllers"
+	"github.com/ariefsn/book-store/api/helper"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-chi/render"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestProxyRoute(t *testing.T) {
+	assert := assert.New(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Path", r.URL.Path)
+		w.Header().Set("X-Upstream-Query", r.URL.RawQuery)
+		w.Header().Set("X-Upstream-Identity", r.Header.Get(helper.IdentityHeader))
+		w.Header().Set("X-Upstream-Forwarded-For", r.Header.Get("X-Forwarded-For"))
+		w.WriteHeader(http.StatusTeapot)
+		fmt.Fprint(w, "streamed")
+	}))
+	defer upstream.Close()
+
+	os.Setenv("SERVICE_SECRET", "test secret")
+
+	// identities are verified as if upstream is the auth service
+	helper.InitIdentity("auth")
+
+	proxy := controllers.NewProxyController()
+	auth := proxy.NewUpstream("auth", strings.TrimPrefix(upstream.URL, "http://"))
+
+	tc := []struct {
+		name  string
+		route controllers.Route
+		path  string
+		want  string
+	}{
+		{name: "should rewrite prefix", route: controllers.Route{Path: "/auth/user/*", Upstream: auth, Target: "/user"}, path: "/auth/user/1/role?x=1", want: "/user/1/role"},
+		{name: "should rewrite prefix itself", route: controllers.Route{Path: "/auth/me/*", Upstream: auth, Target: "/user/me"}, path: "/auth/me", want: "/user/me"},
+		{name: "should rewrite whole prefix", route: controllers.Route{Path: "/auth/*", Upstream: auth, Target: "/"}, path: "/auth/keys/1", want: "/keys/1"},
+		{name: "should rewrite exact path", route: controllers.Route{Path: "/book/hi", Upstream: auth, Target: "/"}, path: "/book/hi", want: "/"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			proxy.Mount(r, []controllers.Route{{Path: c.route.Path, Upstream: c.route.Upstream, Target: c.route.Target, Public: true}})
+
+			req := httptest.NewRequest(http.MethodGet, c.path, nil)
+			spoofed, _ := helper.SignIdentity(helper.Identity{Subject: "1"}, "auth")
+
+			req.Header.Set(helper.IdentityHeader, spoofed)
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			res := httptest.NewRecorder()
+
+			r.ServeHTTP(res, req)
+
+			assert.Equal(http.StatusTeapot, res.Code, "status code should be preserved")
+			assert.Equal("streamed", res.Body.String())
+			assert.Equal(c.want, res.Header().Get("X-Upstream-Path"))
+			assert.Equal(req.URL.RawQuery, res.Header().Get("X-Upstream-Query"), "query should be preserved")
+			assert.Equal("192.0.2.1", res.Header().Get("X-Upstream-Forwarded-For"), "address from client should be replaced")
+
+			identity, err := helper.VerifyIdentity(res.Header().Get("X-Upstream-Identity"))
+
+			assert.Nil(err, "identity should be signed for upstream")
+			assert.Empty(identity.Subject, "identity from client should be dropped")
+		})
+	}
+
+	t.Run("should inject identity from token", func(t *testing.T) {
+		assert.Nil(helper.InitJwt())
+
+		token, _, _ := helper.EncodeJwt(map[string]interface{}{"id": 1, "email": "john.doe@gmail.com", "roles": []string{"customer"}, "fid": "family"})
+
+		req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+		req = req.WithContext(jwtauth.NewContext(req.Context(), token, nil))
+		res := httptest.NewRecorder()
+
+		proxy.Forward(controllers.Route{Path: "/auth/me/*", Upstream: auth, Target: "/user/me", Public: true}).ServeHTTP(res, req)
+
+		identity, err := helper.VerifyIdentity(res.Header().Get("X-Upstream-Identity"))
+
+		assert.Nil(err)
+		assert.Equal(1, identity.UserID())
+		assert.Equal("john.doe@gmail.com", identity.Email)
+		assert.Equal([]string{"customer"}, identity.Roles)
+		assert.Equal("family", identity.Session, "session should be passed for listing sessions")
+	})
+
+	t.Run("should inject identity from api key", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/book", nil)
+		req.Header.Set(helper.APIKeyHeader, "bk_x7k2m9qa_secret")
+		req = req.WithContext(helper.WithIdentity(req.Context(), &helper.Identity{Subject: "2", Scopes: []string{"book:read"}, Internal: true}))
+		res := httptest.NewRecorder()
+
+		proxy.Forward(controllers.Route{Path: "/book/*", Upstream: auth, Target: "/book", Public: true}).ServeHTTP(res, req)
+
+		identity, err := helper.VerifyIdentity(res.Header().Get("X-Upstream-Identity"))
+
+		assert.Nil(err)
+		assert.Equal(2, identity.UserID())
+		assert.Equal([]string{"book:read"}, identity.Scopes)
+		assert.False(identity.Internal, "proxied request should never be internal")
+	})
+
+	t.Run("should require token except for public paths and hide internal paths", func(t *testing.T) {
+		assert.Nil(helper.InitJwt())
+
+		r := chi.NewRouter()
+		proxy.Mount(r, []controllers.Route{{
+			Path:        "/auth/*",
+			Upstream:    auth,
+			Target:      "/",
+			PublicPaths: []string{"/register", "/verify/*"},
+			Internal:    []string{"/login", "/token/*", "/oauth/*", "/metrics"},
+		}})
+
+		paths := map[string]int{
+			"/auth/register":              http.StatusTeapot,
+			"/auth/verify":                http.StatusTeapot,
+			"/auth/verify/resend":         http.StatusTeapot,
+			"/auth/login":                 http.StatusNotFound,
+			"/auth/token":                 http.StatusNotFound,
+			"/auth/token/key":             http.StatusNotFound,
+			"/auth/token/":                http.StatusNotFound,
+			"/auth/%74oken":               http.StatusNotFound,
+			"/auth/%6Cogin":               http.StatusNotFound,
+			"/auth/token/%6Bey":           http.StatusNotFound,
+			"/auth/%6Fauth/code":          http.StatusNotFound,
+			"/auth/%6Detrics":             http.StatusNotFound,
+			"/auth/verify/../token":       http.StatusNotFound,
+			"/auth/verify/%2E%2E/login":   http.StatusNotFound,
+			"/auth/keys":                  http.StatusUnauthorized,
+			"/auth/user/1":                http.StatusUnauthorized,
+			"/auth/%72egister/../user/1":  http.StatusUnauthorized,
+			"/auth/register/../../book/1": http.StatusNotFound,
+		}
+
+		for path, want := range paths {
+			req := httptest.NewRequest(http.MethodPost, path, nil)
+			res := httptest.NewRecorder()
+
+			r.ServeHTTP(res, req)
+
+			assert.Equal(want, res.Code, path)
+		}
+	})
+
+	t.Run("should respond bad gateway when upstream is down", func(t *testing.T) {
+		down := proxy.NewUpstream("book", "127.0.0.1:1")
+
+		req := httptest.NewRequest(http.MethodGet, "/book", nil)
+		res := httptest.NewRecorder()
+
+		proxy.Forward(controllers.Route{Path: "/book/*", Upstream: down, Target: "/book", Public: true}).ServeHTTP(res, req)
+
+		assert.Equal(http.StatusBadGateway, res.Code)
+	})
+}
+
+func TestAPIKeyFromRequest(t *testing.T) {
+	tc := []struct {
+		name   string
+		header string
+		value  string
+		want   string
+	}{
+		{name: "should read api key header", header: helper.APIKeyHeader, value: "bk_x7k2m9qa_secret", want: "bk_x7k2m9qa_secret"},
+		{name: "should read api key as bearer token", header: "Authorization", value: "Bearer bk_x7k2m9qa_secret", want: "bk_x7k2m9qa_secret"},
+		{name: "should ignore access token", header: "Authorization", value: "Bearer eyJhbGciOiJIUzI1NiJ9.e30.sig", want: ""},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/book", nil)
+			req.Header.Set(c.header, c.value)
+
+			assert.Equal(t, c.want, helper.APIKeyFromRequest(req))
+		})
+	}
+}
+
+func TestSigningKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(edKey)
+
+	ioutil.WriteFile(filepath.Join(dir, "rsa.pem"), pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "ed.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0600)
+
+	kidOf := func(token string) string {
+		header := struct {
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+		}{}
+
+		segment, _ := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+		json.Unmarshal(segment, &header)
+
+		return header.Kid + "/" + header.Alg
+	}
+
+	t.Run("should sign with newest active key", func(t *testing.T) {
+		future := time.Now().Add(time.Hour).Format(time.RFC3339)
+		keys, err := helper.ParseSigningKeys("k1=" + filepath.Join(dir, "rsa.pem") + ",k2=" + filepath.Join(dir, "ed.pem") + "@" + future)
+
+		assert.Nil(err)
+		assert.Nil(helper.SetSigningKeys(keys))
+
+		_, token, err := helper.EncodeJwt(map[string]interface{}{"id": 1})
+
+		assert.Nil(err)
+		assert.Equal("k1/RS256", kidOf(token), "key activated later shouldn't sign yet")
+
+		_, err = helper.VerifyJwt(token)
+
+		assert.Nil(err)
+	})
+
+	t.Run("should rotate to activated key and keep accepting old tokens", func(t *testing.T) {
+		keys, _ := helper.ParseSigningKeys("k1=" + filepath.Join(dir, "rsa.pem") + ",k2=" + filepath.Join(dir, "ed.pem"))
+		old, _ := helper.NewSigningKey("k1", rsaKey, time.Time{})
+
+		helper.SetSigningKeys([]helper.SigningKey{*old})
+		_, oldToken, _ := helper.EncodeJwt(map[string]interface{}{"id": 1})
+
+		keys[1].ActiveFrom = time.Now().Add(-time.Minute)
+		helper.SetSigningKeys(keys)
+
+		_, token, _ := helper.EncodeJwt(map[string]interface{}{"id": 1})
+
+		assert.Equal("k2/EdDSA", kidOf(token))
+
+		_, err := helper.VerifyJwt(oldToken)
+
+		assert.Nil(err, "token of previous key should still be valid")
+	})
+
+	t.Run("should reject token of unknown key", func(t *testing.T) {
+		_, other, _ := ed25519.GenerateKey(rand.Reader)
+		unknown, _ := helper.NewSigningKey("k2", other, time.Time{})
+
+		helper.SetSigningKeys([]helper.SigningKey{*unknown})
+		_, token, _ := helper.EncodeJwt(map[string]interface{}{"id": 1})
+
+		keys, _ := helper.ParseSigningKeys("k1=" + filepath.Join(dir, "rsa.pem") + ",k2=" + filepath.Join(dir, "ed.pem"))
+		helper.SetSigningKeys(keys)
+
+		_, err := helper.VerifyJwt(token)
+
+		assert.NotNil(err)
+	})
+
+	t.Run("should publish public keys only", func(t *testing.T) {
+		res := httptest.NewRecorder()
+
+		helper.JWKS(res, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+		set := struct {
+			Keys []map[string]interface{} `json:"keys"`
+		}{}
+
+		assert.Nil(json.Unmarshal(res.Body.Bytes(), &set))
+		assert.Len(set.Keys, 2)
+
+		for _, key := range set.Keys {
+			assert.NotContains(key, "d", "private part shouldn't be published")
+			assert.Contains([]string{"k1", "k2"}, key["kid"])
+		}
+	})
+
+	t.Run("should require keys in production", func(t *testing.T) {
+		os.Setenv("APP_ENV", "production")
+		defer os.Unsetenv("APP_ENV")
+
+		assert.NotNil(helper.InitJwt())
+	})
+
+	t.Run("should reject weak keys", func(t *testing.T) {
+		weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+		_, err := helper.NewSigningKey("weak", weak, time.Time{})
+
+		assert.NotNil(err)
+	})
+}
+
+func TestOAuthProvider(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(helper.InitJwt())
+
+	oauth := controllers.NewOAuthController()
+
+	t.Run("should publish discovery document", func(t *testing.T) {
+		os.Setenv("OIDC_ISSUER", "https://books.example.com/")
+		defer os.Unsetenv("OIDC_ISSUER")
+
+		res := httptest.NewRecorder()
+
+		oauth.Discovery(res, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+
+		doc := map[string]interface{}{}
+
+		assert.Nil(json.Unmarshal(res.Body.Bytes(), &doc))
+		assert.Equal("https://books.example.com", doc["issuer"])
+		assert.Equal("https://books.example.com/oauth/token", doc["token_endpoint"])
+		assert.Equal([]interface{}{"S256"}, doc["code_challenge_methods_supported"])
+		assert.Equal([]interface{}{"EdDSA"}, doc["id_token_signing_alg_values_supported"])
+	})
+
+	tc := []struct {
+		name   string
+		claims map[string]interface{}
+		status int
+		want   string
+	}{
+		{name: "should reject session access token", claims: map[string]interface{}{"id": 1, "fid": "family"}, status: http.StatusUnauthorized, want: "invalid_token"},
+		{name: "should require openid scope", claims: map[string]interface{}{"sub": "1", "client_id": "shop", "scope": "email"}, status: http.StatusForbidden, want: "insufficient_scope"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			_, token, _ := helper.EncodeJwt(c.claims)
+
+			req := httptest.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			res := httptest.NewRecorder()
+
+			helper.Verifier(http.HandlerFunc(oauth.UserInfo)).ServeHTTP(res, req)
+
+			assert.Equal(c.status, res.Code)
+			assert.Contains(res.Header().Get("WWW-Authenticate"), c.want)
+		})
+	}
+
+	t.Run("should reject unsupported grant type", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader("grant_type=password&username=john&password=secret"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		res := httptest.NewRecorder()
+
+		oauth.Token(res, req)
+
+		assert.Equal(http.StatusBadRequest, res.Code)
+		assert.Contains(res.Body.String(), "unsupported_grant_type")
+		assert.Equal("no-store", res.Header().Get("Cache-Control"))
+	})
+}
+
+func TestProblemDetails(t *testing.T) {
+	assert := assert.New(t)
+
+	upstream := helper.ResponseModel{}
+
+	assert.Nil(json.Unmarshal([]byte(`{"code":422,"success":false,"data":[{"field":"email","code":"invalid_email","message":"email must be a valid email address"}],"message":"Error Rendering Response: email must be a valid email address"}`), &upstream))
+
+	t.Run("should list failing fields of upstream", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/register", nil)
+		res := httptest.NewRecorder()
+
+		render.Render(res, req, helper.Response(&upstream))
+
+		problem := helper.ProblemModel{}
+
+		assert.Equal(422, res.Code)
+		assert.Equal(helper.ProblemContentType, res.Header().Get("Content-Type"))
+		assert.Nil(json.Unmarshal(res.Body.Bytes(), &problem))
+		assert.Equal("urn:book-store:problem:validation", problem.Type)
+		assert.Equal("email must be a valid email address", problem.Detail)
+		assert.Equal("/auth/register", problem.Instance)
+		assert.Equal([]helper.FieldError{{Field: "email", Code: helper.CodeInvalidEmail, Message: "email must be a valid email address"}}, problem.Errors)
+	})
+
+	t.Run("should render envelope for application/json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/register", nil)
+		req.Header.Set("Accept", "application/json")
+		res := httptest.NewRecorder()
+
+		render.Render(res, req, helper.Response(&upstream))
+
+		assert.Equal(422, res.Code)
+		assert.Contains(res.Body.String(), `"success":false`)
+	})
+
+	t.Run("should describe upstream failure", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/book", nil)
+		res := httptest.NewRecorder()
+
+		render.Render(res, req, helper.ResponseError(helper.ErrorStatus(helper.ErrUpstream), helper.ErrUpstream))
+
+		assert.Equal(http.StatusBadGateway, res.Code)
+		assert.Contains(res.Body.String(), `"type":"urn:book-store:problem:upstream-failure"`)
+	})
+}
+
+func TestUpstream(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("UPSTREAM_RETRY_BACKOFF", "1ms")
+	os.Setenv("UPSTREAM_BREAKER_FAILURES", "3")
+	os.Setenv("UPSTREAM_BREAKER_COOLDOWN", "50ms")
+	defer os.Unsetenv("UPSTREAM_RETRY_BACKOFF")
+	defer os.Unsetenv("UPSTREAM_BREAKER_FAILURES")
+	defer os.Unsetenv("UPSTREAM_BREAKER_COOLDOWN")
+
+	// responds 503 to the first requests, then 200
+	flaky := func(failures int) (*httptest.Server, *int) {
+		calls := 0
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+
+			if calls <= failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			fmt.Fprint(w, `{"code":200,"success":true,"data":"ok","message":""}`)
+		}))
+
+		return server, &calls
+	}
+
+	t.Run("should retry idempotent request", func(t *testing.T) {
+		server, calls := flaky(2)
+		defer server.Close()
+
+		upstream := helper.NewUpstream("book", strings.TrimPrefix(server.URL, "http://"))
+
+		res, err := upstream.Request().Get(upstream.Url("/book"))
+
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.Response().StatusCode)
+		assert.Equal(3, *calls)
+	})
+
+	t.Run("should not retry post", func(t *testing.T) {
+		server, calls := flaky(1)
+		defer server.Close()
+
+		upstream := helper.NewUpstream("order", strings.TrimPrefix(server.URL, "http://"))
+
+		res, err := upstream.Request().Post(upstream.Url("/order"))
+
+		assert.Nil(err)
+		assert.Equal(http.StatusServiceUnavailable, res.Response().StatusCode)
+		assert.Equal(1, *calls)
+	})
+
+	t.Run("should time out by route", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer server.Close()
+
+		proxy := controllers.NewProxyController()
+		slow := proxy.NewUpstream("slow", strings.TrimPrefix(server.URL, "http://"))
+
+		req := httptest.NewRequest(http.MethodGet, "/book", nil)
+		res := httptest.NewRecorder()
+
+		proxy.Forward(controllers.Route{Path: "/book/*", Upstream: slow, Target: "/book", Public: true, Timeout: 20 * time.Millisecond}).ServeHTTP(res, req)
+
+		assert.Equal(http.StatusGatewayTimeout, res.Code)
+		assert.Contains(res.Body.String(), "slow service timed out")
+	})
+
+	t.Run("should open circuit and probe after cooldown", func(t *testing.T) {
+		server, calls := flaky(3)
+		defer server.Close()
+
+		proxy := controllers.NewProxyController()
+		upstream := proxy.NewUpstream("auth", strings.TrimPrefix(server.URL, "http://"))
+		upstream.Retries = 0
+		route := controllers.Route{Path: "/auth/*", Upstream: upstream, Target: "/", Public: true}
+
+		serve := func() *httptest.ResponseRecorder {
+			res := httptest.NewRecorder()
+			proxy.Forward(route).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/auth", nil))
+
+			return res
+		}
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(http.StatusServiceUnavailable, serve().Code)
+		}
+
+		res := serve()
+
+		assert.Equal(http.StatusServiceUnavailable, res.Code)
+		assert.Equal("1", res.Header().Get("Retry-After"))
+		assert.Contains(res.Body.String(), "auth service unavailable")
+		assert.Equal(3, *calls, "open circuit should not reach upstream")
+
+		time.Sleep(60 * time.Millisecond)
+
+		assert.Equal(http.StatusOK, serve().Code, "probe should close circuit")
+		assert.Equal(http.StatusOK, serve().Code)
+		assert.Equal(5, *calls)
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(helper.InitJwt())
+
+	t.Run("should parse limits", func(t *testing.T) {
+		limit, err := helper.ParseRateLimit("100/1m")
+
+		assert.Nil(err)
+		assert.Equal(helper.RateLimit{Requests: 100, Period: time.Minute}, limit)
+		assert.Equal("100;w=60", limit.Policy())
+
+		for _, invalid := range []string{"", "100", "0/1m", "x/1m", "100/x"} {
+			_, err := helper.ParseRateLimit(invalid)
+			assert.NotNil(err, invalid)
+		}
+	})
+
+	t.Run("should configure from environment", func(t *testing.T) {
+		os.Setenv("RATE_LIMIT_ROLES", "admin=600/1m")
+		os.Setenv("RATE_LIMIT_ROUTES", "POST /auth/token=5/1m, /auth/register=10/1h")
+		defer os.Unsetenv("RATE_LIMIT_ROLES")
+		defer os.Unsetenv("RATE_LIMIT_ROUTES")
+
+		limiter, err := helper.NewRateLimiter()
+
+		assert.Nil(err)
+		assert.Equal(helper.RateLimit{Requests: 120, Period: time.Minute}, limiter.Default)
+		assert.Equal(helper.RateLimit{Requests: 600, Period: time.Minute}, limiter.Roles["admin"])
+		assert.Equal([]helper.RouteLimit{
+			{Method: "POST", Path: "/auth/token", Limit: helper.RateLimit{Requests: 5, Period: time.Minute}},
+			{Path: "/auth/register", Limit: helper.RateLimit{Requests: 10, Period: time.Hour}},
+		}, limiter.Routes)
+	})
+
+	// auth service accepting keys ending with "_secret"
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		if r.URL.Path != "/token/key" || !strings.HasSuffix(payload["key"], "_secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"code":401,"success":false,"data":null,"message":"invalid api key"}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"code":200,"success":true,"data":{"userId":1,"scopes":["book:read"]},"message":""}`)
+	}))
+	defer auth.Close()
+
+	authService := helper.GetUpstream("auth")
+	authURL := authService.URL
+	authService.URL, _ = url.Parse(auth.URL)
+	defer func() { authService.URL = authURL }()
+
+	mr := miniredis.RunT(t)
+
+	stores := map[string]helper.RateLimitStore{
+		"memory": helper.NewMemoryRateLimitStore(),
+		"redis":  helper.NewRedisRateLimitStore(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}
+
+	for name, store := range stores {
+		limiter := &helper.RateLimiter{
+			Store:   store,
+			Default: helper.RateLimit{Requests: 3, Period: time.Hour},
+			Roles:   map[string]helper.RateLimit{"admin": {Requests: 10, Period: time.Hour}},
+			Routes:  []helper.RouteLimit{{Method: http.MethodPost, Path: "/auth/token", Limit: helper.RateLimit{Requests: 1, Period: time.Hour}}},
+		}
+
+		handler := helper.Verifier(limiter.Handler(helper.Authenticator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))))
+
+		serve := func(method string, path string, ip string, header map[string]string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, nil)
+			req.RemoteAddr = ip + ":1234"
+
+			for k, v := range header {
+				req.Header.Set(k, v)
+			}
+
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			return res
+		}
+
+		t.Run(name+": should limit by ip", func(t *testing.T) {
+			for i := 2; i >= 0; i-- {
+				res := serve(http.MethodGet, "/book", "10.0.0.1", nil)
+
+				assert.Equal(http.StatusUnauthorized, res.Code, "anonymous requests count too")
+				assert.Equal("3", res.Header().Get("RateLimit-Limit"))
+				assert.Equal(strconv.Itoa(i), res.Header().Get("RateLimit-Remaining"))
+				assert.Equal("3;w=3600", res.Header().Get("RateLimit-Policy"))
+			}
+
+			res := serve(http.MethodGet, "/book", "10.0.0.1", nil)
+
+			assert.Equal(http.StatusTooManyRequests, res.Code)
+			assert.Equal("1200", res.Header().Get("Retry-After"))
+			assert.Equal("3600", res.Header().Get("RateLimit-Reset"))
+			assert.Contains(res.Body.String(), "urn:book-store:problem:rate-limited")
+		})
+
+		t.Run(name+": should limit by api key once verified", func(t *testing.T) {
+			header := map[string]string{helper.APIKeyHeader: "bk_" + name + "_secret"}
+
+			res := serve(http.MethodGet, "/book", "10.0.0.2", header)
+
+			assert.Equal(http.StatusNoContent, res.Code)
+			assert.Equal("2", res.Header().Get("RateLimit-Remaining"), "unverified key should be limited by ip")
+
+			for i := 2; i >= 0; i-- {
+				res := serve(http.MethodGet, "/book", "10.0.0.2", header)
+
+				assert.Equal(http.StatusNoContent, res.Code)
+				assert.Equal(strconv.Itoa(i), res.Header().Get("RateLimit-Remaining"))
+			}
+
+			assert.Equal(http.StatusTooManyRequests, serve(http.MethodGet, "/book", "10.0.0.2", header).Code)
+		})
+
+		t.Run(name+": should limit made up api keys by ip", func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				header := map[string]string{helper.APIKeyHeader: "bk_" + strconv.Itoa(i) + "_made-up"}
+
+				assert.Equal(http.StatusUnauthorized, serve(http.MethodGet, "/book", "10.0.0.3", header).Code)
+			}
+
+			header := map[string]string{helper.APIKeyHeader: "bk_3_made-up"}
+
+			assert.Equal(http.StatusTooManyRequests, serve(http.MethodGet, "/book", "10.0.0.3", header).Code)
+		})
+
+		t.Run(name+": should limit by user and role", func(t *testing.T) {
+			_, customer, _ := helper.EncodeJwt(map[string]interface{}{"id": name + "-1", "roles": []string{"customer"}})
+			_, admin, _ := helper.EncodeJwt(map[string]interface{}{"id": name + "-2", "roles": []string{"customer", "admin"}})
+
+			res := serve(http.MethodGet, "/book", "10.0.0.4", map[string]string{"Authorization": "Bearer " + customer})
+
+			assert.Equal("3", res.Header().Get("RateLimit-Limit"))
+			assert.Equal("2", res.Header().Get("RateLimit-Remaining"))
+
+			res = serve(http.MethodGet, "/book", "10.0.0.4", map[string]string{"Authorization": "Bearer " + admin})
+
+			assert.Equal("10", res.Header().Get("RateLimit-Limit"), "most generous role should apply")
+			assert.Equal("9", res.Header().Get("RateLimit-Remaining"))
+		})
+
+		t.Run(name+": should limit by route and give back tokens of rejected requests", func(t *testing.T) {
+			header := map[string]string{helper.APIKeyHeader: "bk_route" + name + "_secret"}
+
+			// verifies the key
+			assert.Equal(http.StatusNoContent, serve(http.MethodGet, "/book", "10.0.0.5", header).Code)
+
+			res := serve(http.MethodPost, "/auth/token", "10.0.0.5", header)
+
+			assert.Equal(http.StatusNoContent, res.Code)
+			assert.Equal("1", res.Header().Get("RateLimit-Limit"), "tightest bucket should be described")
+			assert.Equal("0", res.Header().Get("RateLimit-Remaining"))
+
+			assert.Equal(http.StatusTooManyRequests, serve(http.MethodPost, "/auth/token", "10.0.0.5", header).Code)
+
+			res = serve(http.MethodGet, "/auth/token", "10.0.0.5", header)
+
+			assert.Equal(http.StatusNoContent, res.Code, "other methods should not be limited by route")
+			assert.Equal("1", res.Header().Get("RateLimit-Remaining"), "token of rejected request should be given back")
+		})
+	}
+
+	t.Run("should let requests through when store fails", func(t *testing.T) {
+		broken := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+		limiter := &helper.RateLimiter{Store: helper.NewRedisRateLimitStore(broken), Default: helper.RateLimit{Requests: 1, Period: time.Hour}}
+
+		res := httptest.NewRecorder()
+
+		limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/book", nil))
+
+		assert.Equal(http.StatusNoContent, res.Code)
+	})
+}
+
+func TestAuthToken(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(helper.InitJwt())
+
+	os.Setenv("SERVICE_SECRET", "test secret")
+	helper.InitIdentity("api")
+
+	// auth service answering the token request with data
+	token := `{"userId":1,"familyId":"family","refreshToken":"refresh","expiresAt":"2050-01-01T00:00:00Z"}`
+
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := helper.Identity{}
+		parts := strings.Split(r.Header.Get(helper.IdentityHeader), ".")
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[len(parts)/2])
+		json.Unmarshal(payload, &identity)
+
+		// calls the gateway makes itself are marked internal
+		if !identity.Internal {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"code":403,"success":false,"data":null,"message":"permission denied"}`)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/login":
+			fmt.Fprint(w, `{"code":200,"success":true,"data":{"id":1,"emailVerifiedAt":"2021-01-01T00:00:00Z"},"message":""}`)
+		case "/token":
+			fmt.Fprintf(w, `{"code":200,"success":true,"data":%s,"message":""}`, token)
+		default:
+			fmt.Fprint(w, `{"code":200,"success":true,"data":1,"message":""}`)
+		}
+	}))
+	defer auth.Close()
+
+	authService := helper.GetUpstream("auth")
+	authURL := authService.URL
+	authService.URL, _ = url.Parse(auth.URL)
+	defer func() { authService.URL = authURL }()
+
+	ctr := controllers.NewAuthController()
+
+	login := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/token", strings.NewReader(`{"email":"user@mail.com","password":"secret"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		res := httptest.NewRecorder()
+
+		ctr.Login(res, req)
+
+		return res
+	}
+
+	t.Run("should sign access token", func(t *testing.T) {
+		res := login()
+
+		assert.Equal(http.StatusOK, res.Code)
+		assert.Contains(res.Body.String(), `"refreshToken":"refresh"`)
+	})
+
+	t.Run("should reject malformed token of auth service", func(t *testing.T) {
+		for _, malformed := range []string{`"token"`, `{"userId":1,"expiresAt":"2050-01-01T00:00:00Z"}`, `{"userId":1,"refreshToken":"refresh"}`} {
+			token = malformed
+
+			assert.Equal(http.StatusBadGateway, login().Code, malformed)
+		}
+	})
+
+	t.Run("should reject logout without session", func(t *testing.T) {
+		_, accessToken, _ := helper.EncodeJwt(map[string]interface{}{"id": 1, "email": "user@mail.com"})
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		res := httptest.NewRecorder()
+
+		helper.Verifier(http.HandlerFunc(ctr.Logout)).ServeHTTP(res, req)
+
+		assert.Equal(http.StatusBadRequest, res.Code)
+		assert.Contains(res.Body.String(), "no session to log out")
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":200,"success":true,"data":"ok","message":""}`)
+	}))
+	defer server.Close()
+
+	upstream := helper.NewUpstream("metrics", strings.TrimPrefix(server.URL, "http://"))
+
+	r := chi.NewRouter()
+	r.Use(helper.Metrics)
+	r.Get("/book/{id}", func(w http.ResponseWriter, r *http.Request) {
+		upstream.Request().Get(upstream.Url("/book/"+chi.URLParam(r, "id")), r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, id := range []string{"1", "2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/book/"+id, nil))
+	}
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, helper.MetricsPath, nil))
+
+	body := res.Body.String()
+
+	assert.Equal(http.StatusOK, res.Code)
+	assert.Contains(body, `http_requests_total{method="GET",route="/book/{id}",status="204"} 2`)
+	assert.Contains(body, `http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(body, `upstream_requests_total{method="GET",status="200",upstream="metrics"} 2`)
+	assert.Contains(body, `upstream_circuit_state{upstream="metrics"} 0`)
+	assert.NotContains(body, `route="/metrics"`)
+}
+
+func TestTracing(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, err := helper.InitTracing("gateway")
+	assert.Nil(err)
+
+	traceparent := ""
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		fmt.Fprint(w, `{"code":200,"success":true,"data":"ok","message":""}`)
+	}))
+	defer server.Close()
+
+	proxy := controllers.NewProxyController()
+	book := proxy.NewUpstream("book", strings.TrimPrefix(server.URL, "http://"))
+
+	r := chi.NewRouter()
+	r.Use(helper.Tracing)
+	r.Handle("/book/{id}", proxy.Forward(controllers.Route{Path: "/book/{id}", Upstream: book, Target: "/book", Public: true}))
+
+	// caller's trace is continued
+	callerTrace := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	req := httptest.NewRequest(http.MethodGet, "/book/1", nil)
+	req.Header.Set("traceparent", "00-"+callerTrace+"-00f067aa0ba902b7-01")
+	res := httptest.NewRecorder()
+
+	r.ServeHTTP(res, req)
+
+	assert.Equal(http.StatusOK, res.Code)
+
+	spans := recorder.Ended()
+
+	if assert.Len(spans, 2) {
+		outgoing, incoming := spans[0], spans[1]
+
+		assert.Equal("GET book", outgoing.Name())
+		assert.Equal(trace.SpanKindClient, outgoing.SpanKind())
+		assert.Equal("GET /book/{id}", incoming.Name())
+		assert.Equal(trace.SpanKindServer, incoming.SpanKind())
+
+		assert.Equal(callerTrace, incoming.SpanContext().TraceID().String())
+		assert.Equal(incoming.SpanContext().SpanID(), outgoing.Parent().SpanID())
+		assert.Equal("00-"+callerTrace+"-"+outgoing.SpanContext().SpanID().String()+"-01", traceparent)
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"net/http"
+)
+
+// Authorization request answered by the user on the consent screen
+type OAuthConsentModel struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+// Error of the OAuth protocol, as returned by the auth service and sent to clients
+type OAuthErrorModel struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Token response of OAuth 2.0, field names follow the spec rather than the gateway
+type OAuthTokenModel struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+type OAuthGrantModel struct {
+	UserID   int                    `json:"userId"`
+	ClientID string                 `json:"clientId"`
+	Scopes   []string               `json:"scopes"`
+	Nonce    string                 `json:"nonce"`
+	AuthTime int64                  `json:"authTime"`
+	Claims   map[string]interface{} `json:"claims"`
+}
+
+func (c *OAuthConsentModel) Bind(r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+type RefreshTokenModel struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type TokenModel struct {
+	AccessToken      string     `json:"accessToken"`
+	TokenType        string     `json:"tokenType"`
+	ExpiresIn        int64      `json:"expiresIn"`
+	RefreshToken     string     `json:"refreshToken"`
+	RefreshExpiresAt *time.Time `json:"refreshExpiresAt"`
+	RecoveryCodes    []string   `json:"recoveryCodes,omitempty"`
+}
+
+type ChallengeModel struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+func (t *RefreshTokenModel) Bind(r *http.Request) error {
+	return nil
+}
+
+func (c *ChallengeModel) Bind(r *http.Request) error {
+	return nil
+}
+
+func (t *TokenModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
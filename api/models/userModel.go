@@ -3,14 +3,16 @@ package models
 import (
 	"net/http"
 	"time"
+
+	"github.com/ariefsn/book-store/api/helper"
 )
 
 type UserModel struct {
 	ID        int        `json:"id" gorm:"autoIncrement"`
 	FirstName string     `json:"firstName" gorm:"column:firstName"`
 	LastName  string     `json:"lastName" gorm:"column:lastName"`
-	Email     string     `json:"email" gorm:"unique"`
-	Password  string     `json:"password"`
+	Email     string     `json:"email" gorm:"unique" validate:"required,max=100,email"`
+	Password  string     `json:"password" validate:"required"`
 	Birth     *time.Time `json:"birth"`
 	Address   string     `json:"address"`
 	IsAdmin   bool       `json:"isAdmin" gorm:"column:isAdmin"`
@@ -22,8 +24,9 @@ type UserListModel struct {
 	Users []UserModel `json:"list"`
 }
 
+// Only used for login, so only credentials are checked
 func (u *UserModel) Bind(r *http.Request) error {
-	return nil
+	return helper.Validate(u).Err()
 }
 
 func (u *UserModel) Render(w http.ResponseWriter, r *http.Request) error {
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/ariefsn/book-store/api/controllers"
+)
+
+// Gateway routes forwarded to upstream services.
+// New endpoints under a prefixed path only need to be added on the service itself.
+func routeTable(proxy *controllers.ProxyController) []controllers.Route {
+	auth := proxy.NewUpstream("auth", os.Getenv("URL_AUTH"))
+	book := proxy.NewUpstream("book", os.Getenv("URL_BOOK"))
+	order := proxy.NewUpstream("order", os.Getenv("URL_ORDER"))
+
+	// service info is answered right away, a slow one is as good as unavailable
+	info := 2 * time.Second
+
+	return []controllers.Route{
+		{Path: "/auth/", Upstream: auth, Target: "/", Public: true, Timeout: info},
+		{Path: "/auth/me/*", Upstream: auth, Target: "/user/me"},
+		{
+			Path:        "/auth/*",
+			Upstream:    auth,
+			Target:      "/",
+			PublicPaths: []string{"/register", "/password/*", "/verify/*"},
+			// login and tokens go through the gateway's own handlers, oauth is served at /oauth
+			Internal: []string{"/login", "/token/*", "/oauth/*", "/metrics"},
+		},
+
+		{Path: "/book/hi", Upstream: book, Target: "/", Public: true, Timeout: info},
+		{Path: "/book/*", Upstream: book, Target: "/book"},
+
+		{Path: "/cart/*", Upstream: order, Target: "/cart"},
+		{Path: "/order/*", Upstream: order, Target: "/order"},
+	}
+}
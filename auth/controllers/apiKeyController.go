@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"github.com/ariefsn/book-store/auth/services"
+	"github.com/go-chi/render"
+)
+
+type APIKeyController struct {
+	BaseController
+}
+
+func NewAPIKeyController() *APIKeyController {
+	c := new(APIKeyController)
+
+	return c
+}
+
+func apiKeyErrorCode(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAPIKeyScope):
+		return 422
+	case errors.Is(err, services.ErrAPIKeyInvalid):
+		return http.StatusUnauthorized
+	}
+
+	return helper.ErrorStatus(err)
+}
+
+// Handler for get API keys of active user
+func (c *APIKeyController) All(w http.ResponseWriter, r *http.Request) {
+	keys, err := services.GetAPIKeys(c.Identity(r).UserID())
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(keys))
+}
+
+// Handler for create API key of active user, the key is only shown in this response
+func (c *APIKeyController) Create(w http.ResponseWriter, r *http.Request) {
+	payload := models.APIKeyRequestModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	key, err := services.CreateAPIKey(c.Identity(r).UserID(), &payload)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(apiKeyErrorCode(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(key))
+}
+
+// Handler for change name and scopes of API key
+func (c *APIKeyController) Update(w http.ResponseWriter, r *http.Request) {
+	payload := models.APIKeyUpdateModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	key, err := services.UpdateAPIKey(c.Identity(r).UserID(), id, &payload)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(apiKeyErrorCode(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(key))
+}
+
+// Handler for revoke API key
+func (c *APIKeyController) Revoke(w http.ResponseWriter, r *http.Request) {
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	if err := services.RevokeAPIKey(c.Identity(r).UserID(), id); err != nil {
+		render.Render(w, r, helper.ResponseError(apiKeyErrorCode(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess("API key has been revoked"))
+}
+
+// Handler for check API key sent to the gateway and get identity of its user
+func (c *APIKeyController) Verify(w http.ResponseWriter, r *http.Request) {
+	payload := models.APIKeyVerifyModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	identity, err := services.VerifyAPIKey(payload.Key, clientIP(r))
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(apiKeyErrorCode(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(identity))
+}
@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"errors"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/ariefsn/book-store/auth/helper"
 	"github.com/ariefsn/book-store/auth/models"
@@ -21,6 +23,21 @@ func NewAuthController() *AuthController {
 	return c
 }
 
+// Status code of error of creating or updating user
+func userErrorCode(err error) int {
+	var policy *helper.PasswordPolicyError
+
+	if errors.As(err, &policy) || errors.Is(err, services.ErrPasswordEmpty) {
+		return 422
+	}
+
+	if errors.Is(err, services.ErrCurrentPassword) {
+		return http.StatusForbidden
+	}
+
+	return helper.ErrorStatus(err)
+}
+
 func (c *AuthController) Hi(w http.ResponseWriter, r *http.Request) {
 	render.Render(w, r, helper.ResponseSuccess("Hi, Welcome to Auth Service Version 1"))
 }
@@ -39,14 +56,22 @@ func (c *AuthController) Register(w http.ResponseWriter, r *http.Request) {
 	checkUser, _ := services.GetUserByEmail(payload.Email)
 
 	if payload.Email == checkUser.Email {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, errors.New("email registered")))
+		render.Render(w, r, helper.ResponseError(http.StatusConflict, errors.New("email registered")))
 		return
 	}
 
-	id, err := services.CreateUser(&payload)
+	// email is verified through the link only
+	payload.EmailVerifiedAt = nil
+
+	id, err := services.RegisterUser(&payload)
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(userErrorCode(err), err))
+		return
+	}
+
+	if err := services.SendVerification(&payload); err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
@@ -55,8 +80,6 @@ func (c *AuthController) Register(w http.ResponseWriter, r *http.Request) {
 
 // Handler for create new user
 func (c *AuthController) Create(w http.ResponseWriter, r *http.Request) {
-	_, email := c.ParseClaims(r)
-
 	payload := models.UserModel{}
 
 	if err := render.Bind(r, &payload); err != nil {
@@ -65,44 +88,76 @@ func (c *AuthController) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := services.GetUserByEmail(email)
+	// check email
+	checkUser, _ := services.GetUserByEmail(payload.Email)
+
+	if payload.Email == checkUser.Email {
+		render.Render(w, r, helper.ResponseError(http.StatusConflict, errors.New("email registered")))
+		return
+	}
+
+	// users created by admin don't need to verify their email
+	now := time.Now()
+	payload.EmailVerifiedAt = &now
+
+	id, err := services.CreateUser(&payload)
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(userErrorCode(err), err))
 		return
 	}
 
-	if !user.IsAdmin {
-		render.Render(w, r, helper.ResponseError(http.StatusUnauthorized, errors.New("role not authorized")))
+	render.Render(w, r, helper.ResponseSuccess(id))
+}
+
+// Handler for verify email with the link token
+func (c *AuthController) Verify(w http.ResponseWriter, r *http.Request) {
+	err := services.VerifyEmail(r.URL.Query().Get("token"))
+
+	if errors.Is(err, services.ErrVerificationInvalid) {
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, err))
 		return
 	}
 
-	// check email
-	checkUser, _ := services.GetUserByEmail(payload.Email)
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
 
-	if payload.Email == checkUser.Email {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, errors.New("email registered")))
+	render.Render(w, r, helper.ResponseSuccess("Email has been verified"))
+}
+
+// Handler for send verification link again
+func (c *AuthController) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	payload := models.VerificationResendModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
 		return
 	}
 
-	id, err := services.CreateUser(&payload)
+	retryAfter, err := services.ResendVerification(payload.Email)
+
+	if errors.Is(err, services.ErrVerificationThrottled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		render.Render(w, r, helper.ResponseError(http.StatusTooManyRequests, err))
+		return
+	}
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
-	render.Render(w, r, helper.ResponseSuccess(id))
+	render.Render(w, r, helper.ResponseSuccess("If the email is registered and not verified yet, a verification link has been sent"))
 }
 
 // Handler for check profile
 func (c *AuthController) Profile(w http.ResponseWriter, r *http.Request) {
-	_, email := c.ParseClaims(r)
-
-	user, err := services.GetUserByEmail(email)
+	user, err := services.GetUserByEmail(c.Identity(r).Email)
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 
 		return
 	}
@@ -112,9 +167,7 @@ func (c *AuthController) Profile(w http.ResponseWriter, r *http.Request) {
 
 // Handler for update active user
 func (c *AuthController) UpdateMe(w http.ResponseWriter, r *http.Request) {
-	sId, _ := c.ParseClaims(r)
-
-	payload := models.UserModel{}
+	payload := models.UserUpdateModel{}
 
 	if err := render.Bind(r, &payload); err != nil {
 		render.Render(w, r, helper.ResponseError(422, err))
@@ -122,16 +175,19 @@ func (c *AuthController) UpdateMe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, _ := strconv.Atoi(sId)
+	row, err := services.UpdateOwnUser(c.Identity(r).UserID(), &payload)
 
-	row := services.UpdateUser(id, &payload)
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(userErrorCode(err), err))
+		return
+	}
 
 	render.Render(w, r, helper.ResponseSuccess(row))
 }
 
 // Handler for update user
 func (c *AuthController) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	payload := models.UserModel{}
+	payload := models.UserUpdateModel{}
 
 	if err := render.Bind(r, &payload); err != nil {
 		render.Render(w, r, helper.ResponseError(422, err))
@@ -146,7 +202,12 @@ func (c *AuthController) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	row := services.UpdateUser(id, &payload)
+	row, err := services.UpdateUser(id, &payload)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(userErrorCode(err), err))
+		return
+	}
 
 	render.Render(w, r, helper.ResponseSuccess(row))
 }
@@ -160,10 +221,10 @@ func (c *AuthController) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := services.GetUserByID(id)
+	user, err := services.GetUserByID(r.Context(), id)
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
@@ -174,24 +235,24 @@ func (c *AuthController) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 // Handler for get all users
 func (c *AuthController) All(w http.ResponseWriter, r *http.Request) {
-	_, email := c.ParseClaims(r)
-
-	admin, err := services.GetUserByEmail(email)
+	filter, err := models.NewUserFilterModel(r)
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, err))
 		return
 	}
 
-	if !admin.IsAdmin {
-		render.Render(w, r, helper.ResponseError(http.StatusUnauthorized, errors.New("unauthorized")))
+	page, err := helper.ParsePagination(r, models.UserSortable...)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, err))
 		return
 	}
 
-	users, err := services.GetUsers()
+	users, err := services.GetUsers(filter, page)
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
@@ -207,10 +268,10 @@ func (c *AuthController) Find(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := services.GetUserByID(id)
+	user, err := services.GetUserByID(r.Context(), id)
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
@@ -1,46 +1,74 @@
 package controllers
 
 import (
-	"encoding/base64"
 	"errors"
 	"net/http"
 	"strconv"
-	"strings"
 
+	"github.com/ariefsn/book-store/auth/helper"
 	"github.com/ariefsn/book-store/auth/services"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
 )
 
 type BaseController struct{}
 
-func (b *BaseController) ParseClaims(r *http.Request) (string, string) {
-	claims := r.Header.Get("Claims")
-
-	decoded, _ := base64.StdEncoding.DecodeString(claims)
-
-	split := strings.Split(string(decoded), "*")
-
-	return split[0], split[1]
+// Identity of active user, verified by helper.IdentityVerifier
+func (b *BaseController) Identity(r *http.Request) *helper.Identity {
+	return helper.IdentityFromContext(r.Context())
 }
 
 func (b *BaseController) ValidateId(r *http.Request) (int, int, error) {
-	_, email := b.ParseClaims(r)
-
 	if chi.URLParam(r, "id") == "" {
 		return 0, http.StatusInternalServerError, errors.New("id can't be empty")
 	}
 
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 
-	admin, err := services.GetUserByEmail(email)
+	return id, http.StatusOK, nil
+}
+
+// Middleware for allow only user which has the permission through its roles
+func (b *BaseController) Permission(permission string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity := b.Identity(r)
+
+			permissions, err := services.GetUserPermissions(r.Context(), identity.UserID())
 
-	if err != nil {
-		return 0, http.StatusInternalServerError, err
+			if err != nil {
+				render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+				return
+			}
+
+			if !contains(identity.Limit(permissions), permission) {
+				render.Render(w, r, helper.ResponseError(http.StatusForbidden, errors.New("permission denied")))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
 	}
+}
+
+// Middleware for reject requests authenticated with an API key, e.g. for changing credentials
+func (b *BaseController) Interactive(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if b.Identity(r).Scoped() {
+			render.Render(w, r, helper.ResponseError(http.StatusForbidden, errors.New("not allowed with api key")))
+			return
+		}
 
-	if !admin.IsAdmin {
-		return 0, http.StatusUnauthorized, errors.New("unauthorized")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
 	}
 
-	return id, http.StatusOK, nil
+	return false
 }
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"github.com/ariefsn/book-store/auth/services"
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+type LoginController struct {
+	BaseController
+}
+
+func NewLoginController() *LoginController {
+	c := new(LoginController)
+
+	return c
+}
+
+// Address of client, the gateway passes it as X-Forwarded-For value.
+// The last value is taken, it's the one added by the gateway, values before it could be sent by anyone.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+
+		return strings.TrimSpace(hops[len(hops)-1])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// Handler for check email and password of user, attempts are recorded and repeated failures lock the account
+func (c *LoginController) Login(w http.ResponseWriter, r *http.Request) {
+	payload := models.LoginRequestModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	user, wait, err := services.Login(payload.Email, payload.Password, clientIP(r), r.UserAgent())
+
+	if errors.Is(err, services.ErrLoginLocked) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		render.Render(w, r, helper.ResponseError(http.StatusTooManyRequests, err))
+		return
+	}
+
+	if errors.Is(err, services.ErrLoginFailed) {
+		render.Render(w, r, helper.ResponseError(http.StatusUnauthorized, err))
+		return
+	}
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(user))
+}
+
+// Handler for lift lockout of user
+func (c *LoginController) Unlock(w http.ResponseWriter, r *http.Request) {
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	err = services.UnlockUser(id, clientIP(r), r.UserAgent())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		render.Render(w, r, helper.ResponseError(http.StatusNotFound, errors.New("user not found")))
+		return
+	}
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess("User has been unlocked"))
+}
+
+// Handler for get login attempts of user, newest first unless sorted otherwise
+func (c *LoginController) Attempts(w http.ResponseWriter, r *http.Request) {
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	page, err := helper.ParsePagination(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, err))
+		return
+	}
+
+	if r.URL.Query().Get("sort") == "" {
+		page.Desc = true
+	}
+
+	attempts, err := services.GetLoginAttempts(id, page)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		render.Render(w, r, helper.ResponseError(http.StatusNotFound, errors.New("user not found")))
+		return
+	}
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(attempts))
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"github.com/ariefsn/book-store/auth/services"
+	"github.com/go-chi/render"
+)
+
+type OAuthController struct {
+	BaseController
+}
+
+func NewOAuthController() *OAuthController {
+	c := new(OAuthController)
+
+	return c
+}
+
+// Render error with its OAuth code in data, so the gateway can pass it to the client
+func renderOAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	oauthErr := &services.OAuthError{}
+
+	if !errors.As(err, &oauthErr) {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	code := http.StatusBadRequest
+
+	if oauthErr.Code == services.OAuthInvalidClient {
+		code = http.StatusUnauthorized
+	}
+
+	res := helper.ResponseError(code, err).(*helper.ResponseModel)
+	res.Data = oauthErr
+
+	render.Render(w, r, res)
+}
+
+// Handler for get registered clients
+func (c *OAuthController) Clients(w http.ResponseWriter, r *http.Request) {
+	clients, err := services.GetOAuthClients()
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(clients))
+}
+
+// Handler for register client, the secret is only shown in this response
+func (c *OAuthController) CreateClient(w http.ResponseWriter, r *http.Request) {
+	payload := models.OAuthClientRequestModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	client, err := services.CreateOAuthClient(&payload)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(client))
+}
+
+// Handler for change registered client
+func (c *OAuthController) UpdateClient(w http.ResponseWriter, r *http.Request) {
+	payload := models.OAuthClientRequestModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	client, err := services.UpdateOAuthClient(id, &payload)
+
+	if err != nil {
+		renderOAuthError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(client))
+}
+
+// Handler for delete client, its users have to sign in again
+func (c *OAuthController) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	if err := services.DeleteOAuthClient(id); err != nil {
+		renderOAuthError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess("Client has been deleted"))
+}
+
+// Handler for validate authorization request before the user is asked for consent
+func (c *OAuthController) Request(w http.ResponseWriter, r *http.Request) {
+	payload := models.OAuthAuthorizeModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	info, err := services.CheckAuthorizeRequest(&payload, c.Identity(r).UserID())
+
+	if err != nil {
+		renderOAuthError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(info))
+}
+
+// Handler for approve or deny authorization request of active user
+func (c *OAuthController) Consent(w http.ResponseWriter, r *http.Request) {
+	payload := models.OAuthAuthorizeModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	code, err := services.AuthorizeOAuth(c.Identity(r).UserID(), &payload)
+
+	if err != nil {
+		renderOAuthError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(map[string]string{"code": code}))
+}
+
+// Handler for exchange authorization code, tokens are signed by the gateway
+func (c *OAuthController) Code(w http.ResponseWriter, r *http.Request) {
+	payload := models.OAuthCodeRequestModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	grant, err := services.ExchangeOAuthCode(&payload)
+
+	if err != nil {
+		renderOAuthError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(grant))
+}
+
+// Handler for claims of the user an access token was issued for
+func (c *OAuthController) UserInfo(w http.ResponseWriter, r *http.Request) {
+	payload := models.OAuthUserInfoRequestModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	claims, err := services.GetUserInfo(c.Identity(r).UserID(), payload.Scopes)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(http.StatusUnauthorized, err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(claims))
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"github.com/ariefsn/book-store/auth/services"
+	"github.com/go-chi/render"
+)
+
+type PasswordController struct {
+	BaseController
+}
+
+func NewPasswordController() *PasswordController {
+	c := new(PasswordController)
+
+	return c
+}
+
+// Handler for request password reset link by email
+func (c *PasswordController) Forgot(w http.ResponseWriter, r *http.Request) {
+	payload := models.PasswordForgotModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	if err := services.ForgotPassword(payload.Email); err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess("If the email is registered, a reset link has been sent"))
+}
+
+// Handler for set new password with reset token
+func (c *PasswordController) Reset(w http.ResponseWriter, r *http.Request) {
+	payload := models.PasswordResetRequestModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	err := services.ResetPassword(payload.Token, payload.Password)
+
+	if errors.Is(err, services.ErrResetTokenInvalid) {
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, err))
+		return
+	}
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(userErrorCode(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess("Password has been reset"))
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"github.com/ariefsn/book-store/auth/services"
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+type RoleController struct {
+	BaseController
+}
+
+func NewRoleController() *RoleController {
+	c := new(RoleController)
+
+	return c
+}
+
+// Handler for get all roles
+func (c *RoleController) All(w http.ResponseWriter, r *http.Request) {
+	roles, err := services.GetRoles()
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(roles))
+}
+
+// Handler for update settings of role
+func (c *RoleController) Update(w http.ResponseWriter, r *http.Request) {
+	payload := models.RoleSettingModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	role, err := services.UpdateRoleSetting(id, payload)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		render.Render(w, r, helper.ResponseError(http.StatusNotFound, errors.New("role not found")))
+		return
+	}
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(role))
+}
+
+// Handler for get roles of user
+func (c *RoleController) UserRoles(w http.ResponseWriter, r *http.Request) {
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	roles, err := services.GetUserRoles(id)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(roles))
+}
+
+// Handler for replace roles of user
+func (c *RoleController) UpdateUserRoles(w http.ResponseWriter, r *http.Request) {
+	payload := models.UserRoleRequestModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	if _, err := services.GetUserByID(r.Context(), id); err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	err = services.SetUserRoles(id, payload.Roles)
+
+	if errors.Is(err, services.ErrUnknownRole) {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	roles, _ := services.GetUserRoles(id)
+
+	render.Render(w, r, helper.ResponseSuccess(roles))
+}
+
+// Handler for get permissions of active user
+func (c *RoleController) MyPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := services.GetUserPermissions(r.Context(), c.Identity(r).UserID())
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(c.Identity(r).Limit(permissions)))
+}
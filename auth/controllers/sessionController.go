@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/services"
+	"github.com/go-chi/render"
+)
+
+type SessionController struct {
+	BaseController
+}
+
+func NewSessionController() *SessionController {
+	c := new(SessionController)
+
+	return c
+}
+
+// Handler for get active sessions of active user, the one of the request is marked as current
+func (c *SessionController) Mine(w http.ResponseWriter, r *http.Request) {
+	identity := c.Identity(r)
+
+	sessions, err := services.GetSessions(identity.UserID(), identity.Session)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(sessions))
+}
+
+// Handler for terminate session of active user, e.g. of a lost device
+func (c *SessionController) Terminate(w http.ResponseWriter, r *http.Request) {
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	if err := services.TerminateSession(c.Identity(r).UserID(), id); err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess("Session has been terminated"))
+}
+
+// Handler for terminate every session of user
+func (c *SessionController) TerminateAll(w http.ResponseWriter, r *http.Request) {
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	count, err := services.TerminateUserSessions(id)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(count))
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"github.com/ariefsn/book-store/auth/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type TokenController struct {
+	BaseController
+}
+
+func NewTokenController() *TokenController {
+	c := new(TokenController)
+
+	return c
+}
+
+// Handler for issue refresh token after user logged in
+func (c *TokenController) Create(w http.ResponseWriter, r *http.Request) {
+	payload := models.TokenRequestModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	user, err := services.GetUserByID(r.Context(), payload.UserID)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	challenge, err := services.CreateLoginChallenge(user)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	// password isn't enough, token is issued once the challenge is completed
+	if challenge != nil {
+		render.Render(w, r, helper.ResponseSuccess(challenge))
+		return
+	}
+
+	token, err := services.StartSession(user.ID, clientIP(r), r.UserAgent())
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	token.Email = user.Email
+	token.Roles, err = services.GetUserRoles(user.ID)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(token))
+}
+
+// Handler for complete login challenge with two-factor code and issue refresh token
+func (c *TokenController) CompleteChallenge(w http.ResponseWriter, r *http.Request) {
+	payload := models.ChallengeRequestModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	token, err := services.CompleteLoginChallenge(payload.Challenge, payload.Code, clientIP(r), r.UserAgent())
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(twoFactorErrorCode(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(token))
+}
+
+// Handler for rotate refresh token
+func (c *TokenController) Refresh(w http.ResponseWriter, r *http.Request) {
+	payload := models.TokenRequestModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	if payload.RefreshToken == "" {
+		render.Render(w, r, helper.ResponseError(422, errors.New("refresh token can't be empty")))
+		return
+	}
+
+	token, err := services.RotateRefreshToken(payload.RefreshToken, clientIP(r))
+
+	if err != nil {
+		code := helper.ErrorStatus(err)
+
+		if errors.Is(err, services.ErrTokenInvalid) || errors.Is(err, services.ErrTokenExpired) || errors.Is(err, services.ErrTokenReused) {
+			code = http.StatusUnauthorized
+		}
+
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(token))
+}
+
+// Handler for check token family still active, called by the gateway for every request so it also records activity of the session
+func (c *TokenController) FindFamily(w http.ResponseWriter, r *http.Request) {
+	familyId := chi.URLParam(r, "id")
+
+	active, err := services.IsTokenFamilyActive(familyId)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	if !active {
+		render.Render(w, r, helper.ResponseError(http.StatusUnauthorized, errors.New("token revoked")))
+		return
+	}
+
+	services.TouchSession(familyId, clientIP(r))
+
+	render.Render(w, r, helper.ResponseSuccess(active))
+}
+
+// Handler for revoke token family, used on logout
+func (c *TokenController) RevokeFamily(w http.ResponseWriter, r *http.Request) {
+	row, err := services.RevokeTokenFamily(chi.URLParam(r, "id"))
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(row))
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"github.com/ariefsn/book-store/auth/services"
+	"github.com/go-chi/render"
+)
+
+type TwoFactorController struct {
+	BaseController
+}
+
+func NewTwoFactorController() *TwoFactorController {
+	c := new(TwoFactorController)
+
+	return c
+}
+
+// Status code for two-factor errors
+func twoFactorErrorCode(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTwoFactorCodeInvalid), errors.Is(err, services.ErrChallengeInvalid):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrTwoFactorRequired):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrTwoFactorEnabled), errors.Is(err, services.ErrTwoFactorNotEnabled), errors.Is(err, services.ErrTwoFactorNotEnrolled):
+		return http.StatusConflict
+	}
+
+	return helper.ErrorStatus(err)
+}
+
+// Handler for start two-factor enrollment of active user
+func (c *TwoFactorController) Enroll(w http.ResponseWriter, r *http.Request) {
+	enroll, err := services.EnrollTwoFactor(c.Identity(r).UserID())
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(twoFactorErrorCode(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(enroll))
+}
+
+// Handler for enable two-factor authentication with a code from the authenticator app
+func (c *TwoFactorController) Confirm(w http.ResponseWriter, r *http.Request) {
+	payload := models.TwoFactorCodeModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	codes, err := services.ConfirmTwoFactor(c.Identity(r).UserID(), payload.Code)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(twoFactorErrorCode(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(codes))
+}
+
+// Handler for disable two-factor authentication of active user
+func (c *TwoFactorController) Disable(w http.ResponseWriter, r *http.Request) {
+	payload := models.TwoFactorCodeModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	if err := services.DisableTwoFactor(c.Identity(r).UserID(), payload.Code); err != nil {
+		render.Render(w, r, helper.ResponseError(twoFactorErrorCode(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess("Two-factor authentication disabled"))
+}
+
+// Handler for replace recovery codes of active user
+func (c *TwoFactorController) RecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	payload := models.TwoFactorCodeModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	codes, err := services.RegenerateRecoveryCodes(c.Identity(r).UserID(), payload.Code)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(twoFactorErrorCode(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(codes))
+}
@@ -1,15 +1,165 @@
 package helper
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	keyLen  uint32
+}
+
+func envUint(key string, fallback uint64, bits int) uint64 {
+	if n, err := strconv.ParseUint(os.Getenv(key), 10, bits); err == nil && n > 0 {
+		return n
+	}
+
+	return fallback
+}
+
+// Algorithm of new hashes, configurable through PASSWORD_HASH (bcrypt or argon2id)
+func passwordHash() string {
+	if os.Getenv("PASSWORD_HASH") == HashArgon2id {
+		return HashArgon2id
+	}
+
+	return HashBcrypt
+}
+
+// Cost of new bcrypt hashes, configurable through PASSWORD_BCRYPT_COST
+func bcryptCost() int {
+	cost := int(envUint("PASSWORD_BCRYPT_COST", 12, 8))
+
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return 12
+	}
+
+	return cost
+}
+
+// Parameters of new argon2id hashes, configurable through PASSWORD_ARGON2_MEMORY (KiB), PASSWORD_ARGON2_TIME and PASSWORD_ARGON2_THREADS
+func argon2Config() argon2Params {
+	return argon2Params{
+		memory:  uint32(envUint("PASSWORD_ARGON2_MEMORY", 64*1024, 32)),
+		time:    uint32(envUint("PASSWORD_ARGON2_TIME", 3, 32)),
+		threads: uint8(envUint("PASSWORD_ARGON2_THREADS", 2, 8)),
+		keyLen:  32,
+	}
+}
+
+// Hash password with the configured algorithm
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	if passwordHash() == HashArgon2id {
+		return hashArgon2id(password, argon2Config())
+	}
+
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost())
 	return string(bytes), err
 }
 
+// Check password against a bcrypt or argon2id hash
 func CheckPasswordHash(password, hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		p, salt, key, err := decodeArgon2id(hash)
+
+		if err != nil {
+			return false
+		}
+
+		other := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// Check hash was made with another algorithm or other parameters than the configured ones
+func PasswordNeedsRehash(hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		if passwordHash() != HashArgon2id {
+			return true
+		}
+
+		p, _, _, err := decodeArgon2id(hash)
+
+		return err != nil || p != argon2Config()
+	}
+
+	if passwordHash() != HashBcrypt {
+		return true
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+
+	return err != nil || cost != bcryptCost()
+}
+
+// Hash in PHC string format, $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func hashArgon2id(password string, p argon2Params) (string, error) {
+	salt := make([]byte, 16)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func decodeArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	p := argon2Params{}
+	parts := strings.Split(hash, "$")
+
+	if len(parts) != 6 {
+		return p, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2id version")
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+
+	if err != nil {
+		return p, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+
+	if err != nil {
+		return p, nil, nil, err
+	}
+
+	p.keyLen = uint32(len(key))
+
+	return p, salt, key, nil
+}
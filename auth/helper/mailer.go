@@ -0,0 +1,121 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Delivers mails, configured through MAIL_DRIVER
+type Mailer interface {
+	Send(mail Mail) error
+}
+
+// Mailer from environment.
+// MAIL_DRIVER "smtp" sends through SMTP_HOST and SMTP_PORT, authenticated when SMTP_USERNAME is set.
+// Any other driver writes mails to MAIL_LOG_PATH, or stdout when empty, for development.
+func NewMailer() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+
+	if from == "" {
+		from = "no-reply@bukuku.local"
+	}
+
+	if os.Getenv("MAIL_DRIVER") == "smtp" {
+		host := os.Getenv("SMTP_HOST")
+
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for smtp mail driver")
+		}
+
+		port := os.Getenv("SMTP_PORT")
+
+		if port == "" {
+			port = "25"
+		}
+
+		return &SMTPMailer{
+			Addr:     net.JoinHostPort(host, port),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	}
+
+	if path := os.Getenv("MAIL_LOG_PATH"); path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return NewLogMailer(file, from), nil
+	}
+
+	return NewLogMailer(os.Stdout, from), nil
+}
+
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(mail Mail) error {
+	var auth smtp.Auth
+
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	return smtp.SendMail(m.Addr, auth, m.From, []string{mail.To}, buildMail(m.From, mail))
+}
+
+// Writes mails to w instead of sending them
+type LogMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewLogMailer(w io.Writer, from string) *LogMailer {
+	return &LogMailer{w: w, from: from}
+}
+
+func (m *LogMailer) Send(mail Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "%s\r\n\r\n", buildMail(m.from, mail))
+
+	return err
+}
+
+// Line breaks are removed from header values, so they can't inject headers
+func buildMail(from string, mail Mail) []byte {
+	clean := strings.NewReplacer("\r", "", "\n", "")
+
+	header := []string{
+		"From: " + clean.Replace(from),
+		"To: " + clean.Replace(mail.To),
+		"Subject: " + clean.Replace(mail.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+
+	return []byte(strings.Join(header, "\r\n") + "\r\n\r\n" + mail.Body)
+}
@@ -0,0 +1,142 @@
+package helper
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+// Path metrics are served at, answered before identity or token are checked
+const MetricsPath = "/metrics"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Requests handled, by method, route pattern and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time to handle requests, by method, route pattern and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	dbDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Time of database queries made through gorm, by operation and table.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+)
+
+const dbStartKey = "metrics:start"
+
+// Middleware for serve metrics at MetricsPath and count requests with their duration.
+// Requests are labeled by route pattern, e.g. "/book/{id}", so the number of series stays small.
+func Metrics(next http.Handler) http.Handler {
+	metrics := promhttp.Handler()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == MetricsPath {
+			metrics.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := prometheus.Labels{"method": r.Method, "route": routePattern(r), "status": strconv.Itoa(status)}
+
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Observe duration of queries made through db, trace them and collect stats of its connection pool as database name
+func InstrumentDB(db *gorm.DB, name string) error {
+	sqlDb, err := db.DB()
+
+	if err != nil {
+		return err
+	}
+
+	if err := prometheus.Register(collectors.NewDBStatsCollector(sqlDb, name)); err != nil {
+		already := prometheus.AlreadyRegisteredError{}
+
+		if !errors.As(err, &already) {
+			return err
+		}
+	}
+
+	start := func(tx *gorm.DB) {
+		tx.InstanceSet(dbStartKey, time.Now())
+		startQuerySpan(tx)
+	}
+
+	observe := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			started, ok := tx.InstanceGet(dbStartKey)
+
+			if !ok {
+				return
+			}
+
+			table := tx.Statement.Table
+
+			if table == "" {
+				table = "unknown"
+			}
+
+			dbDuration.WithLabelValues(operation, table).Observe(time.Since(started.(time.Time)).Seconds())
+			endQuerySpan(tx, operation, table)
+		}
+	}
+
+	cb := db.Callback()
+
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("metrics:before_create", start),
+		cb.Create().After("gorm:create").Register("metrics:after_create", observe("create")),
+		cb.Query().Before("gorm:query").Register("metrics:before_query", start),
+		cb.Query().After("gorm:query").Register("metrics:after_query", observe("query")),
+		cb.Update().Before("gorm:update").Register("metrics:before_update", start),
+		cb.Update().After("gorm:update").Register("metrics:after_update", observe("update")),
+		cb.Delete().Before("gorm:delete").Register("metrics:before_delete", start),
+		cb.Delete().After("gorm:delete").Register("metrics:after_delete", observe("delete")),
+		cb.Row().Before("gorm:row").Register("metrics:before_row", start),
+		cb.Row().After("gorm:row").Register("metrics:after_row", observe("row")),
+		cb.Raw().Before("gorm:raw").Register("metrics:before_raw", start),
+		cb.Raw().After("gorm:raw").Register("metrics:after_raw", observe("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Route pattern request matched, "unmatched" when none did
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+
+	return "unmatched"
+}
@@ -0,0 +1,157 @@
+package helper
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rules a new password must follow
+type PasswordPolicy struct {
+	MinLength  int
+	MaxLength  int
+	MinClasses int
+	// SHA-1 of breached passwords, upper case hex
+	breached map[string]struct{}
+}
+
+// Rules a password breaks
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password " + strings.Join(e.Violations, ", ")
+}
+
+// Policy configured through PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH, PASSWORD_MIN_CLASSES and PASSWORD_BREACHED_LIST
+func NewPasswordPolicy() (*PasswordPolicy, error) {
+	p := &PasswordPolicy{
+		MinLength:  int(envUint("PASSWORD_MIN_LENGTH", 8, 16)),
+		MaxLength:  int(envUint("PASSWORD_MAX_LENGTH", 72, 16)),
+		MinClasses: int(envUint("PASSWORD_MIN_CLASSES", 3, 8)),
+	}
+
+	if path := os.Getenv("PASSWORD_BREACHED_LIST"); path != "" {
+		file, err := os.Open(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer file.Close()
+
+		if err := p.LoadBreached(file); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Load breached passwords, one per line either as plain text or as SHA-1 hex with optional ":count" suffix
+func (p *PasswordPolicy) LoadBreached(r io.Reader) error {
+	if p.breached == nil {
+		p.breached = map[string]struct{}{}
+	}
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if hash := strings.SplitN(line, ":", 2)[0]; isSHA1Hex(hash) {
+			p.breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+
+		p.breached[sha1Hex(line)] = struct{}{}
+	}
+
+	return scanner.Err()
+}
+
+// Check password follows every rule, all broken rules are reported
+func (p *PasswordPolicy) Validate(password string) error {
+	violations := []string{}
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+
+	// bcrypt ignores everything after 72 bytes
+	if len(password) > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes", p.MaxLength))
+	}
+
+	if classes := passwordClasses(password); classes < p.MinClasses {
+		violations = append(violations, fmt.Sprintf("must contain %d of lower case, upper case, digit and symbol", p.MinClasses))
+	}
+
+	if p.Breached(password) {
+		violations = append(violations, "appears in a list of breached passwords")
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// Check password is in the breached list, case insensitive
+func (p *PasswordPolicy) Breached(password string) bool {
+	if _, ok := p.breached[sha1Hex(password)]; ok {
+		return true
+	}
+
+	_, ok := p.breached[sha1Hex(strings.ToLower(password))]
+
+	return ok
+}
+
+func passwordClasses(password string) int {
+	var lower, upper, digit, symbol int
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+
+	_, err := hex.DecodeString(s)
+
+	return err == nil
+}
@@ -0,0 +1,135 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// Errors of the taxonomy, wrapped errors get the matching status, e.g. fmt.Errorf("%w: book 1", helper.ErrNotFound)
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrConflict  = errors.New("conflict")
+	ErrForbidden = errors.New("forbidden")
+	ErrUpstream  = errors.New("upstream failure")
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem details of a failed request as in RFC 7807, failing fields of a validation error are listed in errors
+type ProblemModel struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// Failed responses are rendered as problem details, see respond
+func init() {
+	render.Respond = respond
+}
+
+// Status of error by the taxonomy, 500 for any other error
+func ErrorStatus(err error) int {
+	validation := &ValidationError{}
+
+	switch {
+	case errors.As(err, &validation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrNotFound) || errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict) || isDuplicateKey(err):
+		return http.StatusConflict
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUpstream):
+		return http.StatusBadGateway
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Check error is a violated unique key of MySQL
+func isDuplicateKey(err error) bool {
+	mysqlErr := &mysql.MySQLError{}
+
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// Type of problem by status, statuses outside the taxonomy are described by their title only
+func problemType(status int) string {
+	switch status {
+	case http.StatusUnprocessableEntity:
+		return "urn:book-store:problem:validation"
+	case http.StatusNotFound:
+		return "urn:book-store:problem:not-found"
+	case http.StatusConflict:
+		return "urn:book-store:problem:conflict"
+	case http.StatusForbidden:
+		return "urn:book-store:problem:forbidden"
+	case http.StatusTooManyRequests:
+		return "urn:book-store:problem:rate-limited"
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return "urn:book-store:problem:upstream-failure"
+	}
+
+	return "about:blank"
+}
+
+// Problem details of failed response for request
+func (e *ResponseModel) Problem(r *http.Request) *ProblemModel {
+	detail := e.Message
+
+	if e.Error != nil {
+		detail = e.Error.Error()
+	}
+
+	problem := &ProblemModel{
+		Type:     problemType(e.HTTPStatusCode),
+		Title:    http.StatusText(e.HTTPStatusCode),
+		Status:   e.HTTPStatusCode,
+		Detail:   detail,
+		Instance: r.URL.RequestURI(),
+	}
+
+	if fields, ok := e.Data.([]FieldError); ok {
+		problem.Errors = fields
+	}
+
+	return problem
+}
+
+// Check client asks for the ResponseModel envelope, i.e. accepts application/json but not problem details
+func wantsEnvelope(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, ProblemContentType)
+}
+
+// Responder rendering failed responses as application/problem+json, unless the client asks for the envelope
+func respond(w http.ResponseWriter, r *http.Request, v interface{}) {
+	res, ok := v.(*ResponseModel)
+
+	if !ok || res.Success || wantsEnvelope(r) {
+		render.DefaultResponder(w, r, v)
+		return
+	}
+
+	body, err := json.Marshal(res.Problem(r))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(res.HTTPStatusCode)
+	w.Write(body)
+}
@@ -1,6 +1,7 @@
 package helper
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -42,6 +43,10 @@ func statusText(code int) string {
 		statusText = "Not Found"
 	case 405:
 		statusText = "Method Not Allowed"
+	case 409:
+		statusText = "Conflict"
+	case 429:
+		statusText = "Too Many Requests"
 	case 500:
 		statusText = "Internal Server Error"
 	case 502:
@@ -64,7 +69,7 @@ func ResponseSuccess(data interface{}) render.Renderer {
 }
 
 func ResponseError(errCode int, err error) render.Renderer {
-	return &ResponseModel{
+	res := &ResponseModel{
 		Success:        false,
 		Data:           nil,
 		HTTPStatusCode: errCode,
@@ -72,4 +77,13 @@ func ResponseError(errCode int, err error) render.Renderer {
 		Error:          err,
 		Message:        err.Error(),
 	}
+
+	// failing fields are listed, so clients can show them next to their inputs
+	validation := &ValidationError{}
+
+	if errors.As(err, &validation) {
+		res.Data = validation.Fields
+	}
+
+	return res
 }
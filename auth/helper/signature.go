@@ -0,0 +1,42 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+var ErrSignatureInvalid = errors.New("invalid signature")
+
+// Sign payload with SERVICE_SECRET, purpose keeps tokens of different features from being used for each other
+func SignPayload(purpose string, payload []byte) string {
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + signPayload(purpose, encoded)
+}
+
+// Verify token made by SignPayload for the same purpose and return its payload
+func VerifyPayload(purpose string, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(signPayload(purpose, parts[0]))) {
+		return nil, ErrSignatureInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+	if err != nil {
+		return nil, ErrSignatureInvalid
+	}
+
+	return payload, nil
+}
+
+func signPayload(purpose string, encoded string) string {
+	mac := hmac.New(sha256.New, identitySecret)
+	mac.Write([]byte(purpose + ":" + encoded))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,180 @@
+package helper
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Codes of failing fields, stable for clients to match on
+const (
+	CodeRequired     = "required"
+	CodeTooLong      = "too_long"
+	CodeOutOfRange   = "out_of_range"
+	CodeInvalidEmail = "invalid_email"
+	CodeInFuture     = "in_future"
+	CodeInvalid      = "invalid"
+)
+
+// Failing field of a request, named as in its JSON body
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Every failing field of a request, rendered as data of a 422 response
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := []string{}
+
+	for _, f := range e.Fields {
+		messages = append(messages, f.Message)
+	}
+
+	return strings.Join(messages, ", ")
+}
+
+// Add failing field
+func (e *ValidationError) Add(field string, code string, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Error when a field failed, otherwise nil
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// Check fields of struct by their validate tag, e.g. `validate:"required,max=100,email"`.
+// Rules other than required skip zero values, so optional fields are only checked when set.
+//
+//	required   value isn't zero, strings aren't blank
+//	notblank   strings which are set aren't blank, e.g. for fields of partial updates
+//	max=n      strings have at most n characters, numbers are at most n
+//	min=n      numbers are at least n
+//	email      string is a plain email address
+//	notfuture  time isn't in the future, for numbers the year isn't after the current one
+func Validate(v interface{}) *ValidationError {
+	result := &ValidationError{}
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		tag := rt.Field(i).Tag.Get("validate")
+
+		if tag == "" {
+			continue
+		}
+
+		name := strings.Split(rt.Field(i).Tag.Get("json"), ",")[0]
+
+		if name == "" {
+			name = rt.Field(i).Name
+		}
+
+		value := rv.Field(i)
+
+		for _, rule := range strings.Split(tag, ",") {
+			if code, message := checkRule(rule, value); code != "" {
+				result.Add(name, code, name+" "+message)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+func checkRule(rule string, value reflect.Value) (string, string) {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			if rule == "required" {
+				return CodeRequired, "is required"
+			}
+
+			return "", ""
+		}
+
+		value = value.Elem()
+	}
+
+	name, arg := rule, ""
+
+	if i := strings.Index(rule, "="); i >= 0 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+
+	if name == "required" {
+		if value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "" || value.IsZero() {
+			return CodeRequired, "is required"
+		}
+
+		return "", ""
+	}
+
+	if name == "notblank" {
+		if value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "" {
+			return CodeRequired, "can't be blank"
+		}
+
+		return "", ""
+	}
+
+	if value.IsZero() {
+		return "", ""
+	}
+
+	n, _ := strconv.ParseInt(arg, 10, 64)
+
+	switch name {
+	case "max":
+		if value.Kind() == reflect.String && int64(utf8.RuneCountInString(value.String())) > n {
+			return CodeTooLong, fmt.Sprintf("must be at most %d characters", n)
+		}
+
+		if isInt(value) && value.Int() > n {
+			return CodeOutOfRange, fmt.Sprintf("must be at most %d", n)
+		}
+	case "min":
+		if isInt(value) && value.Int() < n {
+			return CodeOutOfRange, fmt.Sprintf("must be at least %d", n)
+		}
+	case "email":
+		address, err := mail.ParseAddress(value.String())
+
+		if err != nil || address.Address != value.String() {
+			return CodeInvalidEmail, "must be a valid email address"
+		}
+	case "notfuture":
+		if t, ok := value.Interface().(time.Time); ok && t.After(time.Now()) {
+			return CodeInFuture, "can't be in the future"
+		}
+
+		if isInt(value) && value.Int() > int64(time.Now().Year()) {
+			return CodeInFuture, "can't be after the current year"
+		}
+	}
+
+	return "", ""
+}
+
+func isInt(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+
+	return false
+}
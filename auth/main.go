@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -9,6 +10,8 @@ import (
 
 	"github.com/ariefsn/book-store/auth/controllers"
 	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/migrations"
+	"github.com/ariefsn/book-store/auth/models"
 	"github.com/ariefsn/book-store/auth/services"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -23,6 +26,38 @@ func main() {
 		return
 	}
 
+	migrator := helper.NewMigrator(db, "auth", migrations.Migrations)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := helper.RunMigrate(migrator, os.Args[2:]); err != nil {
+			fmt.Println("[Error]", err.Error())
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if helper.AutoMigrate() {
+		if _, err := migrator.Up(); err != nil {
+			fmt.Println("[Error]", err.Error())
+			return
+		}
+	}
+
+	if err := helper.InitIdentity("auth"); err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
+
+	shutdown, err := helper.InitTracing("auth")
+
+	if err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
+
+	defer shutdown(context.Background())
+
 	err = services.InitService(db)
 
 	if err != nil {
@@ -34,19 +69,94 @@ func main() {
 
 	r.Use(middleware.Logger)
 	r.Use(middleware.Heartbeat("/ping"))
+	r.Use(helper.Metrics)
+	r.Use(helper.Tracing)
+	r.Use(helper.IdentityVerifier)
 
 	ctr := controllers.NewAuthController()
+	token := controllers.NewTokenController()
+	role := controllers.NewRoleController()
+	password := controllers.NewPasswordController()
+	twoFactor := controllers.NewTwoFactorController()
+	login := controllers.NewLoginController()
+	apiKey := controllers.NewAPIKeyController()
+	oauth := controllers.NewOAuthController()
+	session := controllers.NewSessionController()
 
 	r.Get("/", ctr.Hi)
 	r.Post("/register", ctr.Register)
+	r.With(helper.InternalOnly).Post("/login", login.Login)
+	r.Get("/verify", ctr.Verify)
+	r.Post("/verify/resend", ctr.ResendVerification)
+
+	r.Route("/password", func(r chi.Router) {
+		r.Post("/forgot", password.Forgot)
+		r.Post("/reset", password.Reset)
+	})
+
+	r.Route("/token", func(r chi.Router) {
+		r.Use(helper.InternalOnly)
+
+		r.Post("/", token.Create)
+		r.Post("/2fa", token.CompleteChallenge)
+		r.Post("/refresh", token.Refresh)
+		r.Get("/family/{id}", token.FindFamily)
+		r.Delete("/family/{id}", token.RevokeFamily)
+		r.Post("/key", apiKey.Verify)
+	})
 
 	r.Route("/user", func(r chi.Router) {
-		r.Get("/", ctr.All)
-		r.Get("/{id}", ctr.Find)
-		r.Put("/{id}", ctr.UpdateUser)
-		r.Delete("/{id}", ctr.DeleteUser)
+		r.With(ctr.Permission(models.PermissionUserRead)).Get("/", ctr.All)
+		r.With(ctr.Permission(models.PermissionUserWrite)).Post("/", ctr.Create)
+		r.With(ctr.Permission(models.PermissionUserRead)).Get("/{id}", ctr.Find)
+		r.With(ctr.Permission(models.PermissionUserWrite)).Put("/{id}", ctr.UpdateUser)
+		r.With(ctr.Permission(models.PermissionUserWrite)).Delete("/{id}", ctr.DeleteUser)
+		r.With(ctr.Permission(models.PermissionRoleManage)).Get("/{id}/role", role.UserRoles)
+		r.With(ctr.Permission(models.PermissionRoleManage)).Put("/{id}/role", role.UpdateUserRoles)
+		r.With(ctr.Permission(models.PermissionUserWrite)).Post("/{id}/unlock", login.Unlock)
+		r.With(ctr.Permission(models.PermissionUserRead)).Get("/{id}/login-attempt", login.Attempts)
+		r.With(ctr.Permission(models.PermissionUserWrite)).Delete("/{id}/sessions", session.TerminateAll)
 		r.Get("/me", ctr.Profile)
-		r.Put("/me", ctr.UpdateMe)
+		r.With(ctr.Interactive).Put("/me", ctr.UpdateMe)
+		r.Get("/me/permission", role.MyPermissions)
+		r.With(ctr.Interactive).Post("/me/2fa", twoFactor.Enroll)
+		r.With(ctr.Interactive).Delete("/me/2fa", twoFactor.Disable)
+		r.With(ctr.Interactive).Post("/me/2fa/confirm", twoFactor.Confirm)
+		r.With(ctr.Interactive).Post("/me/2fa/recovery", twoFactor.RecoveryCodes)
+		r.With(ctr.Interactive).Get("/me/sessions", session.Mine)
+		r.With(ctr.Interactive).Delete("/me/sessions/{id}", session.Terminate)
+	})
+
+	r.Route("/keys", func(r chi.Router) {
+		r.Use(ctr.Interactive)
+
+		r.Get("/", apiKey.All)
+		r.Post("/", apiKey.Create)
+		r.Put("/{id}", apiKey.Update)
+		r.Delete("/{id}", apiKey.Revoke)
+	})
+
+	r.Route("/client", func(r chi.Router) {
+		r.Use(ctr.Permission(models.PermissionClientManage))
+
+		r.Get("/", oauth.Clients)
+		r.Post("/", oauth.CreateClient)
+		r.Put("/{id}", oauth.UpdateClient)
+		r.Delete("/{id}", oauth.DeleteClient)
+	})
+
+	r.Route("/oauth", func(r chi.Router) {
+		r.Use(helper.InternalOnly)
+
+		r.Post("/request", oauth.Request)
+		r.With(ctr.Interactive).Post("/consent", oauth.Consent)
+		r.Post("/code", oauth.Code)
+		r.Post("/userinfo", oauth.UserInfo)
+	})
+
+	r.Route("/role", func(r chi.Router) {
+		r.With(ctr.Permission(models.PermissionRoleManage)).Get("/", role.All)
+		r.With(ctr.Permission(models.PermissionRoleManage)).Put("/{id}", role.Update)
 	})
 
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
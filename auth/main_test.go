@@ -1,28 +1,27 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ariefsn/book-store/auth/controllers"
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/migrations"
+	"github.com/ariefsn/book-store/auth/models"
+	"github.com/ariefsn/book-store/auth/services"
 	"github.com/stretchr/testify/assert"
 )
 
-func buildClaims() string {
-	id := 0
-	email := "administrator@mail.com"
-
-	claimsString := fmt.Sprintf("%v*%s", id, email)
-	data := []byte(claimsString)
-	encoded := base64.StdEncoding.EncodeToString([]byte(data))
-
-	return encoded
-}
-
 type TestCase struct {
 	name       string
 	method     string
@@ -43,36 +42,595 @@ func TestRootHandler(t *testing.T) {
 			statusCode: 200,
 			message:    "response body not contains api info",
 		},
-		{
-			name:   "should have claims",
-			method: http.MethodGet,
-			headers: map[string]string{
-				"Claims": buildClaims(),
-			},
-			want:       buildClaims(),
-			statusCode: 200,
-			message:    "claims should be exists",
-		},
 	}
 
-	for i, c := range tc {
+	for _, c := range tc {
 		t.Run(c.name, func(t *testing.T) {
 			req := httptest.NewRequest(c.method, "/", nil)
 			res := httptest.NewRecorder()
 
-			if c.headers["Claims"] != "" {
-				req.Header.Add("Claims", c.headers["Claims"])
-			}
-
 			controllers.NewAuthController().Hi(res, req)
 
 			assert.Equal(c.statusCode, res.Result().StatusCode, fmt.Sprintf("status code should be %v instead of %v", c.statusCode, res.Result().StatusCode))
 
-			if i == 0 {
-				assert.Equal(c.want, strings.TrimSpace(res.Body.String()), c.message)
+			assert.Equal(c.want, strings.TrimSpace(res.Body.String()), c.message)
+		})
+	}
+}
+
+func TestIdentityVerifier(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("SERVICE_SECRET", "test secret")
+
+	helper.InitIdentity("auth")
+
+	valid, _ := helper.SignIdentity(helper.Identity{Subject: "1", Email: "administrator@mail.com", Roles: []string{"admin"}}, "auth")
+	otherAudience, _ := helper.SignIdentity(helper.Identity{Subject: "1"}, "book")
+	parts := strings.Split(valid, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"aud":"auth","sub":"2","exp":9999999999}`)) + "." + parts[2]
+
+	tc := []struct {
+		name       string
+		identity   string
+		statusCode int
+		message    string
+	}{
+		{name: "should accept valid identity", identity: valid, statusCode: http.StatusOK},
+		{name: "should reject missing identity", identity: "", statusCode: http.StatusUnauthorized, message: helper.ErrIdentityMissing.Error()},
+		{name: "should reject malformed identity", identity: "MSphZG1pbmlzdHJhdG9yQG1haWwuY29t", statusCode: http.StatusUnauthorized, message: helper.ErrIdentityInvalid.Error()},
+		{name: "should reject tampered identity", identity: tampered, statusCode: http.StatusUnauthorized, message: helper.ErrIdentityInvalid.Error()},
+		{name: "should reject identity for other service", identity: otherAudience, statusCode: http.StatusUnauthorized, message: helper.ErrIdentityInvalid.Error()},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			res := httptest.NewRecorder()
+
+			if c.identity != "" {
+				req.Header.Set(helper.IdentityHeader, c.identity)
+			}
+
+			var identity *helper.Identity
+
+			helper.IdentityVerifier(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				identity = helper.IdentityFromContext(r.Context())
+			})).ServeHTTP(res, req)
+
+			assert.Equal(c.statusCode, res.Result().StatusCode)
+
+			if c.statusCode == http.StatusOK {
+				assert.Equal(1, identity.UserID())
+				assert.Equal([]string{"admin"}, identity.Roles)
 			} else {
-				assert.Equal(c.want, req.Header.Get("Claims"), c.message)
+				assert.Nil(identity, "next handler shouldn't be called")
+				assert.Contains(res.Body.String(), c.message)
+			}
+		})
+	}
+
+	t.Run("should allow only internal calls of the gateway", func(t *testing.T) {
+		internal, _ := helper.SignIdentity(helper.Identity{Internal: true}, "auth")
+		proxied, _ := helper.SignIdentity(helper.Identity{Subject: "1"}, "auth")
+
+		handler := helper.IdentityVerifier(helper.InternalOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+		for identity, statusCode := range map[string]int{internal: http.StatusOK, proxied: http.StatusForbidden} {
+			req := httptest.NewRequest(http.MethodPost, "/token", nil)
+			req.Header.Set(helper.IdentityHeader, identity)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			assert.Equal(statusCode, res.Result().StatusCode)
+		}
+	})
+
+	t.Run("should reject expired identity", func(t *testing.T) {
+		os.Setenv("SERVICE_TOKEN_TTL", "1ns")
+		defer os.Unsetenv("SERVICE_TOKEN_TTL")
+
+		helper.InitIdentity("auth")
+
+		expired, _ := helper.SignIdentity(helper.Identity{Subject: "1"}, "auth")
+
+		_, err := helper.VerifyIdentity(expired)
+
+		assert.Equal(helper.ErrIdentityExpired, err)
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	assert := assert.New(t)
+
+	versions := map[int]bool{}
+
+	for _, m := range migrations.Migrations {
+		assert.False(versions[m.Version], fmt.Sprintf("version %d should be unique", m.Version))
+		assert.NotEmpty(m.Name, fmt.Sprintf("migration %d should have name", m.Version))
+		assert.NotEmpty(m.Up, fmt.Sprintf("migration %d should have up", m.Version))
+		assert.NotEmpty(m.Down, fmt.Sprintf("migration %d should have down", m.Version))
+
+		versions[m.Version] = true
+	}
+
+	migrator := helper.NewMigrator(nil, "auth", []helper.Migration{{Version: 3}, {Version: 1}, {Version: 2}})
+
+	tc := []struct {
+		name    string
+		applied map[int]bool
+		target  int
+		want    []string
+	}{
+		{name: "should apply all in order", applied: map[int]bool{}, target: 3, want: []string{"up 1", "up 2", "up 3"}},
+		{name: "should apply pending only", applied: map[int]bool{1: true}, target: 3, want: []string{"up 2", "up 3"}},
+		{name: "should revert above target in reverse order", applied: map[int]bool{1: true, 2: true, 3: true}, target: 1, want: []string{"down 3", "down 2"}},
+		{name: "should revert all", applied: map[int]bool{1: true, 2: true}, target: 0, want: []string{"down 2", "down 1"}},
+		{name: "should fill gap below target", applied: map[int]bool{1: true, 3: true}, target: 3, want: []string{"up 2"}},
+		{name: "should do nothing when up to date", applied: map[int]bool{1: true, 2: true, 3: true}, target: 3, want: []string{}},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got := []string{}
+
+			for _, step := range migrator.Plan(c.applied, c.target) {
+				direction := "up"
+
+				if step.Revert {
+					direction = "down"
+				}
+
+				got = append(got, fmt.Sprintf("%s %d", direction, step.Version))
+			}
+
+			assert.Equal(c.want, got)
+		})
+	}
+}
+
+// Minimal SMTP sink accepting one mail, like MailHog does
+func smtpSink(t *testing.T) (string, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan string, 1)
+
+	go func() {
+		defer l.Close()
+
+		conn, err := l.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		data := strings.Builder{}
+		inData := false
+
+		fmt.Fprint(conn, "220 sink\r\n")
+
+		for {
+			line, err := r.ReadString('\n')
+
+			if err != nil {
+				return
+			}
+
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					fmt.Fprint(conn, "250 ok\r\n")
+					continue
+				}
+
+				data.WriteString(line)
+				continue
+			}
+
+			switch strings.ToUpper(strings.Fields(line)[0]) {
+			case "DATA":
+				inData = true
+				fmt.Fprint(conn, "354 go ahead\r\n")
+			case "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "250 ok\r\n")
+			}
+		}
+	}()
+
+	return l.Addr().String(), received
+}
+
+func TestMailer(t *testing.T) {
+	assert := assert.New(t)
+
+	mail := helper.Mail{
+		To:      "john.doe@gmail.com",
+		Subject: "Reset your password\r\nBcc: someone@evil.com",
+		Body:    "Open the link below",
+	}
+
+	t.Run("should write mail to log", func(t *testing.T) {
+		out := bytes.Buffer{}
+
+		err := helper.NewLogMailer(&out, "no-reply@bukuku.local").Send(mail)
+
+		assert.Nil(err)
+		assert.Contains(out.String(), "To: john.doe@gmail.com\r\n")
+		assert.Contains(out.String(), "Subject: Reset your passwordBcc: someone@evil.com\r\n", "header shouldn't be injected")
+		assert.Contains(out.String(), "\r\n\r\nOpen the link below")
+	})
+
+	t.Run("should send mail through smtp", func(t *testing.T) {
+		addr, received := smtpSink(t)
+
+		mailer := &helper.SMTPMailer{Addr: addr, From: "no-reply@bukuku.local"}
+
+		assert.Nil(mailer.Send(mail))
+
+		select {
+		case data := <-received:
+			assert.Contains(data, "From: no-reply@bukuku.local\r\n")
+			assert.Contains(data, "To: john.doe@gmail.com\r\n")
+			assert.Contains(data, "Open the link below")
+		case <-time.After(time.Second):
+			t.Fatal("mail should be received")
+		}
+	})
+}
+
+func TestSignPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("SERVICE_SECRET", "test secret")
+
+	helper.InitIdentity("auth")
+
+	token := helper.SignPayload("email-verification", []byte(`{"id":1}`))
+
+	t.Run("should return payload of valid token", func(t *testing.T) {
+		payload, err := helper.VerifyPayload("email-verification", token)
+
+		assert.Nil(err)
+		assert.Equal(`{"id":1}`, string(payload))
+	})
+
+	t.Run("should reject token of other purpose", func(t *testing.T) {
+		_, err := helper.VerifyPayload("password-reset", token)
+
+		assert.Equal(helper.ErrSignatureInvalid, err)
+	})
+
+	t.Run("should reject tampered token", func(t *testing.T) {
+		tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"id":2}`)) + token[strings.Index(token, "."):]
+
+		_, err := helper.VerifyPayload("email-verification", tampered)
+
+		assert.Equal(helper.ErrSignatureInvalid, err)
+	})
+
+	t.Run("should reject malformed token", func(t *testing.T) {
+		_, err := helper.VerifyPayload("email-verification", "not-a-token")
+
+		assert.Equal(helper.ErrSignatureInvalid, err)
+	})
+}
+
+func TestTOTP(t *testing.T) {
+	assert := assert.New(t)
+
+	// "12345678901234567890", the SHA1 secret of RFC 6238 test vectors
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	vectors := map[int64]string{
+		59:         "94287082",
+		1111111109: "07081804",
+		1234567890: "89005924",
+		2000000000: "69279037",
+	}
+
+	for unix, want := range vectors {
+		code, err := helper.TOTPCode(secret, helper.TOTPStep(time.Unix(unix, 0)), 8)
+
+		assert.Nil(err)
+		assert.Equal(want, code, fmt.Sprintf("code at %d should match RFC 6238", unix))
+	}
+
+	now := time.Unix(1234567890, 0)
+	step := helper.TOTPStep(now)
+
+	codeAt := func(step int64) string {
+		code, _ := helper.TOTPCode(secret, step, 6)
+
+		return code
+	}
+
+	tc := []struct {
+		name  string
+		code  string
+		after int64
+		valid bool
+	}{
+		{name: "should accept current code", code: codeAt(step), valid: true},
+		{name: "should accept code of previous period", code: codeAt(step - 1), valid: true},
+		{name: "should accept code of next period", code: codeAt(step + 1), valid: true},
+		{name: "should reject code of two periods ago", code: codeAt(step - 2)},
+		{name: "should reject code used before", code: codeAt(step), after: step},
+		{name: "should reject code with wrong length", code: "12345"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			_, ok := helper.ValidateTOTP(secret, c.code, now, c.after)
+
+			assert.Equal(c.valid, ok)
+		})
+	}
+
+	t.Run("should build provisioning uri", func(t *testing.T) {
+		uri := helper.TOTPURI("BukuKu", "john.doe@gmail.com", secret)
+
+		assert.Equal("otpauth://totp/BukuKu:john.doe@gmail.com?algorithm=SHA1&digits=6&issuer=BukuKu&period=30&secret="+secret, uri)
+	})
+}
+
+func TestLockoutDelay(t *testing.T) {
+	tc := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{name: "should not lock below threshold", failures: 4, want: 0},
+		{name: "should lock for base delay at threshold", failures: 5, want: time.Minute},
+		{name: "should double delay for every further failure", failures: 7, want: 4 * time.Minute},
+		{name: "should cap delay", failures: 12, want: time.Hour},
+		{name: "should cap delay without overflow", failures: 500, want: time.Hour},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, services.LockoutDelay(c.failures, 5, time.Minute, time.Hour))
+		})
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("PASSWORD_BCRYPT_COST", "4")
+	os.Setenv("PASSWORD_ARGON2_MEMORY", "1024")
+	os.Setenv("PASSWORD_ARGON2_TIME", "1")
+
+	defer func() {
+		for _, key := range []string{"PASSWORD_HASH", "PASSWORD_BCRYPT_COST", "PASSWORD_ARGON2_MEMORY", "PASSWORD_ARGON2_TIME"} {
+			os.Unsetenv(key)
+		}
+	}()
+
+	tc := []struct {
+		name   string
+		algo   string
+		prefix string
+	}{
+		{name: "should check bcrypt hash", algo: helper.HashBcrypt, prefix: "$2a$04$"},
+		{name: "should check argon2id hash", algo: helper.HashArgon2id, prefix: "$argon2id$v=19$m=1024,t=1,p=2$"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			os.Setenv("PASSWORD_HASH", c.algo)
+
+			hash, err := helper.HashPassword("Password.123")
+
+			assert.Nil(err)
+			assert.True(strings.HasPrefix(hash, c.prefix))
+			assert.True(helper.CheckPasswordHash("Password.123", hash))
+			assert.False(helper.CheckPasswordHash("Password.124", hash))
+			assert.False(helper.PasswordNeedsRehash(hash))
+		})
+	}
+
+	os.Setenv("PASSWORD_HASH", helper.HashBcrypt)
+	bcryptHash, _ := helper.HashPassword("Password.123")
+
+	os.Setenv("PASSWORD_BCRYPT_COST", "5")
+	assert.True(helper.PasswordNeedsRehash(bcryptHash), "should rehash when bcrypt cost changes")
+
+	os.Setenv("PASSWORD_HASH", helper.HashArgon2id)
+	assert.True(helper.PasswordNeedsRehash(bcryptHash), "should rehash when algorithm changes")
+
+	argonHash, _ := helper.HashPassword("Password.123")
+
+	os.Setenv("PASSWORD_ARGON2_TIME", "2")
+	assert.True(helper.PasswordNeedsRehash(argonHash), "should rehash when argon2id parameters change")
+	assert.True(helper.CheckPasswordHash("Password.123", argonHash), "should check hash of older parameters")
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy, err := helper.NewPasswordPolicy()
+
+	assert.Nil(t, err)
+
+	breached := "# comment\npassword123\n" + "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\n"
+
+	assert.Nil(t, policy.LoadBreached(strings.NewReader(breached)))
+
+	tc := []struct {
+		name       string
+		password   string
+		violations int
+	}{
+		{name: "should accept strong password", password: "Correct.Horse9", violations: 0},
+		{name: "should reject short password", password: "Ab.1", violations: 1},
+		{name: "should reject password over bcrypt limit", password: "Aa.1" + strings.Repeat("x", 70), violations: 1},
+		{name: "should reject too few character classes", password: "lowercaseonly", violations: 1},
+		{name: "should reject breached password of plain list", password: "Password123", violations: 1},
+		{name: "should reject breached password of hash list", password: "password", violations: 2},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			err := policy.Validate(c.password)
+
+			if c.violations == 0 {
+				assert.Nil(t, err)
+				return
+			}
+
+			policyErr, ok := err.(*helper.PasswordPolicyError)
+
+			assert.True(t, ok)
+			assert.Len(t, policyErr.Violations, c.violations)
+		})
+	}
+}
+
+func TestIdentityLimit(t *testing.T) {
+	permissions := []string{"book:read", "book:write", "stock:read"}
+
+	tc := []struct {
+		name   string
+		scopes []string
+		want   []string
+	}{
+		{name: "should keep permissions without api key", scopes: nil, want: permissions},
+		{name: "should limit permissions to scopes", scopes: []string{"book:read", "stock:read"}, want: []string{"book:read", "stock:read"}},
+		{name: "should drop scopes user doesn't have anymore", scopes: []string{"user:write"}, want: []string{}},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			identity := helper.Identity{Scopes: c.scopes}
+
+			assert.Equal(t, c.want, identity.Limit(permissions))
+		})
+	}
+}
+
+func TestOAuthClientRequest(t *testing.T) {
+	tc := []struct {
+		name    string
+		payload models.OAuthClientRequestModel
+		valid   bool
+	}{
+		{name: "should accept https redirect", payload: models.OAuthClientRequestModel{Name: "Shop", RedirectURIs: []string{"https://shop.example.com/callback"}}, valid: true},
+		{name: "should accept http redirect to localhost", payload: models.OAuthClientRequestModel{Name: "Dev", RedirectURIs: []string{"http://localhost:8080/callback"}}, valid: true},
+		{name: "should reject http redirect", payload: models.OAuthClientRequestModel{Name: "Shop", RedirectURIs: []string{"http://shop.example.com/callback"}}},
+		{name: "should reject redirect with fragment", payload: models.OAuthClientRequestModel{Name: "Shop", RedirectURIs: []string{"https://shop.example.com/callback#x"}}},
+		{name: "should reject relative redirect", payload: models.OAuthClientRequestModel{Name: "Shop", RedirectURIs: []string{"/callback"}}},
+		{name: "should reject unknown scope", payload: models.OAuthClientRequestModel{Name: "Shop", RedirectURIs: []string{"https://shop.example.com/cb"}, Scopes: []string{"openid", "book:write"}}},
+		{name: "should require openid scope", payload: models.OAuthClientRequestModel{Name: "Shop", RedirectURIs: []string{"https://shop.example.com/cb"}, Scopes: []string{"email"}}},
+		{name: "should require name", payload: models.OAuthClientRequestModel{RedirectURIs: []string{"https://shop.example.com/cb"}}},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.payload.Bind(nil)
+
+			assert.Equal(t, c.valid, err == nil, "%v", err)
+		})
+	}
+}
+
+func TestUserClaims(t *testing.T) {
+	birth := time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC)
+	user := models.UserModel{ID: 7, FirstName: "John", LastName: "Doe", Email: "john.doe@gmail.com", Birth: &birth}
+
+	tc := []struct {
+		name   string
+		scopes []string
+		want   map[string]interface{}
+	}{
+		{name: "should only release subject for openid", scopes: []string{"openid"}, want: map[string]interface{}{"sub": "7"}},
+		{name: "should release profile", scopes: []string{"openid", "profile"}, want: map[string]interface{}{"sub": "7", "name": "John Doe", "given_name": "John", "family_name": "Doe", "birthdate": "1990-05-17"}},
+		{name: "should release email", scopes: []string{"openid", "email"}, want: map[string]interface{}{"sub": "7", "email": "john.doe@gmail.com", "email_verified": false}},
+		{name: "should skip empty address", scopes: []string{"openid", "address"}, want: map[string]interface{}{"sub": "7"}},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, user.Claims(c.scopes))
+		})
+	}
+}
+
+func TestDescribeDevice(t *testing.T) {
+	tc := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "should describe chrome on windows", userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", want: "Chrome on Windows"},
+		{name: "should prefer edge over chrome", userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0", want: "Edge on Windows"},
+		{name: "should describe safari on iphone", userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1", want: "Safari on iOS"},
+		{name: "should describe firefox on android", userAgent: "Mozilla/5.0 (Android 14; Mobile; rv:121.0) Gecko/121.0 Firefox/121.0", want: "Firefox on Android"},
+		{name: "should describe tool without system", userAgent: "curl/8.4.0", want: "curl"},
+		{name: "should fall back for unknown agent", userAgent: "", want: "Unknown device"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, services.DescribeDevice(c.userAgent))
+		})
+	}
+}
+
+func TestUserValidation(t *testing.T) {
+	future := time.Now().Add(24 * time.Hour)
+
+	tc := []struct {
+		name  string
+		user  models.UserModel
+		codes map[string]string
+	}{
+		{name: "should accept valid user", user: models.UserModel{FirstName: "John", Email: "john.doe@gmail.com"}, codes: map[string]string{}},
+		{name: "should require first name and email", user: models.UserModel{}, codes: map[string]string{"firstName": helper.CodeRequired, "email": helper.CodeRequired}},
+		{name: "should check email format", user: models.UserModel{FirstName: "John", Email: "John <john.doe@gmail.com>"}, codes: map[string]string{"email": helper.CodeInvalidEmail}},
+		{name: "should limit length to column size", user: models.UserModel{FirstName: "John", Email: "john.doe@gmail.com", Address: strings.Repeat("x", 201)}, codes: map[string]string{"address": helper.CodeTooLong}},
+		{name: "should reject birth in the future", user: models.UserModel{FirstName: "John", Email: "john.doe@gmail.com", Birth: &future}, codes: map[string]string{"birth": helper.CodeInFuture}},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			codes := map[string]string{}
+
+			for _, f := range helper.Validate(&c.user).Fields {
+				codes[f.Field] = f.Code
 			}
+
+			assert.Equal(t, c.codes, codes)
 		})
 	}
+
+	t.Run("should update only fields sent", func(t *testing.T) {
+		update := models.UserUpdateModel{}
+		assert.Nil(t, json.Unmarshal([]byte(`{"lastName":"Roe","address":""}`), &update))
+		assert.Nil(t, update.Bind(nil))
+
+		assert.Equal(t, map[string]interface{}{"lastName": "Roe", "address": ""}, update.Fields())
+	})
+
+	t.Run("should reject blank first name and email sent on update", func(t *testing.T) {
+		update := models.UserUpdateModel{}
+		assert.Nil(t, json.Unmarshal([]byte(`{"firstName":" ","email":""}`), &update))
+
+		codes := map[string]string{}
+
+		for _, f := range helper.Validate(&update).Fields {
+			codes[f.Field] = f.Code
+		}
+
+		assert.Equal(t, map[string]string{"firstName": helper.CodeRequired, "email": helper.CodeRequired}, codes)
+	})
 }
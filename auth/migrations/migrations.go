@@ -0,0 +1,293 @@
+package migrations
+
+import "github.com/ariefsn/book-store/auth/helper"
+
+// Schema of tables owned by auth service.
+// Released migrations must not be changed, add a new one instead.
+var Migrations = []helper.Migration{
+	{
+		Version: 1,
+		Name:    "create_users",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS users (
+  id int NOT NULL AUTO_INCREMENT,
+  firstName VARCHAR(100) NOT NULL,
+  lastName VARCHAR(100),
+  email VARCHAR(100) NOT NULL,
+  password VARCHAR(100),
+  birth DATETIME,
+  address VARCHAR(200),
+  isAdmin BOOLEAN,
+  createdAt DATETIME,
+  updatedAt DATETIME,
+  PRIMARY KEY(id)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS users`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_refresh_tokens",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS refresh_tokens (
+  id int NOT NULL AUTO_INCREMENT,
+  userId int NOT NULL,
+  familyId VARCHAR(64) NOT NULL,
+  tokenHash CHAR(64) NOT NULL,
+  expiresAt DATETIME NOT NULL,
+  revokedAt DATETIME,
+  createdAt DATETIME,
+  PRIMARY KEY(id),
+  UNIQUE KEY(tokenHash),
+  KEY(familyId)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS refresh_tokens`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_roles",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS roles (
+  id int NOT NULL AUTO_INCREMENT,
+  name VARCHAR(50) NOT NULL,
+  description VARCHAR(200),
+  createdAt DATETIME,
+  updatedAt DATETIME,
+  PRIMARY KEY(id),
+  UNIQUE KEY(name)
+)`,
+			`CREATE TABLE IF NOT EXISTS permissions (
+  id int NOT NULL AUTO_INCREMENT,
+  name VARCHAR(50) NOT NULL,
+  description VARCHAR(200),
+  PRIMARY KEY(id),
+  UNIQUE KEY(name)
+)`,
+			`CREATE TABLE IF NOT EXISTS role_permissions (
+  roleId int NOT NULL,
+  permissionId int NOT NULL,
+  PRIMARY KEY(roleId, permissionId)
+)`,
+			`CREATE TABLE IF NOT EXISTS user_roles (
+  userId int NOT NULL,
+  roleId int NOT NULL,
+  PRIMARY KEY(userId, roleId)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS user_roles`,
+			`DROP TABLE IF EXISTS role_permissions`,
+			`DROP TABLE IF EXISTS permissions`,
+			`DROP TABLE IF EXISTS roles`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_password_resets",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS password_resets (
+  id int NOT NULL AUTO_INCREMENT,
+  userId int NOT NULL,
+  tokenHash CHAR(64) NOT NULL,
+  expiresAt DATETIME NOT NULL,
+  usedAt DATETIME,
+  createdAt DATETIME,
+  PRIMARY KEY(id),
+  UNIQUE KEY(tokenHash),
+  KEY(userId)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS password_resets`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_users_email_verification",
+		Up: []string{
+			`ALTER TABLE users ADD COLUMN emailVerifiedAt DATETIME, ADD COLUMN verificationSentAt DATETIME`,
+			// accounts created before verification existed are trusted
+			`UPDATE users SET emailVerifiedAt = COALESCE(createdAt, NOW())`,
+		},
+		Down: []string{
+			`ALTER TABLE users DROP COLUMN emailVerifiedAt, DROP COLUMN verificationSentAt`,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add_two_factor",
+		Up: []string{
+			`ALTER TABLE users ADD COLUMN totpSecret VARCHAR(64), ADD COLUMN totpEnabledAt DATETIME, ADD COLUMN totpLastStep BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE roles ADD COLUMN requireTwoFactor BOOLEAN NOT NULL DEFAULT FALSE`,
+			`CREATE TABLE IF NOT EXISTS recovery_codes (
+  id int NOT NULL AUTO_INCREMENT,
+  userId int NOT NULL,
+  codeHash CHAR(64) NOT NULL,
+  usedAt DATETIME,
+  createdAt DATETIME,
+  PRIMARY KEY(id),
+  KEY(userId, codeHash)
+)`,
+			`CREATE TABLE IF NOT EXISTS login_challenges (
+  id int NOT NULL AUTO_INCREMENT,
+  userId int NOT NULL,
+  tokenHash CHAR(64) NOT NULL,
+  enroll BOOLEAN NOT NULL DEFAULT FALSE,
+  attempts int NOT NULL DEFAULT 0,
+  expiresAt DATETIME NOT NULL,
+  usedAt DATETIME,
+  createdAt DATETIME,
+  PRIMARY KEY(id),
+  UNIQUE KEY(tokenHash)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS login_challenges`,
+			`DROP TABLE IF EXISTS recovery_codes`,
+			`ALTER TABLE roles DROP COLUMN requireTwoFactor`,
+			`ALTER TABLE users DROP COLUMN totpSecret, DROP COLUMN totpEnabledAt, DROP COLUMN totpLastStep`,
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_login_attempts",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS login_attempts (
+  id int NOT NULL AUTO_INCREMENT,
+  userId int,
+  email VARCHAR(100) NOT NULL,
+  ip VARCHAR(45) NOT NULL,
+  userAgent VARCHAR(255),
+  outcome ENUM('success', 'failure', 'locked', 'unlocked') NOT NULL,
+  createdAt DATETIME,
+  PRIMARY KEY(id),
+  KEY(email, outcome, id),
+  KEY(ip, outcome, createdAt),
+  KEY(userId, id)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS login_attempts`,
+		},
+	},
+	{
+		Version: 8,
+		Name:    "create_api_keys",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS api_keys (
+  id int NOT NULL AUTO_INCREMENT,
+  userId int NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  prefix VARCHAR(16) NOT NULL,
+  keyHash CHAR(64) NOT NULL,
+  scopes VARCHAR(500) NOT NULL,
+  expiresAt DATETIME,
+  lastUsedAt DATETIME,
+  lastUsedIp VARCHAR(45),
+  revokedAt DATETIME,
+  createdAt DATETIME,
+  updatedAt DATETIME,
+  PRIMARY KEY(id),
+  UNIQUE KEY(keyHash),
+  KEY(userId)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS api_keys`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "create_oauth",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS oauth_clients (
+  id int NOT NULL AUTO_INCREMENT,
+  clientId VARCHAR(64) NOT NULL,
+  secretHash CHAR(64),
+  name VARCHAR(100) NOT NULL,
+  redirectUris TEXT NOT NULL,
+  scopes VARCHAR(200) NOT NULL,
+  public BOOLEAN NOT NULL DEFAULT FALSE,
+  createdAt DATETIME,
+  updatedAt DATETIME,
+  PRIMARY KEY(id),
+  UNIQUE KEY(clientId)
+)`,
+			`CREATE TABLE IF NOT EXISTS oauth_consents (
+  userId int NOT NULL,
+  clientId VARCHAR(64) NOT NULL,
+  scopes VARCHAR(200) NOT NULL,
+  createdAt DATETIME,
+  updatedAt DATETIME,
+  PRIMARY KEY(userId, clientId)
+)`,
+			`CREATE TABLE IF NOT EXISTS oauth_codes (
+  id int NOT NULL AUTO_INCREMENT,
+  codeHash CHAR(64) NOT NULL,
+  clientId VARCHAR(64) NOT NULL,
+  userId int NOT NULL,
+  redirectUri VARCHAR(500) NOT NULL,
+  scopes VARCHAR(200) NOT NULL,
+  nonce VARCHAR(255),
+  codeChallenge VARCHAR(128) NOT NULL,
+  authTime DATETIME NOT NULL,
+  expiresAt DATETIME NOT NULL,
+  usedAt DATETIME,
+  createdAt DATETIME,
+  PRIMARY KEY(id),
+  UNIQUE KEY(codeHash)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS oauth_codes`,
+			`DROP TABLE IF EXISTS oauth_consents`,
+			`DROP TABLE IF EXISTS oauth_clients`,
+		},
+	},
+	{
+		Version: 10,
+		Name:    "create_sessions",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS sessions (
+  id int NOT NULL AUTO_INCREMENT,
+  userId int NOT NULL,
+  familyId VARCHAR(64) NOT NULL,
+  device VARCHAR(100),
+  ip VARCHAR(45),
+  userAgent VARCHAR(255),
+  createdAt DATETIME,
+  lastSeenAt DATETIME,
+  terminatedAt DATETIME,
+  PRIMARY KEY(id),
+  UNIQUE KEY(familyId),
+  KEY(userId)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS sessions`,
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add_users_indexes",
+		Up: []string{
+			`CREATE INDEX users_email ON users (email)`,
+			`CREATE INDEX users_first_name ON users (firstName)`,
+			`CREATE INDEX users_last_name ON users (lastName)`,
+			`CREATE INDEX users_birth ON users (birth)`,
+			`CREATE INDEX users_created_at ON users (createdAt)`,
+		},
+		Down: []string{
+			`DROP INDEX users_created_at ON users`,
+			`DROP INDEX users_birth ON users`,
+			`DROP INDEX users_last_name ON users`,
+			`DROP INDEX users_first_name ON users`,
+			`DROP INDEX users_email ON users`,
+		},
+	},
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Permissions stored as comma separated list
+type ScopeList []string
+
+// Personal API key of user, the key itself is returned once on creation and only its hash is stored
+type APIKeyModel struct {
+	ID         int        `json:"id" gorm:"autoIncrement"`
+	UserID     int        `json:"userId" gorm:"column:userId"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-" gorm:"column:keyHash"`
+	Scopes     ScopeList  `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt" gorm:"column:expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt" gorm:"column:lastUsedAt"`
+	LastUsedIP string     `json:"lastUsedIp" gorm:"column:lastUsedIp"`
+	RevokedAt  *time.Time `json:"revokedAt" gorm:"column:revokedAt"`
+	CreatedAt  *time.Time `json:"createdAt" gorm:"column:createdAt"`
+	UpdatedAt  *time.Time `json:"updatedAt" gorm:"column:updatedAt"`
+	Key        string     `json:"key,omitempty" gorm:"-"`
+}
+
+type APIKeyListModel struct {
+	Keys []APIKeyModel `json:"list"`
+}
+
+type APIKeyRequestModel struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type APIKeyUpdateModel struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type APIKeyVerifyModel struct {
+	Key string `json:"key"`
+}
+
+// Identity the gateway forwards for a request authenticated with an API key
+type APIKeyIdentityModel struct {
+	KeyID  int      `json:"keyId"`
+	UserID int      `json:"userId"`
+	Email  string   `json:"email"`
+	Roles  []string `json:"roles"`
+	Scopes []string `json:"scopes"`
+}
+
+func (s ScopeList) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+func (s *ScopeList) Scan(value interface{}) error {
+	var str string
+
+	switch v := value.(type) {
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	case nil:
+		str = ""
+	default:
+		return fmt.Errorf("can't scan %T into scopes", value)
+	}
+
+	*s = ScopeList{}
+
+	for _, scope := range strings.Split(str, ",") {
+		if scope != "" {
+			*s = append(*s, scope)
+		}
+	}
+
+	return nil
+}
+
+func (k *APIKeyModel) TableName() string {
+	return "api_keys"
+}
+
+func (k *APIKeyModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (k *APIKeyListModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (k *APIKeyIdentityModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func validateAPIKey(name string, scopes []string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("name can't be empty")
+	}
+
+	if len(name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+
+	if len(scopes) == 0 {
+		return errors.New("scopes can't be empty")
+	}
+
+	return nil
+}
+
+func (k *APIKeyRequestModel) Bind(r *http.Request) error {
+	if err := validateAPIKey(k.Name, k.Scopes); err != nil {
+		return err
+	}
+
+	if k.ExpiresAt != nil && k.ExpiresAt.Before(time.Now()) {
+		return errors.New("expiresAt must be in the future")
+	}
+
+	return nil
+}
+
+func (k *APIKeyUpdateModel) Bind(r *http.Request) error {
+	return validateAPIKey(k.Name, k.Scopes)
+}
+
+func (k *APIKeyVerifyModel) Bind(r *http.Request) error {
+	if k.Key == "" {
+		return errors.New("key can't be empty")
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	LoginSuccess  = "success"
+	LoginFailure  = "failure"
+	LoginLocked   = "locked"
+	LoginUnlocked = "unlocked"
+)
+
+type LoginAttemptModel struct {
+	ID        int        `json:"id" gorm:"autoIncrement"`
+	UserID    *int       `json:"userId" gorm:"column:userId"`
+	Email     string     `json:"email"`
+	IP        string     `json:"ip" gorm:"column:ip"`
+	UserAgent string     `json:"userAgent" gorm:"column:userAgent"`
+	Outcome   string     `json:"outcome"`
+	CreatedAt *time.Time `json:"createdAt" gorm:"column:createdAt"`
+}
+
+type LoginAttemptListModel struct {
+	Attempts   []LoginAttemptModel `json:"list"`
+	Total      int64               `json:"total"`
+	Page       int                 `json:"page"`
+	Limit      int                 `json:"limit"`
+	NextCursor string              `json:"nextCursor"`
+}
+
+type LoginRequestModel struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (l *LoginAttemptModel) TableName() string {
+	return "login_attempts"
+}
+
+func (l *LoginAttemptListModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (l *LoginRequestModel) Bind(r *http.Request) error {
+	if l.Email == "" {
+		return errors.New("email can't be empty")
+	}
+
+	if l.Password == "" {
+		return errors.New("password can't be empty")
+	}
+
+	return nil
+}
@@ -0,0 +1,288 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scopes of OpenID Connect, each one releases claims of the user
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopeAddress = "address"
+)
+
+var OAuthScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeAddress}
+
+// Redirect URIs stored one per line
+type URIList []string
+
+// Application registered to sign in users, public clients (e.g. single page apps) have no secret
+type OAuthClientModel struct {
+	ID           int        `json:"id" gorm:"autoIncrement"`
+	ClientID     string     `json:"clientId" gorm:"column:clientId"`
+	SecretHash   string     `json:"-" gorm:"column:secretHash"`
+	Name         string     `json:"name"`
+	RedirectURIs URIList    `json:"redirectUris" gorm:"column:redirectUris"`
+	Scopes       ScopeList  `json:"scopes"`
+	Public       bool       `json:"public"`
+	CreatedAt    *time.Time `json:"createdAt" gorm:"column:createdAt"`
+	UpdatedAt    *time.Time `json:"updatedAt" gorm:"column:updatedAt"`
+	Secret       string     `json:"clientSecret,omitempty" gorm:"-"`
+}
+
+type OAuthClientListModel struct {
+	Clients []OAuthClientModel `json:"list"`
+}
+
+type OAuthClientRequestModel struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirectUris"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+}
+
+type OAuthConsentModel struct {
+	UserID    int        `json:"userId" gorm:"column:userId;primaryKey"`
+	ClientID  string     `json:"clientId" gorm:"column:clientId;primaryKey"`
+	Scopes    ScopeList  `json:"scopes"`
+	CreatedAt *time.Time `json:"createdAt" gorm:"column:createdAt"`
+	UpdatedAt *time.Time `json:"updatedAt" gorm:"column:updatedAt"`
+}
+
+// Single use authorization code, bound to client, redirect URI and PKCE challenge
+type OAuthCodeModel struct {
+	ID            int        `json:"id" gorm:"autoIncrement"`
+	CodeHash      string     `json:"-" gorm:"column:codeHash"`
+	ClientID      string     `json:"clientId" gorm:"column:clientId"`
+	UserID        int        `json:"userId" gorm:"column:userId"`
+	RedirectURI   string     `json:"redirectUri" gorm:"column:redirectUri"`
+	Scopes        ScopeList  `json:"scopes"`
+	Nonce         string     `json:"nonce"`
+	CodeChallenge string     `json:"-" gorm:"column:codeChallenge"`
+	AuthTime      *time.Time `json:"authTime" gorm:"column:authTime"`
+	ExpiresAt     *time.Time `json:"expiresAt" gorm:"column:expiresAt"`
+	UsedAt        *time.Time `json:"usedAt" gorm:"column:usedAt"`
+	CreatedAt     *time.Time `json:"createdAt" gorm:"column:createdAt"`
+}
+
+// Authorization request as sent by the client, parameter names follow OAuth 2.0
+type OAuthAuthorizeModel struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+// Details of a valid authorization request shown on the consent screen
+type OAuthRequestInfoModel struct {
+	ClientID   string   `json:"clientId"`
+	ClientName string   `json:"clientName"`
+	Scopes     []string `json:"scopes"`
+	Consented  bool     `json:"consented"`
+}
+
+type OAuthCodeRequestModel struct {
+	Code         string `json:"code"`
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	RedirectURI  string `json:"redirectUri"`
+	CodeVerifier string `json:"codeVerifier"`
+}
+
+// Result of exchanging an authorization code, the gateway signs tokens from it
+type OAuthGrantModel struct {
+	UserID   int                    `json:"userId"`
+	ClientID string                 `json:"clientId"`
+	Scopes   []string               `json:"scopes"`
+	Nonce    string                 `json:"nonce,omitempty"`
+	AuthTime int64                  `json:"authTime"`
+	Claims   map[string]interface{} `json:"claims"`
+}
+
+type OAuthUserInfoRequestModel struct {
+	Scopes []string `json:"scopes"`
+}
+
+func (u URIList) Value() (driver.Value, error) {
+	return strings.Join(u, "\n"), nil
+}
+
+func (u *URIList) Scan(value interface{}) error {
+	var str string
+
+	switch v := value.(type) {
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	case nil:
+		str = ""
+	default:
+		return fmt.Errorf("can't scan %T into uris", value)
+	}
+
+	*u = URIList{}
+
+	for _, uri := range strings.Split(str, "\n") {
+		if uri != "" {
+			*u = append(*u, uri)
+		}
+	}
+
+	return nil
+}
+
+func (c *OAuthClientModel) TableName() string {
+	return "oauth_clients"
+}
+
+func (c *OAuthConsentModel) TableName() string {
+	return "oauth_consents"
+}
+
+func (c *OAuthCodeModel) TableName() string {
+	return "oauth_codes"
+}
+
+func (c *OAuthClientModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (c *OAuthClientListModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (c *OAuthRequestInfoModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (c *OAuthGrantModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Standard claims of user released by the scopes
+func (u *UserModel) Claims(scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": strconv.Itoa(u.ID)}
+
+	if containsString(scopes, ScopeProfile) {
+		claims["name"] = strings.TrimSpace(u.FirstName + " " + u.LastName)
+		claims["given_name"] = u.FirstName
+
+		if u.LastName != "" {
+			claims["family_name"] = u.LastName
+		}
+
+		if u.Birth != nil {
+			claims["birthdate"] = u.Birth.Format("2006-01-02")
+		}
+
+		if u.UpdatedAt != nil {
+			claims["updated_at"] = u.UpdatedAt.Unix()
+		}
+	}
+
+	if containsString(scopes, ScopeEmail) {
+		claims["email"] = u.Email
+		claims["email_verified"] = u.EmailVerifiedAt != nil
+	}
+
+	if containsString(scopes, ScopeAddress) && u.Address != "" {
+		claims["address"] = map[string]string{"formatted": u.Address}
+	}
+
+	return claims
+}
+
+// Redirect URIs must be absolute without fragment, plain http is only allowed for localhost
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+
+	if err != nil || !u.IsAbs() || u.Fragment != "" || u.Host == "" {
+		return false
+	}
+
+	if u.Scheme == "http" {
+		host := u.Hostname()
+
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+
+	return u.Scheme == "https"
+}
+
+func (c *OAuthClientRequestModel) Bind(r *http.Request) error {
+	c.Name = strings.TrimSpace(c.Name)
+
+	if c.Name == "" {
+		return errors.New("name can't be empty")
+	}
+
+	if len(c.Name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+
+	if len(c.RedirectURIs) == 0 {
+		return errors.New("redirectUris can't be empty")
+	}
+
+	for _, uri := range c.RedirectURIs {
+		if len(uri) > 500 || !validRedirectURI(uri) {
+			return fmt.Errorf("invalid redirect uri %s", uri)
+		}
+	}
+
+	if len(c.Scopes) == 0 {
+		c.Scopes = OAuthScopes
+	}
+
+	hasOpenID := false
+
+	for _, scope := range c.Scopes {
+		if !containsString(OAuthScopes, scope) {
+			return fmt.Errorf("unknown scope %s", scope)
+		}
+
+		hasOpenID = hasOpenID || scope == ScopeOpenID
+	}
+
+	if !hasOpenID {
+		return errors.New("scopes must contain openid")
+	}
+
+	return nil
+}
+
+func (c *OAuthAuthorizeModel) Bind(r *http.Request) error {
+	return nil
+}
+
+func (c *OAuthCodeRequestModel) Bind(r *http.Request) error {
+	return nil
+}
+
+func (c *OAuthUserInfoRequestModel) Bind(r *http.Request) error {
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+type PasswordResetModel struct {
+	ID        int        `json:"id" gorm:"autoIncrement"`
+	UserID    int        `json:"userId" gorm:"column:userId"`
+	TokenHash string     `json:"-" gorm:"column:tokenHash"`
+	ExpiresAt *time.Time `json:"expiresAt" gorm:"column:expiresAt"`
+	UsedAt    *time.Time `json:"usedAt" gorm:"column:usedAt"`
+	CreatedAt *time.Time `json:"createdAt" gorm:"column:createdAt"`
+}
+
+type PasswordForgotModel struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetRequestModel struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (p *PasswordResetModel) TableName() string {
+	return "password_resets"
+}
+
+func (p *PasswordForgotModel) Bind(r *http.Request) error {
+	if p.Email == "" {
+		return errors.New("email can't be empty")
+	}
+
+	return nil
+}
+
+func (p *PasswordResetRequestModel) Bind(r *http.Request) error {
+	if p.Token == "" {
+		return errors.New("token can't be empty")
+	}
+
+	if p.Password == "" {
+		return errors.New("password can't be empty")
+	}
+
+	return nil
+}
+
+func NewPasswordResetModel() *PasswordResetModel {
+	s := new(PasswordResetModel)
+
+	return s
+}
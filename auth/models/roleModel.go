@@ -0,0 +1,131 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	PermissionUserRead     = "user:read"
+	PermissionUserWrite    = "user:write"
+	PermissionRoleManage   = "role:manage"
+	PermissionBookRead     = "book:read"
+	PermissionBookWrite    = "book:write"
+	PermissionStockRead    = "stock:read"
+	PermissionStockWrite   = "stock:write"
+	PermissionOrderCreate  = "order:create"
+	PermissionOrderOwn     = "order:own"
+	PermissionOrderRead    = "order:read"
+	PermissionOrderWrite   = "order:write"
+	PermissionClientManage = "client:manage"
+)
+
+const (
+	RoleAdmin         = "admin"
+	RoleCatalogEditor = "catalog-editor"
+	RoleCustomer      = "customer"
+	RoleAuditor       = "auditor"
+)
+
+type RoleModel struct {
+	ID          int      `json:"id" gorm:"autoIncrement"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions" gorm:"-"`
+	// members must log in with two-factor authentication
+	RequireTwoFactor bool       `json:"requireTwoFactor" gorm:"column:requireTwoFactor"`
+	CreatedAt        *time.Time `json:"createdAt" gorm:"column:createdAt"`
+	UpdatedAt        *time.Time `json:"updatedAt" gorm:"column:updatedAt"`
+}
+
+type PermissionModel struct {
+	ID          int    `json:"id" gorm:"autoIncrement"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type RolePermissionModel struct {
+	RoleID       int `json:"roleId" gorm:"column:roleId;primaryKey"`
+	PermissionID int `json:"permissionId" gorm:"column:permissionId;primaryKey"`
+}
+
+type UserRoleModel struct {
+	UserID int `json:"userId" gorm:"column:userId;primaryKey"`
+	RoleID int `json:"roleId" gorm:"column:roleId;primaryKey"`
+}
+
+type UserRoleRequestModel struct {
+	Roles []string `json:"roles"`
+}
+
+func (u *RoleModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (u *UserRoleRequestModel) Bind(r *http.Request) error {
+	return nil
+}
+
+func (u *RoleModel) TableName() string {
+	return "roles"
+}
+
+func (u *PermissionModel) TableName() string {
+	return "permissions"
+}
+
+func (u *RolePermissionModel) TableName() string {
+	return "role_permissions"
+}
+
+func (u *UserRoleModel) TableName() string {
+	return "user_roles"
+}
+
+func NewRoleModel() *RoleModel {
+	s := new(RoleModel)
+
+	return s
+}
+
+func DefaultPermissions() []PermissionModel {
+	return []PermissionModel{
+		{Name: PermissionUserRead, Description: "List and view users"},
+		{Name: PermissionUserWrite, Description: "Create, update and delete users"},
+		{Name: PermissionRoleManage, Description: "Assign roles to users"},
+		{Name: PermissionBookRead, Description: "List and view books"},
+		{Name: PermissionBookWrite, Description: "Create, update and delete books"},
+		{Name: PermissionStockRead, Description: "View stock levels and movements"},
+		{Name: PermissionStockWrite, Description: "Post stock movements"},
+		{Name: PermissionOrderCreate, Description: "Fill own cart and place orders"},
+		{Name: PermissionOrderOwn, Description: "View and cancel own orders"},
+		{Name: PermissionOrderRead, Description: "View orders of all users"},
+		{Name: PermissionOrderWrite, Description: "Change status of orders"},
+		{Name: PermissionClientManage, Description: "Register OpenID Connect clients"},
+	}
+}
+
+func DefaultRoles() []RoleModel {
+	return []RoleModel{
+		{
+			Name:        RoleAdmin,
+			Description: "Full access",
+			Permissions: []string{PermissionUserRead, PermissionUserWrite, PermissionRoleManage, PermissionBookRead, PermissionBookWrite, PermissionStockRead, PermissionStockWrite, PermissionOrderCreate, PermissionOrderOwn, PermissionOrderRead, PermissionOrderWrite, PermissionClientManage},
+		},
+		{
+			Name:        RoleCatalogEditor,
+			Description: "Maintain book catalog",
+			Permissions: []string{PermissionBookRead, PermissionBookWrite, PermissionStockRead, PermissionStockWrite},
+		},
+		{
+			Name:        RoleCustomer,
+			Description: "Browse book catalog and order books",
+			Permissions: []string{PermissionBookRead, PermissionOrderCreate, PermissionOrderOwn},
+		},
+		{
+			Name:        RoleAuditor,
+			Description: "Read only access to users and books",
+			Permissions: []string{PermissionUserRead, PermissionBookRead, PermissionStockRead, PermissionOrderRead},
+		},
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// Login of a user on a device, it lasts as long as its refresh token family
+type SessionModel struct {
+	ID           int        `json:"id" gorm:"autoIncrement"`
+	UserID       int        `json:"userId" gorm:"column:userId"`
+	FamilyID     string     `json:"-" gorm:"column:familyId"`
+	Device       string     `json:"device"`
+	IP           string     `json:"ip"`
+	UserAgent    string     `json:"userAgent" gorm:"column:userAgent"`
+	CreatedAt    *time.Time `json:"createdAt" gorm:"column:createdAt"`
+	LastSeenAt   *time.Time `json:"lastSeenAt" gorm:"column:lastSeenAt"`
+	TerminatedAt *time.Time `json:"-" gorm:"column:terminatedAt"`
+	Current      bool       `json:"current" gorm:"-"`
+}
+
+type SessionListModel struct {
+	Sessions []SessionModel `json:"list"`
+}
+
+func (s *SessionModel) TableName() string {
+	return "sessions"
+}
+
+func (s *SessionListModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
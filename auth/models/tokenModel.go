@@ -0,0 +1,50 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+type RefreshTokenModel struct {
+	ID        int        `json:"id" gorm:"autoIncrement"`
+	UserID    int        `json:"userId" gorm:"column:userId"`
+	FamilyID  string     `json:"familyId" gorm:"column:familyId"`
+	TokenHash string     `json:"-" gorm:"column:tokenHash"`
+	ExpiresAt *time.Time `json:"expiresAt" gorm:"column:expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt" gorm:"column:revokedAt"`
+	CreatedAt *time.Time `json:"createdAt" gorm:"column:createdAt"`
+}
+
+type TokenRequestModel struct {
+	UserID       int    `json:"userId"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type TokenModel struct {
+	UserID       int        `json:"userId"`
+	Email        string     `json:"email"`
+	Roles        []string   `json:"roles"`
+	FamilyID     string     `json:"familyId"`
+	RefreshToken string     `json:"refreshToken"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	// set once, when two-factor authentication was enabled during login
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+}
+
+func (t *RefreshTokenModel) TableName() string {
+	return "refresh_tokens"
+}
+
+func (t *TokenRequestModel) Bind(r *http.Request) error {
+	return nil
+}
+
+func (t *TokenModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func NewRefreshTokenModel() *RefreshTokenModel {
+	s := new(RefreshTokenModel)
+
+	return s
+}
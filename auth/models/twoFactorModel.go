@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+type RecoveryCodeModel struct {
+	ID        int        `json:"id" gorm:"autoIncrement"`
+	UserID    int        `json:"userId" gorm:"column:userId"`
+	CodeHash  string     `json:"-" gorm:"column:codeHash"`
+	UsedAt    *time.Time `json:"usedAt" gorm:"column:usedAt"`
+	CreatedAt *time.Time `json:"createdAt" gorm:"column:createdAt"`
+}
+
+// Second step of login, issued after the password matched for users with two-factor authentication
+type LoginChallengeModel struct {
+	ID        int        `json:"id" gorm:"autoIncrement"`
+	UserID    int        `json:"userId" gorm:"column:userId"`
+	TokenHash string     `json:"-" gorm:"column:tokenHash"`
+	Enroll    bool       `json:"enroll"`
+	Attempts  int        `json:"attempts"`
+	ExpiresAt *time.Time `json:"expiresAt" gorm:"column:expiresAt"`
+	UsedAt    *time.Time `json:"usedAt" gorm:"column:usedAt"`
+	CreatedAt *time.Time `json:"createdAt" gorm:"column:createdAt"`
+}
+
+type TwoFactorEnrollModel struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TwoFactorCodeModel struct {
+	Code string `json:"code"`
+}
+
+// Challenge returned instead of token, Secret and URI are set when the user must enroll first
+type ChallengeModel struct {
+	Challenge string     `json:"challenge"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Enroll    bool       `json:"enroll"`
+	Secret    string     `json:"secret,omitempty"`
+	URI       string     `json:"uri,omitempty"`
+}
+
+type ChallengeRequestModel struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+type RoleSettingModel struct {
+	RequireTwoFactor *bool `json:"requireTwoFactor"`
+}
+
+func (c *RecoveryCodeModel) TableName() string {
+	return "recovery_codes"
+}
+
+func (c *LoginChallengeModel) TableName() string {
+	return "login_challenges"
+}
+
+func (t *TwoFactorEnrollModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (t *TwoFactorCodeModel) Bind(r *http.Request) error {
+	if t.Code == "" {
+		return errors.New("code can't be empty")
+	}
+
+	return nil
+}
+
+func (c *ChallengeModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (c *ChallengeRequestModel) Bind(r *http.Request) error {
+	if c.Challenge == "" {
+		return errors.New("challenge can't be empty")
+	}
+
+	if c.Code == "" {
+		return errors.New("code can't be empty")
+	}
+
+	return nil
+}
+
+func (s *RoleSettingModel) Bind(r *http.Request) error {
+	if s.RequireTwoFactor == nil {
+		return errors.New("requireTwoFactor can't be empty")
+	}
+
+	return nil
+}
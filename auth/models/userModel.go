@@ -1,7 +1,10 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/ariefsn/book-store/auth/helper"
@@ -9,22 +12,97 @@ import (
 
 type UserModel struct {
 	ID        int        `json:"id" gorm:"autoIncrement"`
-	FirstName string     `json:"firstName" gorm:"column:firstName"`
-	LastName  string     `json:"lastName" gorm:"column:lastName"`
-	Email     string     `json:"email" gorm:"unique"`
-	Password  string     `json:"password"`
-	Birth     *time.Time `json:"birth"`
-	Address   string     `json:"address"`
+	FirstName string     `json:"firstName" gorm:"column:firstName" validate:"required,max=100"`
+	LastName  string     `json:"lastName" gorm:"column:lastName" validate:"max=100"`
+	Email     string     `json:"email" gorm:"unique" validate:"required,max=100,email"`
+	Password  string     `json:"password,omitempty"`
+	Birth     *time.Time `json:"birth" validate:"notfuture"`
+	Address   string     `json:"address" validate:"max=200"`
 	IsAdmin   bool       `json:"isAdmin" gorm:"column:isAdmin"`
 	CreatedAt *time.Time `json:"createdAt" gorm:"column:createdAt"`
 	UpdatedAt *time.Time `json:"updatedAt" gorm:"column:updatedAt"`
+
+	EmailVerifiedAt    *time.Time `json:"emailVerifiedAt" gorm:"column:emailVerifiedAt"`
+	VerificationSentAt *time.Time `json:"-" gorm:"column:verificationSentAt"`
+
+	TotpSecret    string     `json:"-" gorm:"column:totpSecret"`
+	TotpEnabledAt *time.Time `json:"twoFactorEnabledAt" gorm:"column:totpEnabledAt"`
+	TotpLastStep  int64      `json:"-" gorm:"column:totpLastStep"`
+}
+
+// Fields of user sent on update, fields which aren't sent are kept.
+// CurrentPassword confirms a change of password or email by the user itself.
+type UserUpdateModel struct {
+	FirstName       *string    `json:"firstName" validate:"notblank,max=100"`
+	LastName        *string    `json:"lastName" validate:"max=100"`
+	Email           *string    `json:"email" validate:"notblank,max=100,email"`
+	Password        string     `json:"password"`
+	CurrentPassword string     `json:"currentPassword"`
+	Birth           *time.Time `json:"birth" validate:"notfuture"`
+	Address         *string    `json:"address" validate:"max=200"`
+}
+
+type VerificationResendModel struct {
+	Email string `json:"email"`
 }
 
 type UserListModel struct {
-	Users []UserModel `json:"list"`
+	Users      []UserModel `json:"list"`
+	Total      int64       `json:"total"`
+	Page       int         `json:"page"`
+	Limit      int         `json:"limit"`
+	NextCursor string      `json:"nextCursor"`
+}
+
+type UserFilterModel struct {
+	Email   string
+	Name    string
+	IsAdmin *bool
 }
 
+// Columns allowed for sort, every one of them is indexed
+var UserSortable = []string{"email", "firstName", "lastName", "birth", "createdAt"}
+
 func (u *UserModel) Bind(r *http.Request) error {
+	return helper.Validate(u).Err()
+}
+
+func (u *UserUpdateModel) Bind(r *http.Request) error {
+	return helper.Validate(u).Err()
+}
+
+// Columns of fields sent, password isn't one of them as it's hashed first
+func (u *UserUpdateModel) Fields() map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	if u.FirstName != nil {
+		fields["firstName"] = *u.FirstName
+	}
+
+	if u.LastName != nil {
+		fields["lastName"] = *u.LastName
+	}
+
+	if u.Email != nil {
+		fields["email"] = *u.Email
+	}
+
+	if u.Birth != nil {
+		fields["birth"] = u.Birth
+	}
+
+	if u.Address != nil {
+		fields["address"] = *u.Address
+	}
+
+	return fields
+}
+
+func (u *VerificationResendModel) Bind(r *http.Request) error {
+	if u.Email == "" {
+		return errors.New("email can't be empty")
+	}
+
 	return nil
 }
 
@@ -32,6 +110,16 @@ func (u *UserModel) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// Password hash is accepted on input only, never written to responses
+func (u UserModel) MarshalJSON() ([]byte, error) {
+	type user UserModel
+
+	out := user(u)
+	out.Password = ""
+
+	return json.Marshal(out)
+}
+
 func (u *UserListModel) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
@@ -40,6 +128,27 @@ func (u *UserModel) TableName() string {
 	return "users"
 }
 
+// Parse user filter from query params
+func NewUserFilterModel(r *http.Request) (*UserFilterModel, error) {
+	query := r.URL.Query()
+
+	f := new(UserFilterModel)
+	f.Email = query.Get("email")
+	f.Name = query.Get("name")
+
+	if s := query.Get("isAdmin"); s != "" {
+		isAdmin, err := strconv.ParseBool(s)
+
+		if err != nil {
+			return nil, errors.New("isAdmin must be a boolean")
+		}
+
+		f.IsAdmin = &isAdmin
+	}
+
+	return f, nil
+}
+
 func NewUserModel() *UserModel {
 	s := new(UserModel)
 
@@ -56,5 +165,8 @@ func DefaultAdminUser() *UserModel {
 	s.Password, _ = helper.HashPassword("Password.123")
 	s.IsAdmin = true
 
+	now := time.Now()
+	s.EmailVerifiedAt = &now
+
 	return s
 }
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAPIKeyNotFound = fmt.Errorf("api key %w", helper.ErrNotFound)
+	ErrAPIKeyInvalid  = errors.New("invalid, expired or revoked api key")
+	ErrAPIKeyScope    = errors.New("scope not granted to user")
+)
+
+const (
+	apiKeyPrefix   = "bk_"
+	apiKeyIdChars  = 8
+	apiKeyAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	// last use is written at most once per interval, not on every request
+	apiKeyTouchInterval = time.Minute
+)
+
+// Key like "bk_x7k2m9qa_<secret>", the part before the secret is stored as visible prefix
+func generateAPIKey() (string, string, error) {
+	id := strings.Builder{}
+	max := big.NewInt(int64(len(apiKeyAlphabet)))
+
+	for i := 0; i < apiKeyIdChars; i++ {
+		n, err := rand.Int(rand.Reader, max)
+
+		if err != nil {
+			return "", "", err
+		}
+
+		id.WriteByte(apiKeyAlphabet[n.Int64()])
+	}
+
+	secret, err := helper.GenerateToken(32)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	prefix := apiKeyPrefix + id.String()
+
+	return prefix + "_" + secret, prefix, nil
+}
+
+// Check every scope is a permission the user has
+func checkAPIKeyScopes(userId int, scopes []string) error {
+	permissions, err := GetUserPermissions(context.Background(), userId)
+
+	if err != nil {
+		return err
+	}
+
+	granted := map[string]bool{}
+
+	for _, p := range permissions {
+		granted[p] = true
+	}
+
+	for _, scope := range scopes {
+		if !granted[scope] {
+			return fmt.Errorf("%w: %s", ErrAPIKeyScope, scope)
+		}
+	}
+
+	return nil
+}
+
+// Create API key of user limited to scopes, the key is only returned here
+func CreateAPIKey(userId int, payload *models.APIKeyRequestModel) (*models.APIKeyModel, error) {
+	if err := checkAPIKeyScopes(userId, payload.Scopes); err != nil {
+		return nil, err
+	}
+
+	key, prefix, err := generateAPIKey()
+
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey := models.APIKeyModel{
+		UserID:    userId,
+		Name:      strings.TrimSpace(payload.Name),
+		Prefix:    prefix,
+		KeyHash:   helper.HashToken(key),
+		Scopes:    payload.Scopes,
+		ExpiresAt: payload.ExpiresAt,
+	}
+
+	if err := db.Table(apiKey.TableName()).Create(&apiKey).Error; err != nil {
+		return nil, err
+	}
+
+	apiKey.Key = key
+
+	return &apiKey, nil
+}
+
+// Find API keys of user, newest first
+func GetAPIKeys(userId int) (*models.APIKeyListModel, error) {
+	list := &models.APIKeyListModel{Keys: []models.APIKeyModel{}}
+
+	res := db.Table((&models.APIKeyModel{}).TableName()).Where("userId = ?", userId).Order("id DESC").Find(&list.Keys)
+
+	return list, res.Error
+}
+
+func getActiveAPIKey(userId int, id int) (*models.APIKeyModel, error) {
+	apiKey := models.APIKeyModel{}
+
+	res := db.Table(apiKey.TableName()).Where("id = ? AND userId = ? AND revokedAt IS NULL", id, userId).First(&apiKey)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return &apiKey, res.Error
+}
+
+// Change name and scopes of API key
+func UpdateAPIKey(userId int, id int, payload *models.APIKeyUpdateModel) (*models.APIKeyModel, error) {
+	apiKey, err := getActiveAPIKey(userId, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkAPIKeyScopes(userId, payload.Scopes); err != nil {
+		return nil, err
+	}
+
+	apiKey.Name = strings.TrimSpace(payload.Name)
+	apiKey.Scopes = payload.Scopes
+
+	res := db.Table(apiKey.TableName()).Where("id = ?", apiKey.ID).
+		Updates(map[string]interface{}{"name": apiKey.Name, "scopes": apiKey.Scopes, "updatedAt": time.Now()})
+
+	return apiKey, res.Error
+}
+
+// Revoke API key, it can't be used anymore
+func RevokeAPIKey(userId int, id int) error {
+	res := db.Table((&models.APIKeyModel{}).TableName()).
+		Where("id = ? AND userId = ? AND revokedAt IS NULL", id, userId).
+		Update("revokedAt", time.Now())
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// Find identity of API key used from ip.
+// Scopes are limited to the current permissions of the user, so removing a role also limits its keys.
+func VerifyAPIKey(key string, ip string) (*models.APIKeyIdentityModel, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	apiKey := models.APIKeyModel{}
+
+	res := db.Table(apiKey.TableName()).Where("keyHash = ?", helper.HashToken(key)).First(&apiKey)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	now := time.Now()
+
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(now)) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	user, err := GetUserByID(context.Background(), apiKey.UserID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := GetUserRoles(user.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := GetUserPermissions(context.Background(), user.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := (&helper.Identity{Scopes: apiKey.Scopes}).Limit(permissions)
+
+	// the key keeps at least one scope, an empty list would mean unlimited
+	if len(scopes) == 0 {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	db.Table(apiKey.TableName()).
+		Where("id = ? AND (lastUsedAt IS NULL OR lastUsedAt < ?)", apiKey.ID, now.Add(-apiKeyTouchInterval)).
+		Updates(map[string]interface{}{"lastUsedAt": now, "lastUsedIp": ip})
+
+	return &models.APIKeyIdentityModel{
+		KeyID:  apiKey.ID,
+		UserID: user.ID,
+		Email:  user.Email,
+		Roles:  roles,
+		Scopes: scopes,
+	}, nil
+}
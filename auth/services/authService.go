@@ -1,11 +1,13 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"os"
 	"time"
 
+	"github.com/ariefsn/book-store/auth/helper"
 	"github.com/ariefsn/book-store/auth/models"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -14,6 +16,10 @@ import (
 
 var db *gorm.DB
 
+var mailer helper.Mailer
+
+var passwordPolicy *helper.PasswordPolicy
+
 // Initiate service and register connection
 func InitService(sqlDb *sql.DB) (err error) {
 	newLogger := logger.New(
@@ -36,6 +42,22 @@ func InitService(sqlDb *sql.DB) (err error) {
 		return err
 	}
 
+	if err = helper.InstrumentDB(db, "auth"); err != nil {
+		return err
+	}
+
+	if mailer, err = helper.NewMailer(); err != nil {
+		return err
+	}
+
+	if passwordPolicy, err = helper.NewPasswordPolicy(); err != nil {
+		return err
+	}
+
+	if err = initRoles(); err != nil {
+		return err
+	}
+
 	// initiate admin user
 	admin := models.DefaultAdminUser()
 
@@ -46,17 +68,17 @@ func InitService(sqlDb *sql.DB) (err error) {
 	}
 
 	if user.Email != admin.Email {
-		CreateUser(admin)
+		insertUser(admin)
 	}
 
 	return nil
 }
 
 // Find user by id
-func GetUserByID(id int) (*models.UserModel, error) {
+func GetUserByID(ctx context.Context, id int) (*models.UserModel, error) {
 	user := models.NewUserModel()
 
-	res := db.Table(user.TableName()).Where("id = ?", id).First(&user)
+	res := db.WithContext(ctx).Table(user.TableName()).Where("id = ?", id).First(&user)
 
 	return user, res.Error
 }
@@ -70,27 +92,147 @@ func GetUserByEmail(email string) (*models.UserModel, error) {
 	return user, res.Error
 }
 
-// Find all users
-func GetUsers() ([]models.UserModel, error) {
-	users := []models.UserModel{}
+// Find users matching filter, one page at a time
+func GetUsers(filter *models.UserFilterModel, page *helper.Pagination) (*models.UserListModel, error) {
+	list := &models.UserListModel{
+		Users: []models.UserModel{},
+		Page:  page.Page,
+		Limit: page.Limit,
+	}
+
+	scope := func(tx *gorm.DB) *gorm.DB {
+		if filter.Email != "" {
+			tx = tx.Where("email LIKE ?", "%"+filter.Email+"%")
+		}
 
-	res := db.Table(models.NewUserModel().TableName()).Find(&users)
+		if filter.Name != "" {
+			tx = tx.Where("CONCAT_WS(' ', firstName, lastName) LIKE ?", "%"+filter.Name+"%")
+		}
 
-	return users, res.Error
+		if filter.IsAdmin != nil {
+			tx = tx.Where("isAdmin = ?", *filter.IsAdmin)
+		}
+
+		return tx
+	}
+
+	table := models.NewUserModel().TableName()
+
+	if res := db.Table(table).Scopes(scope).Count(&list.Total); res.Error != nil {
+		return nil, res.Error
+	}
+
+	if res := db.Table(table).Scopes(scope, page.Scope).Find(&list.Users); res.Error != nil {
+		return nil, res.Error
+	}
+
+	list.NextCursor = page.Paginate(&list.Users)
+
+	return list, nil
 }
 
-// Create new user
+// Create new user, the password is checked against the policy and hashed.
+// New users are customers, admin is only granted by assigning the role.
 func CreateUser(user *models.UserModel) (int64, error) {
+	user.IsAdmin = false
+
+	hash, err := hashNewPassword(user.Password)
+
+	if err != nil {
+		return 0, err
+	}
+
+	user.Password = hash
+
+	return insertUser(user)
+}
+
+// Create user who registered themselves
+func RegisterUser(user *models.UserModel) (int64, error) {
+	id, err := CreateUser(user)
+
+	if err == nil {
+		registrations.Inc()
+	}
+
+	return id, err
+}
+
+func insertUser(user *models.UserModel) (int64, error) {
 	res := db.Table(user.TableName()).Create(&user)
 
-	return res.RowsAffected, res.Error
+	if res.Error != nil {
+		return res.RowsAffected, res.Error
+	}
+
+	return res.RowsAffected, assignDefaultRole(user)
 }
 
-// Update user
-func UpdateUser(id int, data *models.UserModel) int64 {
-	res := db.Where("id = ?", id).Save(&data)
+// Update fields of user which are sent, password is changed only when given.
+// Changed email is unverified again and a new verification is sent to it.
+// Two-factor state and roles only change through their own flows.
+func UpdateUser(id int, data *models.UserUpdateModel) (int64, error) {
+	current, err := GetUserByID(context.Background(), id)
 
-	return res.RowsAffected
+	if err != nil {
+		return 0, err
+	}
+
+	return updateUser(current, data)
+}
+
+// Update user itself, changing password or email needs the current password,
+// so an access token alone isn't enough to take over the account
+func UpdateOwnUser(id int, data *models.UserUpdateModel) (int64, error) {
+	current, err := GetUserByID(context.Background(), id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	emailChanged := data.Email != nil && *data.Email != current.Email
+
+	if (data.Password != "" || emailChanged) && (data.CurrentPassword == "" || !helper.CheckPasswordHash(data.CurrentPassword, current.Password)) {
+		return 0, ErrCurrentPassword
+	}
+
+	return updateUser(current, data)
+}
+
+func updateUser(current *models.UserModel, data *models.UserUpdateModel) (int64, error) {
+	fields := data.Fields()
+	fields["updatedAt"] = time.Now()
+
+	if data.Password != "" {
+		hash, err := hashNewPassword(data.Password)
+
+		if err != nil {
+			return 0, err
+		}
+
+		fields["password"] = hash
+	}
+
+	emailChanged := data.Email != nil && *data.Email != current.Email
+
+	if emailChanged {
+		fields["emailVerifiedAt"] = nil
+	}
+
+	res := db.Table(current.TableName()).Where("id = ?", current.ID).Updates(fields)
+
+	if res.Error != nil || !emailChanged {
+		return res.RowsAffected, res.Error
+	}
+
+	current.Email = *data.Email
+	current.EmailVerifiedAt = nil
+
+	if data.FirstName != nil {
+		current.FirstName = *data.FirstName
+	}
+
+	return res.RowsAffected, SendVerification(current)
 }
 
 // Delete user
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLoginFailed = errors.New("wrong email or password")
+	ErrLoginLocked = errors.New("too many failed login attempts, try again later")
+)
+
+// Hash compared for unknown emails, so response time doesn't tell which emails are registered
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+type lockoutPolicy struct {
+	threshold int
+	base      time.Duration
+	max       time.Duration
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+
+	return fallback
+}
+
+// Lockout of an account, configurable through LOGIN_MAX_FAILURES, LOGIN_LOCKOUT_BASE and LOGIN_LOCKOUT_MAX
+func accountLockout() lockoutPolicy {
+	return lockoutPolicy{
+		threshold: envInt("LOGIN_MAX_FAILURES", 5),
+		base:      envDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+		max:       envDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+	}
+}
+
+// Lockout of an IP, failures within LOGIN_IP_WINDOW are counted against LOGIN_MAX_IP_FAILURES
+func ipLockout() lockoutPolicy {
+	return lockoutPolicy{
+		threshold: envInt("LOGIN_MAX_IP_FAILURES", 20),
+		base:      envDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+		max:       envDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+	}
+}
+
+func loginIpWindow() time.Duration {
+	return envDuration("LOGIN_IP_WINDOW", 15*time.Minute)
+}
+
+// Time to wait after the last failure, doubled by every failure from threshold on and capped by max
+func LockoutDelay(failures int, threshold int, base time.Duration, max time.Duration) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+
+	delay := base
+
+	for i := threshold; i < failures; i++ {
+		delay *= 2
+
+		if delay >= max {
+			return max
+		}
+	}
+
+	if delay > max {
+		return max
+	}
+
+	return delay
+}
+
+func (p lockoutPolicy) until(failures int, last sql.NullTime) time.Time {
+	if !last.Valid {
+		return time.Time{}
+	}
+
+	return last.Time.Add(LockoutDelay(failures, p.threshold, p.base, p.max))
+}
+
+// Check password of user with the email.
+// Failures are counted per email since the last success or unlock, and per IP within a window,
+// both lock further attempts with exponential backoff before the password is compared.
+func Login(email string, password string, ip string, userAgent string) (*models.UserModel, time.Duration, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	attempt := models.LoginAttemptModel{Email: email, IP: ip, UserAgent: truncate(userAgent, 255)}
+
+	lockedUntil, err := loginLockedUntil(email, ip)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if wait := time.Until(lockedUntil); wait > 0 {
+		attempt.Outcome = models.LoginLocked
+
+		return nil, wait, recordLoginAttempt(&attempt, ErrLoginLocked)
+	}
+
+	user, err := GetUserByEmail(email)
+
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, err
+	}
+
+	if err != nil {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = helper.HashPassword("dummy password")
+		})
+
+		helper.CheckPasswordHash(password, dummyHash)
+
+		attempt.Outcome = models.LoginFailure
+
+		return nil, 0, recordLoginAttempt(&attempt, ErrLoginFailed)
+	}
+
+	attempt.UserID = &user.ID
+
+	if !helper.CheckPasswordHash(password, user.Password) {
+		attempt.Outcome = models.LoginFailure
+
+		return nil, 0, recordLoginAttempt(&attempt, ErrLoginFailed)
+	}
+
+	attempt.Outcome = models.LoginSuccess
+
+	if err := recordLoginAttempt(&attempt, nil); err != nil {
+		return nil, 0, err
+	}
+
+	if helper.PasswordNeedsRehash(user.Password) {
+		rehashPassword(user, password)
+	}
+
+	return user, 0, nil
+}
+
+// Replace hash of older algorithm or cost while the plain password is known.
+// Failing is harmless, the old hash still works.
+func rehashPassword(user *models.UserModel, password string) {
+	hash, err := helper.HashPassword(password)
+
+	if err != nil {
+		return
+	}
+
+	// a password changed meanwhile isn't overwritten
+	res := db.Table(user.TableName()).Where("id = ? AND password = ?", user.ID, user.Password).Update("password", hash)
+
+	if res.Error == nil && res.RowsAffected > 0 {
+		user.Password = hash
+	}
+}
+
+// End of lockout of email and IP, zero when neither is locked
+func loginLockedUntil(email string, ip string) (time.Time, error) {
+	table := (&models.LoginAttemptModel{}).TableName()
+
+	var failures int
+	var last sql.NullTime
+
+	row := db.Table(table).
+		Select("COUNT(*), MAX(createdAt)").
+		Where("email = ? AND outcome = ?", email, models.LoginFailure).
+		Where("id > COALESCE((SELECT MAX(id) FROM login_attempts WHERE email = ? AND outcome IN ?), 0)", email, []string{models.LoginSuccess, models.LoginUnlocked}).
+		Row()
+
+	if err := row.Scan(&failures, &last); err != nil {
+		return time.Time{}, err
+	}
+
+	until := accountLockout().until(failures, last)
+
+	row = db.Table(table).
+		Select("COUNT(*), MAX(createdAt)").
+		Where("ip = ? AND outcome = ? AND createdAt > ?", ip, models.LoginFailure, time.Now().Add(-loginIpWindow())).
+		Row()
+
+	if err := row.Scan(&failures, &last); err != nil {
+		return time.Time{}, err
+	}
+
+	if ipUntil := ipLockout().until(failures, last); ipUntil.After(until) {
+		until = ipUntil
+	}
+
+	return until, nil
+}
+
+// Store attempt and return result, storing failure takes precedence
+func recordLoginAttempt(attempt *models.LoginAttemptModel, result error) error {
+	if attempt.Outcome != models.LoginUnlocked {
+		logins.WithLabelValues(attempt.Outcome).Inc()
+	}
+
+	if res := db.Table(attempt.TableName()).Create(attempt); res.Error != nil {
+		return res.Error
+	}
+
+	return result
+}
+
+// Lift lockout of user, failures before it aren't counted anymore
+func UnlockUser(userId int, ip string, userAgent string) error {
+	user, err := GetUserByID(context.Background(), userId)
+
+	if err != nil {
+		return err
+	}
+
+	attempt := models.LoginAttemptModel{
+		UserID:    &user.ID,
+		Email:     strings.ToLower(user.Email),
+		IP:        ip,
+		UserAgent: truncate(userAgent, 255),
+		Outcome:   models.LoginUnlocked,
+	}
+
+	return recordLoginAttempt(&attempt, nil)
+}
+
+// Find login attempts of user, one page at a time
+func GetLoginAttempts(userId int, page *helper.Pagination) (*models.LoginAttemptListModel, error) {
+	list := &models.LoginAttemptListModel{
+		Attempts: []models.LoginAttemptModel{},
+		Page:     page.Page,
+		Limit:    page.Limit,
+	}
+
+	user, err := GetUserByID(context.Background(), userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	table := (&models.LoginAttemptModel{}).TableName()
+
+	// attempts with unknown password are recorded by email only
+	scope := func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("userId = ? OR email = ?", user.ID, strings.ToLower(user.Email))
+	}
+
+	if res := db.Table(table).Scopes(scope).Count(&list.Total); res.Error != nil {
+		return nil, res.Error
+	}
+
+	if res := db.Table(table).Scopes(scope, page.Scope).Find(&list.Attempts); res.Error != nil {
+		return nil, res.Error
+	}
+
+	list.NextCursor = page.Paginate(&list.Attempts)
+
+	return list, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+
+	return s
+}
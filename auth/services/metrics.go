@@ -0,0 +1,19 @@
+package services
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Business counters, served with the request metrics at /metrics
+var (
+	registrations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auth_registrations_total",
+		Help: "Users who registered themselves.",
+	})
+
+	logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Logins with email and password, by outcome: success, failure or locked.",
+	}, []string{"outcome"})
+)
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"gorm.io/gorm"
+)
+
+var ErrOAuthClientNotFound = fmt.Errorf("client %w", helper.ErrNotFound)
+
+// Error codes of OAuth 2.0, invalid_redirect_uri is ours for requests which can't be redirected back
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthInvalidRedirectURI      = "invalid_redirect_uri"
+	OAuthAccessDenied            = "access_denied"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+)
+
+// Error of the OAuth protocol, the code is sent to the client as is
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code string, description string) error {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// Lifetime of authorization code, configurable through OAUTH_CODE_TTL
+func oauthCodeTTL() time.Duration {
+	return envDuration("OAUTH_CODE_TTL", time.Minute)
+}
+
+// Find registered clients
+func GetOAuthClients() (*models.OAuthClientListModel, error) {
+	list := &models.OAuthClientListModel{Clients: []models.OAuthClientModel{}}
+
+	res := db.Table((&models.OAuthClientModel{}).TableName()).Order("id").Find(&list.Clients)
+
+	return list, res.Error
+}
+
+func getOAuthClient(clientId string) (*models.OAuthClientModel, error) {
+	client := models.OAuthClientModel{}
+
+	res := db.Table(client.TableName()).Where("clientId = ?", clientId).First(&client)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrOAuthClientNotFound
+	}
+
+	return &client, res.Error
+}
+
+// Register client, the secret of confidential clients is only returned here
+func CreateOAuthClient(payload *models.OAuthClientRequestModel) (*models.OAuthClientModel, error) {
+	clientId, err := helper.GenerateToken(16)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := models.OAuthClientModel{
+		ClientID:     clientId,
+		Name:         payload.Name,
+		RedirectURIs: payload.RedirectURIs,
+		Scopes:       payload.Scopes,
+		Public:       payload.Public,
+	}
+
+	if !client.Public {
+		client.Secret, err = helper.GenerateToken(32)
+
+		if err != nil {
+			return nil, err
+		}
+
+		client.SecretHash = helper.HashToken(client.Secret)
+	}
+
+	if err := db.Table(client.TableName()).Create(&client).Error; err != nil {
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+// Change name, redirect URIs and scopes of client, a client can't switch between public and confidential
+func UpdateOAuthClient(id int, payload *models.OAuthClientRequestModel) (*models.OAuthClientModel, error) {
+	client := models.OAuthClientModel{}
+
+	res := db.Table(client.TableName()).Where("id = ?", id).First(&client)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrOAuthClientNotFound
+	}
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	client.Name = payload.Name
+	client.RedirectURIs = payload.RedirectURIs
+	client.Scopes = payload.Scopes
+
+	res = db.Table(client.TableName()).Where("id = ?", id).
+		Updates(map[string]interface{}{"name": client.Name, "redirectUris": client.RedirectURIs, "scopes": client.Scopes, "updatedAt": time.Now()})
+
+	return &client, res.Error
+}
+
+// Delete client with its consents and codes
+func DeleteOAuthClient(id int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		client := models.OAuthClientModel{}
+
+		res := tx.Table(client.TableName()).Where("id = ?", id).First(&client)
+
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return ErrOAuthClientNotFound
+		}
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if err := tx.Table((&models.OAuthConsentModel{}).TableName()).Where("clientId = ?", client.ClientID).Delete(&models.OAuthConsentModel{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Table((&models.OAuthCodeModel{}).TableName()).Where("clientId = ?", client.ClientID).Delete(&models.OAuthCodeModel{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Table(client.TableName()).Where("id = ?", id).Delete(&client).Error
+	})
+}
+
+// Validate authorization request, errors with code invalid_client or invalid_redirect_uri must not be redirected
+func CheckAuthorizeRequest(payload *models.OAuthAuthorizeModel, userId int) (*models.OAuthRequestInfoModel, error) {
+	client, err := getOAuthClient(payload.ClientID)
+
+	if errors.Is(err, ErrOAuthClientNotFound) {
+		return nil, oauthError(OAuthInvalidClient, "unknown client")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !containsString(client.RedirectURIs, payload.RedirectURI) {
+		return nil, oauthError(OAuthInvalidRedirectURI, "redirect_uri isn't registered for the client")
+	}
+
+	if payload.ResponseType != "code" {
+		return nil, oauthError(OAuthUnsupportedResponseType, "only response_type code is supported")
+	}
+
+	scopes := strings.Fields(payload.Scope)
+
+	if !containsString(scopes, models.ScopeOpenID) {
+		return nil, oauthError(OAuthInvalidScope, "scope must contain openid")
+	}
+
+	for _, scope := range scopes {
+		if !containsString(client.Scopes, scope) {
+			return nil, oauthError(OAuthInvalidScope, "scope "+scope+" isn't allowed for the client")
+		}
+	}
+
+	// PKCE is required for every client, plain challenges aren't accepted
+	if payload.CodeChallengeMethod != "S256" || len(payload.CodeChallenge) < 43 || len(payload.CodeChallenge) > 128 {
+		return nil, oauthError(OAuthInvalidRequest, "code_challenge with code_challenge_method S256 is required")
+	}
+
+	if len(payload.Nonce) > 255 {
+		return nil, oauthError(OAuthInvalidRequest, "nonce is too long")
+	}
+
+	info := &models.OAuthRequestInfoModel{
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		Scopes:     scopes,
+	}
+
+	if userId > 0 {
+		consent := models.OAuthConsentModel{}
+
+		res := db.Table(consent.TableName()).Where("userId = ? AND clientId = ?", userId, client.ClientID).First(&consent)
+
+		if res.Error != nil && !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, res.Error
+		}
+
+		info.Consented = res.Error == nil && len((&helper.Identity{Scopes: consent.Scopes}).Limit(scopes)) == len(scopes)
+	}
+
+	return info, nil
+}
+
+// Answer authorization request of user, approving stores the consent and issues a single use code
+func AuthorizeOAuth(userId int, payload *models.OAuthAuthorizeModel) (string, error) {
+	info, err := CheckAuthorizeRequest(payload, userId)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !payload.Approve {
+		return "", oauthError(OAuthAccessDenied, "user denied the request")
+	}
+
+	plain, err := helper.GenerateToken(32)
+
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(oauthCodeTTL())
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		consent := models.OAuthConsentModel{UserID: userId, ClientID: info.ClientID, Scopes: info.Scopes}
+
+		if err := tx.Table(consent.TableName()).Where("userId = ? AND clientId = ?", userId, info.ClientID).Delete(&consent).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Table(consent.TableName()).Create(&consent).Error; err != nil {
+			return err
+		}
+
+		code := models.OAuthCodeModel{
+			CodeHash:      helper.HashToken(plain),
+			ClientID:      info.ClientID,
+			UserID:        userId,
+			RedirectURI:   payload.RedirectURI,
+			Scopes:        info.Scopes,
+			Nonce:         payload.Nonce,
+			CodeChallenge: payload.CodeChallenge,
+			AuthTime:      &now,
+			ExpiresAt:     &expiresAt,
+		}
+
+		return tx.Table(code.TableName()).Create(&code).Error
+	})
+
+	return plain, err
+}
+
+// PKCE S256: challenge is base64url(sha256(verifier))
+func verifyCodeChallenge(verifier string, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// Check client credentials, public clients authenticate with PKCE only
+func authenticateOAuthClient(clientId string, secret string) (*models.OAuthClientModel, error) {
+	client, err := getOAuthClient(clientId)
+
+	if errors.Is(err, ErrOAuthClientNotFound) {
+		return nil, oauthError(OAuthInvalidClient, "unknown client")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.Public && subtle.ConstantTimeCompare([]byte(helper.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, oauthError(OAuthInvalidClient, "invalid client credentials")
+	}
+
+	return client, nil
+}
+
+// Exchange authorization code for the grant the gateway signs tokens from, a code works only once
+func ExchangeOAuthCode(payload *models.OAuthCodeRequestModel) (*models.OAuthGrantModel, error) {
+	client, err := authenticateOAuthClient(payload.ClientID, payload.ClientSecret)
+
+	if err != nil {
+		return nil, err
+	}
+
+	code := models.OAuthCodeModel{}
+
+	res := db.Table(code.TableName()).Where("codeHash = ?", helper.HashToken(payload.Code)).First(&code)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, oauthError(OAuthInvalidGrant, "invalid authorization code")
+	}
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	now := time.Now()
+
+	res = db.Table(code.TableName()).Where("id = ? AND usedAt IS NULL", code.ID).Update("usedAt", now)
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	if res.RowsAffected == 0 || code.ExpiresAt.Before(now) {
+		return nil, oauthError(OAuthInvalidGrant, "authorization code expired or already used")
+	}
+
+	if code.ClientID != client.ClientID || code.RedirectURI != payload.RedirectURI {
+		return nil, oauthError(OAuthInvalidGrant, "authorization code was issued to another client or redirect_uri")
+	}
+
+	if !verifyCodeChallenge(payload.CodeVerifier, code.CodeChallenge) {
+		return nil, oauthError(OAuthInvalidGrant, "invalid code_verifier")
+	}
+
+	user, err := GetUserByID(context.Background(), code.UserID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, oauthError(OAuthInvalidGrant, "user doesn't exist anymore")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OAuthGrantModel{
+		UserID:   user.ID,
+		ClientID: client.ClientID,
+		Scopes:   code.Scopes,
+		Nonce:    code.Nonce,
+		AuthTime: code.AuthTime.Unix(),
+		Claims:   user.Claims(code.Scopes),
+	}, nil
+}
+
+// Claims of user released by the scopes of an access token
+func GetUserInfo(userId int, scopes []string) (map[string]interface{}, error) {
+	user, err := GetUserByID(context.Background(), userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user.Claims(scopes), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
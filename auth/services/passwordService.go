@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrResetTokenInvalid = errors.New("invalid or expired reset token")
+	ErrPasswordEmpty     = errors.New("password can't be empty")
+	ErrCurrentPassword   = errors.New("current password is wrong")
+)
+
+// Lifetime of password reset token, configurable through PASSWORD_RESET_TTL
+func passwordResetTTL() time.Duration {
+	ttl := time.Hour
+
+	if d, err := time.ParseDuration(os.Getenv("PASSWORD_RESET_TTL")); err == nil && d > 0 {
+		ttl = d
+	}
+
+	return ttl
+}
+
+// Page the reset link points to, configurable through PASSWORD_RESET_URL
+func passwordResetUrl() string {
+	url := "http://localhost:3001/auth/password/reset"
+
+	if os.Getenv("PASSWORD_RESET_URL") != "" {
+		url = os.Getenv("PASSWORD_RESET_URL")
+	}
+
+	return url
+}
+
+// Send reset link to user with the email.
+// Unknown emails are ignored silently, so the response doesn't tell which emails are registered.
+func ForgotPassword(email string) error {
+	user, err := GetUserByEmail(email)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	plain, err := helper.GenerateToken(32)
+
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(passwordResetTTL())
+
+	reset := models.NewPasswordResetModel()
+	reset.UserID = user.ID
+	reset.TokenHash = helper.HashToken(plain)
+	reset.ExpiresAt = &expiresAt
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// only the latest link works
+		res := tx.Table(reset.TableName()).
+			Where("userId = ? AND usedAt IS NULL", user.ID).
+			Update("usedAt", time.Now())
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		return tx.Table(reset.TableName()).Create(&reset).Error
+	})
+
+	if err != nil {
+		return err
+	}
+
+	mail := helper.Mail{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\r\n\r\nOpen the link below to choose a new password, it expires at %s.\r\n\r\n%s?token=%s\r\n\r\nIf you didn't ask for it, just ignore this email.\r\n",
+			user.FirstName, expiresAt.Format(time.RFC1123), passwordResetUrl(), plain,
+		),
+	}
+
+	// sent in background, response time doesn't depend on the mail server
+	go func() {
+		if err := mailer.Send(mail); err != nil {
+			fmt.Println("[Error] send password reset mail:", err.Error())
+		}
+	}()
+
+	return nil
+}
+
+// Set new password with reset token, the token can be used once.
+// Every session of the user is revoked.
+func ResetPassword(plain string, password string) error {
+	reset := models.NewPasswordResetModel()
+
+	res := db.Table(reset.TableName()).Where("tokenHash = ?", helper.HashToken(plain)).First(&reset)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return ErrResetTokenInvalid
+	}
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if reset.UsedAt != nil || reset.ExpiresAt == nil || reset.ExpiresAt.Before(time.Now()) {
+		return ErrResetTokenInvalid
+	}
+
+	hash, err := hashNewPassword(password)
+
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// only one concurrent request may consume the token
+		res := tx.Table(reset.TableName()).
+			Where("id = ? AND usedAt IS NULL", reset.ID).
+			Update("usedAt", time.Now())
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return ErrResetTokenInvalid
+		}
+
+		res = tx.Table(models.NewUserModel().TableName()).
+			Where("id = ?", reset.UserID).
+			Update("password", hash)
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		return revokeUserTokens(tx, reset.UserID)
+	})
+}
+
+// Hash password chosen by user, it must follow the password policy
+func hashNewPassword(password string) (string, error) {
+	if password == "" {
+		return "", ErrPasswordEmpty
+	}
+
+	if err := passwordPolicy.Validate(password); err != nil {
+		return "", err
+	}
+
+	return helper.HashPassword(password)
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ariefsn/book-store/auth/models"
+	"gorm.io/gorm"
+)
+
+var ErrUnknownRole = errors.New("unknown role")
+
+// Seed default roles and permissions, existing users without role are migrated from isAdmin flag
+func initRoles() error {
+	permissionIds := map[string]int{}
+
+	for _, p := range models.DefaultPermissions() {
+		permission := p
+
+		res := db.Table(permission.TableName()).Where("name = ?", permission.Name).FirstOrCreate(&permission)
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		permissionIds[permission.Name] = permission.ID
+	}
+
+	for _, r := range models.DefaultRoles() {
+		role := r
+
+		res := db.Table(role.TableName()).Where("name = ?", role.Name).FirstOrCreate(&role)
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		for _, name := range r.Permissions {
+			rolePermission := models.RolePermissionModel{RoleID: role.ID, PermissionID: permissionIds[name]}
+
+			res := db.Table(rolePermission.TableName()).Where(&rolePermission).FirstOrCreate(&rolePermission)
+
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+	}
+
+	admin, err := GetRoleByName(models.RoleAdmin)
+
+	if err != nil {
+		return err
+	}
+
+	customer, err := GetRoleByName(models.RoleCustomer)
+
+	if err != nil {
+		return err
+	}
+
+	userRoles := (&models.UserRoleModel{}).TableName()
+	users := models.NewUserModel().TableName()
+
+	res := db.Exec(
+		fmt.Sprintf("INSERT INTO %s (userId, roleId) SELECT id, IF(isAdmin, ?, ?) FROM %s WHERE id NOT IN (SELECT userId FROM %s)", userRoles, users, userRoles),
+		admin.ID, customer.ID,
+	)
+
+	return res.Error
+}
+
+// Find role by name
+func GetRoleByName(name string) (*models.RoleModel, error) {
+	role := models.NewRoleModel()
+
+	res := db.Table(role.TableName()).Where("name = ?", name).First(&role)
+
+	return role, res.Error
+}
+
+// Update settings of role
+func UpdateRoleSetting(id int, setting models.RoleSettingModel) (*models.RoleModel, error) {
+	role := models.NewRoleModel()
+
+	if res := db.Table(role.TableName()).Where("id = ?", id).First(&role); res.Error != nil {
+		return nil, res.Error
+	}
+
+	role.RequireTwoFactor = *setting.RequireTwoFactor
+
+	res := db.Table(role.TableName()).Where("id = ?", id).Update("requireTwoFactor", role.RequireTwoFactor)
+
+	return role, res.Error
+}
+
+// Find all roles with their permissions
+func GetRoles() ([]models.RoleModel, error) {
+	roles := []models.RoleModel{}
+
+	res := db.Table(models.NewRoleModel().TableName()).Find(&roles)
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	for i := range roles {
+		permissions := []string{}
+
+		res := db.Table((&models.PermissionModel{}).TableName()+" p").
+			Joins("JOIN role_permissions rp ON rp.permissionId = p.id").
+			Where("rp.roleId = ?", roles[i].ID).
+			Order("p.name").
+			Pluck("p.name", &permissions)
+
+		if res.Error != nil {
+			return nil, res.Error
+		}
+
+		roles[i].Permissions = permissions
+	}
+
+	return roles, nil
+}
+
+// Find role names of user
+func GetUserRoles(userId int) ([]string, error) {
+	roles := []string{}
+
+	res := db.Table(models.NewRoleModel().TableName()+" r").
+		Joins("JOIN user_roles ur ON ur.roleId = r.id").
+		Where("ur.userId = ?", userId).
+		Order("r.name").
+		Pluck("r.name", &roles)
+
+	return roles, res.Error
+}
+
+// Find permission names granted to user through its roles
+func GetUserPermissions(ctx context.Context, userId int) ([]string, error) {
+	permissions := []string{}
+
+	res := db.WithContext(ctx).Table((&models.PermissionModel{}).TableName()+" p").
+		Joins("JOIN role_permissions rp ON rp.permissionId = p.id").
+		Joins("JOIN user_roles ur ON ur.roleId = rp.roleId").
+		Where("ur.userId = ?", userId).
+		Distinct().
+		Order("p.name").
+		Pluck("p.name", &permissions)
+
+	return permissions, res.Error
+}
+
+// Replace roles assigned to user
+func SetUserRoles(userId int, names []string) error {
+	unique := map[string]bool{}
+
+	for _, name := range names {
+		unique[name] = true
+	}
+
+	roles := []models.RoleModel{}
+
+	if len(unique) > 0 {
+		res := db.Table(models.NewRoleModel().TableName()).Where("name IN ?", names).Find(&roles)
+
+		if res.Error != nil {
+			return res.Error
+		}
+	}
+
+	if len(roles) != len(unique) {
+		return ErrUnknownRole
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		userRole := models.UserRoleModel{}
+
+		if err := tx.Table(userRole.TableName()).Where("userId = ?", userId).Delete(&userRole).Error; err != nil {
+			return err
+		}
+
+		for _, role := range roles {
+			userRole := models.UserRoleModel{UserID: userId, RoleID: role.ID}
+
+			if err := tx.Table(userRole.TableName()).Create(&userRole).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Assign initial role to new user, admin only for the seeded administrator
+func assignDefaultRole(user *models.UserModel) error {
+	name := models.RoleCustomer
+
+	if user.IsAdmin {
+		name = models.RoleAdmin
+	}
+
+	return SetUserRoles(user.ID, []string{name})
+}
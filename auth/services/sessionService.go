@@ -0,0 +1,203 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"gorm.io/gorm"
+)
+
+var ErrSessionNotFound = fmt.Errorf("session %w", helper.ErrNotFound)
+
+// last seen is written at most once per interval, not on every request
+const sessionTouchInterval = time.Minute
+
+// Browsers and systems recognized in user agents, the first match wins so more specific names come first
+var (
+	userAgentBrowsers = [][2]string{{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"}}
+	userAgentSystems  = [][2]string{{"Windows", "Windows"}, {"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"}, {"Mac OS X", "macOS"}, {"Linux", "Linux"}}
+)
+
+// Short device description of user agent, e.g. "Firefox on Windows"
+func DescribeDevice(userAgent string) string {
+	browser, system := "", ""
+
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b[0]) {
+			browser = b[1]
+			break
+		}
+	}
+
+	for _, s := range userAgentSystems {
+		if strings.Contains(userAgent, s[0]) {
+			system = s[1]
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+
+	return "Unknown device"
+}
+
+// Issue refresh token of a new family and track it as session of the device
+func StartSession(userId int, ip string, userAgent string) (*models.TokenModel, error) {
+	var token *models.TokenModel
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+
+		token, err = startSession(tx, userId, ip, userAgent)
+
+		return err
+	})
+
+	return token, err
+}
+
+func startSession(tx *gorm.DB, userId int, ip string, userAgent string) (*models.TokenModel, error) {
+	token, err := createRefreshToken(tx, userId, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	session := models.SessionModel{
+		UserID:     userId,
+		FamilyID:   token.FamilyID,
+		Device:     DescribeDevice(userAgent),
+		IP:         truncate(ip, 45),
+		UserAgent:  truncate(userAgent, 255),
+		LastSeenAt: &now,
+	}
+
+	if err := tx.Table(session.TableName()).Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Record activity of session from ip
+func TouchSession(familyId string, ip string) {
+	now := time.Now()
+
+	db.Table((&models.SessionModel{}).TableName()).
+		Where("familyId = ? AND terminatedAt IS NULL AND (lastSeenAt IS NULL OR lastSeenAt < ?)", familyId, now.Add(-sessionTouchInterval)).
+		Updates(map[string]interface{}{"lastSeenAt": now, "ip": truncate(ip, 45)})
+}
+
+// Check session of token family was terminated, families issued before sessions were tracked have none
+func sessionTerminated(familyId string) (bool, error) {
+	var count int64
+
+	res := db.Table((&models.SessionModel{}).TableName()).
+		Where("familyId = ? AND terminatedAt IS NOT NULL", familyId).
+		Count(&count)
+
+	return count > 0, res.Error
+}
+
+// Find active sessions of user, most recently seen first. The session of familyId is marked as current.
+func GetSessions(userId int, familyId string) (*models.SessionListModel, error) {
+	list := &models.SessionListModel{Sessions: []models.SessionModel{}}
+	session := models.SessionModel{}
+	token := models.NewRefreshTokenModel()
+
+	active := db.Table(token.TableName()).Select("1").
+		Where("familyId = "+session.TableName()+".familyId AND revokedAt IS NULL AND expiresAt > ?", time.Now())
+
+	res := db.Table(session.TableName()).
+		Where("userId = ? AND terminatedAt IS NULL AND EXISTS (?)", userId, active).
+		Order("lastSeenAt DESC").
+		Find(&list.Sessions)
+
+	for i := range list.Sessions {
+		list.Sessions[i].Current = familyId != "" && list.Sessions[i].FamilyID == familyId
+	}
+
+	return list, res.Error
+}
+
+// Terminate sessions matching the condition and revoke their tokens, returns the number of sessions
+func terminateSessions(tx *gorm.DB, query string, args ...interface{}) (int64, error) {
+	sessions := []models.SessionModel{}
+
+	res := tx.Table((&models.SessionModel{}).TableName()).Where("terminatedAt IS NULL").Where(query, args...).Find(&sessions)
+
+	if res.Error != nil || len(sessions) == 0 {
+		return 0, res.Error
+	}
+
+	familyIds := []string{}
+	ids := []int{}
+
+	for _, s := range sessions {
+		familyIds = append(familyIds, s.FamilyID)
+		ids = append(ids, s.ID)
+	}
+
+	now := time.Now()
+
+	res = tx.Table((&models.SessionModel{}).TableName()).Where("id IN ?", ids).Update("terminatedAt", now)
+
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	res = tx.Table(models.NewRefreshTokenModel().TableName()).
+		Where("familyId IN ? AND revokedAt IS NULL", familyIds).
+		Update("revokedAt", now)
+
+	return int64(len(sessions)), res.Error
+}
+
+// Terminate session of user, its access tokens are rejected by the gateway from now on
+func TerminateSession(userId int, id int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		count, err := terminateSessions(tx, "id = ? AND userId = ?", id, userId)
+
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return ErrSessionNotFound
+		}
+
+		return nil
+	})
+}
+
+// Terminate every session of user, returns the number of terminated sessions
+func TerminateUserSessions(userId int) (int64, error) {
+	var count int64
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+
+		count, err = terminateSessions(tx, "userId = ?", userId)
+
+		if err != nil {
+			return err
+		}
+
+		// families issued before sessions were tracked
+		return revokeUserTokens(tx, userId)
+	})
+
+	return count, err
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTokenInvalid = errors.New("invalid refresh token")
+	ErrTokenExpired = errors.New("refresh token expired")
+	ErrTokenReused  = errors.New("refresh token reused, session revoked")
+)
+
+// Lifetime of refresh token, configurable through REFRESH_TOKEN_TTL
+func refreshTokenTTL() time.Duration {
+	ttl := 30 * 24 * time.Hour
+
+	if d, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL")); err == nil && d > 0 {
+		ttl = d
+	}
+
+	return ttl
+}
+
+// Issue new refresh token for user, a new family is started when familyId is empty
+func createRefreshToken(tx *gorm.DB, userId int, familyId string) (*models.TokenModel, error) {
+	var err error
+
+	if familyId == "" {
+		familyId, err = helper.GenerateToken(16)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plain, err := helper.GenerateToken(32)
+
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(refreshTokenTTL())
+
+	token := models.NewRefreshTokenModel()
+	token.UserID = userId
+	token.FamilyID = familyId
+	token.TokenHash = helper.HashToken(plain)
+	token.ExpiresAt = &expiresAt
+
+	if res := tx.Table(token.TableName()).Create(&token); res.Error != nil {
+		return nil, res.Error
+	}
+
+	return &models.TokenModel{
+		UserID:       userId,
+		FamilyID:     familyId,
+		RefreshToken: plain,
+		ExpiresAt:    &expiresAt,
+	}, nil
+}
+
+// Exchange refresh token with a new one in the same family, used from ip.
+// Presenting an already rotated token revokes the whole family.
+func RotateRefreshToken(plain string, ip string) (*models.TokenModel, error) {
+	token := models.NewRefreshTokenModel()
+
+	res := db.Table(token.TableName()).Where("tokenHash = ?", helper.HashToken(plain)).First(&token)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrTokenInvalid
+	}
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	if token.RevokedAt != nil {
+		if _, err := RevokeTokenFamily(token.FamilyID); err != nil {
+			return nil, err
+		}
+
+		return nil, ErrTokenReused
+	}
+
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now()) {
+		return nil, ErrTokenExpired
+	}
+
+	// a terminated session can't be continued, even by a token issued concurrently
+	if terminated, err := sessionTerminated(token.FamilyID); err != nil || terminated {
+		if err == nil {
+			err = ErrTokenInvalid
+		}
+
+		return nil, err
+	}
+
+	var newToken *models.TokenModel
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// only one concurrent request may consume the token
+		res := tx.Table(token.TableName()).
+			Where("id = ? AND revokedAt IS NULL", token.ID).
+			Update("revokedAt", time.Now())
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return ErrTokenReused
+		}
+
+		var err error
+
+		newToken, err = createRefreshToken(tx, token.UserID, token.FamilyID)
+
+		return err
+	})
+
+	if errors.Is(err, ErrTokenReused) {
+		if _, revokeErr := RevokeTokenFamily(token.FamilyID); revokeErr != nil {
+			return nil, revokeErr
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	TouchSession(token.FamilyID, ip)
+
+	user, err := GetUserByID(context.Background(), token.UserID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	newToken.Email = user.Email
+	newToken.Roles, err = GetUserRoles(user.ID)
+
+	return newToken, err
+}
+
+// Revoke all active tokens in family, which ends its session
+func RevokeTokenFamily(familyId string) (int64, error) {
+	now := time.Now()
+
+	var rows int64
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(models.NewRefreshTokenModel().TableName()).
+			Where("familyId = ? AND revokedAt IS NULL", familyId).
+			Update("revokedAt", now)
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		rows = res.RowsAffected
+
+		return tx.Table((&models.SessionModel{}).TableName()).
+			Where("familyId = ? AND terminatedAt IS NULL", familyId).
+			Update("terminatedAt", now).Error
+	})
+
+	return rows, err
+}
+
+// Revoke all active tokens of user, which ends every session
+func revokeUserTokens(tx *gorm.DB, userId int) error {
+	now := time.Now()
+
+	res := tx.Table(models.NewRefreshTokenModel().TableName()).
+		Where("userId = ? AND revokedAt IS NULL", userId).
+		Update("revokedAt", now)
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	res = tx.Table((&models.SessionModel{}).TableName()).
+		Where("userId = ? AND terminatedAt IS NULL", userId).
+		Update("terminatedAt", now)
+
+	return res.Error
+}
+
+// Check whether family still has an active token and its session wasn't terminated
+func IsTokenFamilyActive(familyId string) (bool, error) {
+	var count int64
+
+	res := db.Table(models.NewRefreshTokenModel().TableName()).
+		Where("familyId = ? AND revokedAt IS NULL AND expiresAt > ?", familyId, time.Now()).
+		Count(&count)
+
+	if res.Error != nil || count == 0 {
+		return false, res.Error
+	}
+
+	terminated, err := sessionTerminated(familyId)
+
+	return !terminated, err
+}
@@ -0,0 +1,424 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication not enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication not enrolled")
+	ErrTwoFactorRequired    = errors.New("two-factor authentication is required by your role")
+	ErrTwoFactorCodeInvalid = errors.New("invalid two-factor code")
+	ErrChallengeInvalid     = errors.New("invalid or expired login challenge")
+)
+
+const (
+	recoveryCodeCount     = 10
+	challengeTTL          = 5 * time.Minute
+	challengeMaxAttempts  = 5
+	recoveryCodeAlphabet  = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodeHalfChars = 5
+)
+
+// Issuer shown in authenticator apps, configurable through TOTP_ISSUER
+func totpIssuer() string {
+	issuer := "BukuKu"
+
+	if os.Getenv("TOTP_ISSUER") != "" {
+		issuer = os.Getenv("TOTP_ISSUER")
+	}
+
+	return issuer
+}
+
+// Check any role of user requires two-factor authentication
+func RequiresTwoFactor(userId int) (bool, error) {
+	var count int64
+
+	res := db.Table(models.NewRoleModel().TableName()+" r").
+		Joins("JOIN user_roles ur ON ur.roleId = r.id").
+		Where("ur.userId = ? AND r.requireTwoFactor", userId).
+		Count(&count)
+
+	return count > 0, res.Error
+}
+
+// Start enrollment with a new secret, two-factor authentication is enabled once a code is confirmed
+func EnrollTwoFactor(userId int) (*models.TwoFactorEnrollModel, error) {
+	user, err := GetUserByID(context.Background(), userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TotpEnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	return newTwoFactorSecret(user)
+}
+
+func newTwoFactorSecret(user *models.UserModel) (*models.TwoFactorEnrollModel, error) {
+	secret, err := helper.GenerateTOTPSecret()
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := db.Table(user.TableName()).Where("id = ? AND totpEnabledAt IS NULL", user.ID).
+		Updates(map[string]interface{}{"totpSecret": secret, "totpLastStep": 0})
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	return &models.TwoFactorEnrollModel{
+		Secret: secret,
+		URI:    helper.TOTPURI(totpIssuer(), user.Email, secret),
+	}, nil
+}
+
+// Enable two-factor authentication with a code of the enrolled secret, recovery codes are returned once
+func ConfirmTwoFactor(userId int, code string) ([]string, error) {
+	user, err := GetUserByID(context.Background(), userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TotpEnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	var codes []string
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+
+		codes, err = enableTwoFactor(tx, user, code)
+
+		return err
+	})
+
+	return codes, err
+}
+
+func enableTwoFactor(tx *gorm.DB, user *models.UserModel, code string) ([]string, error) {
+	if user.TotpSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := helper.ValidateTOTP(user.TotpSecret, code, time.Now(), user.TotpLastStep)
+
+	if !ok {
+		return nil, ErrTwoFactorCodeInvalid
+	}
+
+	res := tx.Table(user.TableName()).Where("id = ? AND totpEnabledAt IS NULL", user.ID).
+		Updates(map[string]interface{}{"totpEnabledAt": time.Now(), "totpLastStep": step})
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	return replaceRecoveryCodes(tx, user.ID)
+}
+
+// Disable two-factor authentication with a current code or a recovery code
+func DisableTwoFactor(userId int, code string) error {
+	user, err := GetUserByID(context.Background(), userId)
+
+	if err != nil {
+		return err
+	}
+
+	if user.TotpEnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	required, err := RequiresTwoFactor(userId)
+
+	if err != nil {
+		return err
+	}
+
+	if required {
+		return ErrTwoFactorRequired
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := verifyTwoFactorCode(tx, user, code); err != nil {
+			return err
+		}
+
+		res := tx.Table(user.TableName()).Where("id = ?", user.ID).
+			Updates(map[string]interface{}{"totpSecret": nil, "totpEnabledAt": nil, "totpLastStep": 0})
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		return tx.Table((&models.RecoveryCodeModel{}).TableName()).Where("userId = ?", user.ID).Delete(&models.RecoveryCodeModel{}).Error
+	})
+}
+
+// Replace recovery codes of user, a current code or a recovery code is needed
+func RegenerateRecoveryCodes(userId int, code string) ([]string, error) {
+	user, err := GetUserByID(context.Background(), userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TotpEnabledAt == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	var codes []string
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := verifyTwoFactorCode(tx, user, code); err != nil {
+			return err
+		}
+
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+
+		return err
+	})
+
+	return codes, err
+}
+
+// Check code is a TOTP code not used before or an unused recovery code, the code is consumed
+func verifyTwoFactorCode(tx *gorm.DB, user *models.UserModel, code string) error {
+	if step, ok := helper.ValidateTOTP(user.TotpSecret, code, time.Now(), user.TotpLastStep); ok {
+		// codes are accepted once, also by concurrent requests
+		res := tx.Table(user.TableName()).Where("id = ? AND totpLastStep < ?", user.ID, step).Update("totpLastStep", step)
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return ErrTwoFactorCodeInvalid
+		}
+
+		return nil
+	}
+
+	res := tx.Table((&models.RecoveryCodeModel{}).TableName()).
+		Where("userId = ? AND codeHash = ? AND usedAt IS NULL", user.ID, helper.HashToken(normalizeRecoveryCode(code))).
+		Update("usedAt", time.Now())
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrTwoFactorCodeInvalid
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userId int) ([]string, error) {
+	table := (&models.RecoveryCodeModel{}).TableName()
+
+	if err := tx.Table(table).Where("userId = ?", userId).Delete(&models.RecoveryCodeModel{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := []string{}
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+
+		if err != nil {
+			return nil, err
+		}
+
+		recovery := models.RecoveryCodeModel{UserID: userId, CodeHash: helper.HashToken(code)}
+
+		if err := tx.Table(table).Create(&recovery).Error; err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// Recovery code like "k7m2p-x9q4r", without characters which are easy to mix up
+func generateRecoveryCode() (string, error) {
+	code := strings.Builder{}
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+
+	for i := 0; i < recoveryCodeHalfChars*2; i++ {
+		if i == recoveryCodeHalfChars {
+			code.WriteByte('-')
+		}
+
+		n, err := rand.Int(rand.Reader, max)
+
+		if err != nil {
+			return "", err
+		}
+
+		code.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+
+	return code.String(), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.Join(strings.Fields(code), ""))
+}
+
+// Start second step of login when user has two-factor authentication, or must enroll because of its role.
+// Nil challenge means the password is enough.
+func CreateLoginChallenge(user *models.UserModel) (*models.ChallengeModel, error) {
+	enroll := false
+
+	if user.TotpEnabledAt == nil {
+		required, err := RequiresTwoFactor(user.ID)
+
+		if err != nil || !required {
+			return nil, err
+		}
+
+		enroll = true
+	}
+
+	plain, err := helper.GenerateToken(32)
+
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(challengeTTL)
+
+	challenge := models.LoginChallengeModel{
+		UserID:    user.ID,
+		TokenHash: helper.HashToken(plain),
+		Enroll:    enroll,
+		ExpiresAt: &expiresAt,
+	}
+
+	if err := db.Table(challenge.TableName()).Create(&challenge).Error; err != nil {
+		return nil, err
+	}
+
+	result := &models.ChallengeModel{
+		Challenge: plain,
+		ExpiresAt: &expiresAt,
+		Enroll:    enroll,
+	}
+
+	if enroll {
+		secret, err := newTwoFactorSecret(user)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result.Secret = secret.Secret
+		result.URI = secret.URI
+	}
+
+	return result, nil
+}
+
+// Finish login with a code for the challenge and start session of the device.
+// Enrolling users enable two-factor authentication with the code and get their recovery codes.
+func CompleteLoginChallenge(plain string, code string, ip string, userAgent string) (*models.TokenModel, error) {
+	challenge := models.LoginChallengeModel{}
+
+	res := db.Table(challenge.TableName()).Where("tokenHash = ?", helper.HashToken(plain)).First(&challenge)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrChallengeInvalid
+	}
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	if challenge.UsedAt != nil || challenge.Attempts >= challengeMaxAttempts || challenge.ExpiresAt == nil || challenge.ExpiresAt.Before(time.Now()) {
+		return nil, ErrChallengeInvalid
+	}
+
+	user, err := GetUserByID(context.Background(), challenge.UserID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var token *models.TokenModel
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var codes []string
+		var err error
+
+		if challenge.Enroll {
+			codes, err = enableTwoFactor(tx, user, code)
+		} else {
+			err = verifyTwoFactorCode(tx, user, code)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// only one concurrent request may complete the challenge
+		res := tx.Table(challenge.TableName()).
+			Where("id = ? AND usedAt IS NULL", challenge.ID).
+			Update("usedAt", time.Now())
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return ErrChallengeInvalid
+		}
+
+		token, err = startSession(tx, user.ID, ip, userAgent)
+
+		if err != nil {
+			return err
+		}
+
+		token.RecoveryCodes = codes
+
+		return nil
+	})
+
+	if errors.Is(err, ErrTwoFactorCodeInvalid) {
+		db.Table(challenge.TableName()).Where("id = ?", challenge.ID).Update("attempts", gorm.Expr("attempts + 1"))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	token.Email = user.Email
+	token.Roles, err = GetUserRoles(user.ID)
+
+	return token, err
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ariefsn/book-store/auth/helper"
+	"github.com/ariefsn/book-store/auth/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrVerificationInvalid   = errors.New("invalid or expired verification link")
+	ErrVerificationThrottled = errors.New("verification email was sent recently")
+)
+
+const verificationPurpose = "email-verification"
+
+type verificationPayload struct {
+	UserID    int    `json:"id"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Lifetime of verification link, configurable through EMAIL_VERIFICATION_TTL
+func verificationTTL() time.Duration {
+	ttl := 24 * time.Hour
+
+	if d, err := time.ParseDuration(os.Getenv("EMAIL_VERIFICATION_TTL")); err == nil && d > 0 {
+		ttl = d
+	}
+
+	return ttl
+}
+
+// Minimum time between verification emails of a user, configurable through EMAIL_VERIFICATION_RESEND_INTERVAL
+func verificationResendInterval() time.Duration {
+	interval := time.Minute
+
+	if d, err := time.ParseDuration(os.Getenv("EMAIL_VERIFICATION_RESEND_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+
+	return interval
+}
+
+// Page the verification link points to, configurable through EMAIL_VERIFICATION_URL
+func verificationUrl() string {
+	url := "http://localhost:3001/auth/verify"
+
+	if os.Getenv("EMAIL_VERIFICATION_URL") != "" {
+		url = os.Getenv("EMAIL_VERIFICATION_URL")
+	}
+
+	return url
+}
+
+// Send verification link to user, the link is signed and bound to the current email
+func SendVerification(user *models.UserModel) error {
+	now := time.Now()
+	expiresAt := now.Add(verificationTTL())
+
+	payload, err := json.Marshal(verificationPayload{UserID: user.ID, Email: user.Email, ExpiresAt: expiresAt.Unix()})
+
+	if err != nil {
+		return err
+	}
+
+	res := db.Table(user.TableName()).Where("id = ?", user.ID).Update("verificationSentAt", now)
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	mail := helper.Mail{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Hi %s,\r\n\r\nOpen the link below to verify your email, it expires at %s.\r\n\r\n%s?token=%s\r\n",
+			user.FirstName, expiresAt.Format(time.RFC1123), verificationUrl(), helper.SignPayload(verificationPurpose, payload),
+		),
+	}
+
+	go func() {
+		if err := mailer.Send(mail); err != nil {
+			fmt.Println("[Error] send verification mail:", err.Error())
+		}
+	}()
+
+	return nil
+}
+
+// Send verification link again, at most once per resend interval.
+// Unknown and verified emails are ignored silently.
+func ResendVerification(email string) (time.Duration, error) {
+	user, err := GetUserByEmail(email)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return 0, nil
+	}
+
+	interval := verificationResendInterval()
+
+	// claim the slot first, so concurrent requests send one email
+	res := db.Table(user.TableName()).
+		Where("id = ? AND (verificationSentAt IS NULL OR verificationSentAt <= ?)", user.ID, time.Now().Add(-interval)).
+		Update("verificationSentAt", time.Now())
+
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		retryAfter := interval
+
+		if user.VerificationSentAt != nil {
+			retryAfter = time.Until(user.VerificationSentAt.Add(interval))
+		}
+
+		return retryAfter, ErrVerificationThrottled
+	}
+
+	return 0, SendVerification(user)
+}
+
+// Mark email of user as verified with the link token
+func VerifyEmail(token string) error {
+	raw, err := helper.VerifyPayload(verificationPurpose, token)
+
+	if err != nil {
+		return ErrVerificationInvalid
+	}
+
+	payload := verificationPayload{}
+
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return ErrVerificationInvalid
+	}
+
+	if time.Now().Unix() >= payload.ExpiresAt {
+		return ErrVerificationInvalid
+	}
+
+	user, err := GetUserByID(context.Background(), payload.UserID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrVerificationInvalid
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// link is only valid for the email it was sent to
+	if user.Email != payload.Email {
+		return ErrVerificationInvalid
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	res := db.Table(user.TableName()).Where("id = ?", user.ID).Update("emailVerifiedAt", time.Now())
+
+	return res.Error
+}
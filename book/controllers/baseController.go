@@ -1,48 +1,52 @@
 package controllers
 
 import (
-	"encoding/base64"
 	"errors"
 	"net/http"
 	"strconv"
-	"strings"
 
+	"github.com/ariefsn/book-store/book/helper"
 	"github.com/ariefsn/book-store/book/services"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
 )
 
 type BaseController struct{}
 
-func (b *BaseController) ParseClaims(r *http.Request) (string, string) {
-	claims := r.Header.Get("Claims")
-
-	decoded, _ := base64.StdEncoding.DecodeString(claims)
-
-	split := strings.Split(string(decoded), "*")
-
-	return split[0], split[1]
+// Identity of active user, verified by helper.IdentityVerifier
+func (b *BaseController) Identity(r *http.Request) *helper.Identity {
+	return helper.IdentityFromContext(r.Context())
 }
 
 func (b *BaseController) ValidateId(r *http.Request) (int, int, error) {
-	userId, _ := b.ParseClaims(r)
-
 	if chi.URLParam(r, "id") == "" {
 		return 0, http.StatusInternalServerError, errors.New("id can't be empty")
 	}
 
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 
-	userIdInt, _ := strconv.Atoi(userId)
-
-	admin, _, err := services.GetUserByID(r, userIdInt)
-
-	if err != nil {
-		return 0, http.StatusInternalServerError, err
-	}
+	return id, http.StatusOK, nil
+}
 
-	if !admin["isAdmin"].(bool) {
-		return 0, http.StatusUnauthorized, errors.New("unauthorized")
+// Middleware for allow only user which has the permission through its roles
+func (b *BaseController) Permission(permission string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			permissions, code, err := services.GetUserPermissions(r)
+
+			if err != nil {
+				render.Render(w, r, helper.ResponseError(code, err))
+				return
+			}
+
+			for _, p := range permissions {
+				if p == permission {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			render.Render(w, r, helper.ResponseError(http.StatusForbidden, errors.New("permission denied")))
+		})
 	}
-
-	return id, http.StatusOK, nil
 }
@@ -3,7 +3,6 @@ package controllers
 import (
 	"errors"
 	"net/http"
-	"strconv"
 
 	"github.com/ariefsn/book-store/book/helper"
 	"github.com/ariefsn/book-store/book/models"
@@ -27,8 +26,6 @@ func (c *BookController) Hi(w http.ResponseWriter, r *http.Request) {
 
 // Handler for create new book
 func (c *BookController) Create(w http.ResponseWriter, r *http.Request) {
-	userId, _ := c.ParseClaims(r)
-
 	payload := models.BookModel{}
 
 	if err := render.Bind(r, &payload); err != nil {
@@ -37,24 +34,10 @@ func (c *BookController) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userIdInt, _ := strconv.Atoi(userId)
-
-	user, _, err := services.GetUserByID(r, userIdInt)
-
-	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
-		return
-	}
-
-	if !user["isAdmin"].(bool) {
-		render.Render(w, r, helper.ResponseError(http.StatusUnauthorized, errors.New("role not authorized")))
-		return
-	}
-
-	id, err := services.CreateBook(&payload)
+	id, err := services.CreateBook(r.Context(), &payload)
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
@@ -63,7 +46,7 @@ func (c *BookController) Create(w http.ResponseWriter, r *http.Request) {
 
 // Handler for update book
 func (c *BookController) UpdateBook(w http.ResponseWriter, r *http.Request) {
-	payload := models.BookModel{}
+	payload := models.BookUpdateModel{}
 
 	if err := render.Bind(r, &payload); err != nil {
 		render.Render(w, r, helper.ResponseError(422, err))
@@ -78,7 +61,12 @@ func (c *BookController) UpdateBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	row := services.UpdateBook(id, &payload)
+	row, err := services.UpdateBook(r.Context(), id, &payload)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
 
 	render.Render(w, r, helper.ResponseSuccess(row))
 }
@@ -92,44 +80,42 @@ func (c *BookController) DeleteBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := services.GetBookByID(id)
+	user, err := services.GetBookByID(r.Context(), id)
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
-	row := services.DeleteBook(user)
+	row := services.DeleteBook(r.Context(), user)
 
 	render.Render(w, r, helper.ResponseSuccess(row))
 }
 
 // Handler for get all books
 func (c *BookController) All(w http.ResponseWriter, r *http.Request) {
-	userId, _ := c.ParseClaims(r)
-
-	userIdInt, _ := strconv.Atoi(userId)
-
-	admin, _, err := services.GetUserByID(r, userIdInt)
+	filter, err := models.NewBookFilterModel(r)
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, err))
 		return
 	}
 
-	if !admin["isAdmin"].(bool) {
-		render.Render(w, r, helper.ResponseError(http.StatusUnauthorized, errors.New("unauthorized")))
+	page, err := helper.ParsePagination(r, models.BookSortable...)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, err))
 		return
 	}
 
-	users, err := services.GetBooks()
+	books, err := services.GetBooks(r.Context(), filter, page)
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
-	render.Render(w, r, helper.ResponseSuccess(users))
+	render.Render(w, r, helper.ResponseSuccess(books))
 }
 
 // Handler for find book by id
@@ -141,12 +127,38 @@ func (c *BookController) Find(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := services.GetBookByID(id)
+	user, err := services.GetBookByID(r.Context(), id)
 
 	if err != nil {
-		render.Render(w, r, helper.ResponseError(http.StatusInternalServerError, err))
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
 		return
 	}
 
 	render.Render(w, r, helper.ResponseSuccess(user))
 }
+
+// Handler for full text search on books
+func (c *BookController) Search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+
+	if q == "" {
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, errors.New("q can't be empty")))
+		return
+	}
+
+	page, err := helper.ParsePagination(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, err))
+		return
+	}
+
+	books, err := services.SearchBooks(q, page)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(books))
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ariefsn/book-store/book/helper"
+	"github.com/ariefsn/book-store/book/models"
+	"github.com/ariefsn/book-store/book/services"
+	"github.com/go-chi/render"
+)
+
+type PriceController struct {
+	BaseController
+}
+
+func NewPriceController() *PriceController {
+	c := new(PriceController)
+
+	return c
+}
+
+// Handler for get price history of book, or the price effective at time given by "at" query param
+func (c *PriceController) All(w http.ResponseWriter, r *http.Request) {
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	if at := r.URL.Query().Get("at"); at != "" {
+		t, err := time.Parse(time.RFC3339, at)
+
+		if err != nil {
+			render.Render(w, r, helper.ResponseError(http.StatusBadRequest, errors.New("at must be an RFC 3339 time")))
+			return
+		}
+
+		price, err := services.GetPriceAt(r.Context(), id, t)
+
+		if err != nil {
+			render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+			return
+		}
+
+		render.Render(w, r, helper.ResponseSuccess(price))
+		return
+	}
+
+	page, err := helper.ParsePagination(r, "effectiveAt")
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, err))
+		return
+	}
+
+	prices, err := services.GetPrices(r.Context(), id, page)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(prices))
+}
+
+// Handler for change price of book now or at effectiveAt
+func (c *PriceController) Create(w http.ResponseWriter, r *http.Request) {
+	payload := models.PriceModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	if _, err := services.GetBookByID(r.Context(), id); err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	payload.BookID = id
+	payload.AppliedAt = nil
+
+	if err := services.CreatePrice(r.Context(), &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(payload))
+}
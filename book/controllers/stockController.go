@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ariefsn/book-store/book/helper"
+	"github.com/ariefsn/book-store/book/models"
+	"github.com/ariefsn/book-store/book/services"
+	"github.com/go-chi/render"
+)
+
+type StockController struct {
+	BaseController
+}
+
+func NewStockController() *StockController {
+	c := new(StockController)
+
+	return c
+}
+
+// Handler for get current stock of book
+func (c *StockController) Find(w http.ResponseWriter, r *http.Request) {
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	if _, err := services.GetBookByID(r.Context(), id); err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	stock, err := services.GetStock(r.Context(), id)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(stock))
+}
+
+// Handler for get stock movements of book
+func (c *StockController) Movements(w http.ResponseWriter, r *http.Request) {
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	page, err := helper.ParsePagination(r, "createdAt")
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, err))
+		return
+	}
+
+	movements, err := services.GetStockMovements(r.Context(), id, page)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(movements))
+}
+
+// Handler for post stock movement of book
+func (c *StockController) CreateMovement(w http.ResponseWriter, r *http.Request) {
+	payload := models.StockMovementModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	c.createMovement(w, r, &payload)
+}
+
+// Handler for post stock movement of order, only selling on checkout and returning on cancel.
+// Movements are sent with an idempotency key, so the order service can send them again safely.
+func (c *StockController) CreateOrderMovement(w http.ResponseWriter, r *http.Request) {
+	payload := models.StockMovementModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	if payload.Type != models.MovementSell && payload.Type != models.MovementReturn {
+		render.Render(w, r, helper.ResponseError(422, errors.New("type must be one of sell, return")))
+		return
+	}
+
+	key := r.Header.Get(models.IdempotencyKeyHeader)
+
+	if key == "" || len(key) > 100 {
+		render.Render(w, r, helper.ResponseError(422, errors.New("idempotency key is required, at most 100 characters")))
+		return
+	}
+
+	payload.IdempotencyKey = &key
+
+	c.createMovement(w, r, &payload)
+}
+
+func (c *StockController) createMovement(w http.ResponseWriter, r *http.Request, payload *models.StockMovementModel) {
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	if _, err := services.GetBookByID(r.Context(), id); err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	payload.BookID = id
+	payload.UserID = c.Identity(r).UserID()
+
+	err = services.CreateStockMovement(r.Context(), payload)
+
+	if errors.Is(err, services.ErrInsufficientStock) {
+		render.Render(w, r, helper.ResponseError(http.StatusConflict, err))
+		return
+	}
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(payload))
+}
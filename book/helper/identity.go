@@ -0,0 +1,226 @@
+package helper
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+// Header carrying identity between services
+const IdentityHeader = "Identity"
+
+var (
+	ErrIdentityMissing = errors.New("missing identity")
+	ErrIdentityInvalid = errors.New("invalid identity")
+	ErrIdentityExpired = errors.New("identity expired")
+)
+
+type identityKey struct{}
+
+var (
+	identitySecret  []byte
+	identityService string
+	identityTTL     = time.Minute
+)
+
+// Identity of the user a request is made on behalf of, signed by the calling service.
+// Subject is empty when the request isn't made for a user, e.g. register or login.
+// Scopes are set when the user authenticated with an API key, permissions are limited to them.
+// Session is the token family of the access token the user authenticated with.
+// Internal is only set by the gateway for calls it makes itself, never for requests it proxies.
+type Identity struct {
+	Issuer    string   `json:"iss"`
+	Audience  string   `json:"aud"`
+	Subject   string   `json:"sub,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	Session   string   `json:"sid,omitempty"`
+	Internal  bool     `json:"int,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// Id of the user, 0 when there is no user
+func (i *Identity) UserID() int {
+	id, _ := strconv.Atoi(i.Subject)
+
+	return id
+}
+
+// Check identity is limited by API key scopes
+func (i *Identity) Scoped() bool {
+	return len(i.Scopes) > 0
+}
+
+// Permissions the request may use, those of the user within the scopes
+func (i *Identity) Limit(permissions []string) []string {
+	if !i.Scoped() {
+		return permissions
+	}
+
+	limited := []string{}
+
+	for _, p := range permissions {
+		for _, scope := range i.Scopes {
+			if p == scope {
+				limited = append(limited, p)
+				break
+			}
+		}
+	}
+
+	return limited
+}
+
+// Init identity signing for service with SERVICE_SECRET shared by all services.
+// Lifetime of signed identities is configurable through SERVICE_TOKEN_TTL.
+func InitIdentity(service string) error {
+	secret := os.Getenv("SERVICE_SECRET")
+
+	if secret == "" {
+		return errors.New("SERVICE_SECRET is required")
+	}
+
+	if d, err := time.ParseDuration(os.Getenv("SERVICE_TOKEN_TTL")); err == nil && d > 0 {
+		identityTTL = d
+	}
+
+	identitySecret = []byte(secret)
+	identityService = service
+
+	return nil
+}
+
+var identityHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Sign identity for audience, issuer and lifetime are set from this service
+func SignIdentity(identity Identity, audience string) (string, error) {
+	now := time.Now()
+
+	identity.Issuer = identityService
+	identity.Audience = audience
+	identity.IssuedAt = now.Unix()
+	identity.ExpiresAt = now.Add(identityTTL).Unix()
+
+	payload, err := json.Marshal(identity)
+
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := identityHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	return unsigned + "." + signIdentity(unsigned), nil
+}
+
+// Verify signature, audience and expiry of identity token
+func VerifyIdentity(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 || parts[0] != identityHeader {
+		return nil, ErrIdentityInvalid
+	}
+
+	if !hmac.Equal([]byte(parts[2]), []byte(signIdentity(parts[0]+"."+parts[1]))) {
+		return nil, ErrIdentityInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return nil, ErrIdentityInvalid
+	}
+
+	identity := new(Identity)
+
+	if err := json.Unmarshal(payload, identity); err != nil {
+		return nil, ErrIdentityInvalid
+	}
+
+	if identity.Audience != identityService {
+		return nil, ErrIdentityInvalid
+	}
+
+	if time.Now().Unix() >= identity.ExpiresAt {
+		return nil, ErrIdentityExpired
+	}
+
+	return identity, nil
+}
+
+func signIdentity(unsigned string) string {
+	mac := hmac.New(sha256.New, identitySecret)
+	mac.Write([]byte(unsigned))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Middleware for reject requests without valid identity signed for this service
+func IdentityVerifier(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(IdentityHeader)
+
+		if token == "" {
+			render.Render(w, r, ResponseError(http.StatusUnauthorized, ErrIdentityMissing))
+			return
+		}
+
+		identity, err := VerifyIdentity(token)
+
+		if err != nil {
+			render.Render(w, r, ResponseError(http.StatusUnauthorized, err))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+// Context carrying identity of the request
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// Identity verified for the request, empty identity when there is none
+func IdentityFromContext(ctx context.Context) *Identity {
+	if identity, ok := ctx.Value(identityKey{}).(*Identity); ok {
+		return identity
+	}
+
+	return &Identity{}
+}
+
+// Sign identity of the request for a call to another service on behalf of the same user
+func ForwardIdentity(r *http.Request, audience string) string {
+	identity := *IdentityFromContext(r.Context())
+	identity.Internal = false
+
+	token, _ := SignIdentity(identity, audience)
+
+	return token
+}
+
+// Middleware for allow only requests signed by the service, e.g. calls the order service makes itself
+func IssuedBy(service string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if IdentityFromContext(r.Context()).Issuer != service {
+				render.Render(w, r, ResponseError(http.StatusForbidden, errors.New("permission denied")))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/ariefsn/book-store/book/controllers"
 	"github.com/ariefsn/book-store/book/helper"
+	"github.com/ariefsn/book-store/book/migrations"
+	"github.com/ariefsn/book-store/book/models"
 	"github.com/ariefsn/book-store/book/services"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -23,6 +27,38 @@ func main() {
 		return
 	}
 
+	migrator := helper.NewMigrator(db, "book", migrations.Migrations)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := helper.RunMigrate(migrator, os.Args[2:]); err != nil {
+			fmt.Println("[Error]", err.Error())
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if helper.AutoMigrate() {
+		if _, err := migrator.Up(); err != nil {
+			fmt.Println("[Error]", err.Error())
+			return
+		}
+	}
+
+	if err := helper.InitIdentity("book"); err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
+
+	shutdown, err := helper.InitTracing("book")
+
+	if err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
+
+	defer shutdown(context.Background())
+
 	err = services.InitService(db)
 
 	if err != nil {
@@ -30,21 +66,60 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		count, err := services.RebuildSearchIndex()
+
+		if err != nil {
+			fmt.Println("[Error]", err.Error())
+			os.Exit(1)
+		}
+
+		fmt.Println("Search index rebuilt,", count, "books indexed")
+		return
+	}
+
+	err = services.InitSearchIndex()
+
+	if err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
+
+	priceInterval := time.Minute
+
+	if d, err := time.ParseDuration(os.Getenv("PRICE_SCHEDULE_INTERVAL")); err == nil && d > 0 {
+		priceInterval = d
+	}
+
+	go services.SchedulePrices(priceInterval)
+
 	r := chi.NewRouter()
 
 	r.Use(middleware.Logger)
 	r.Use(middleware.Heartbeat("/ping"))
+	r.Use(helper.Metrics)
+	r.Use(helper.Tracing)
+	r.Use(helper.IdentityVerifier)
 
 	ctr := controllers.NewBookController()
+	stock := controllers.NewStockController()
+	price := controllers.NewPriceController()
 
 	r.Get("/", ctr.Hi)
 
 	r.Route("/book", func(r chi.Router) {
-		r.Get("/", ctr.All)
-		r.Post("/", ctr.Create)
-		r.Get("/{id}", ctr.Find)
-		r.Put("/{id}", ctr.UpdateBook)
-		r.Delete("/{id}", ctr.DeleteBook)
+		r.With(ctr.Permission(models.PermissionBookRead)).Get("/", ctr.All)
+		r.With(ctr.Permission(models.PermissionBookRead)).Get("/search", ctr.Search)
+		r.With(ctr.Permission(models.PermissionBookWrite)).Post("/", ctr.Create)
+		r.With(ctr.Permission(models.PermissionBookRead)).Get("/{id}", ctr.Find)
+		r.With(ctr.Permission(models.PermissionBookWrite)).Put("/{id}", ctr.UpdateBook)
+		r.With(ctr.Permission(models.PermissionBookWrite)).Delete("/{id}", ctr.DeleteBook)
+		r.With(ctr.Permission(models.PermissionBookRead)).Get("/{id}/price", price.All)
+		r.With(ctr.Permission(models.PermissionBookWrite)).Post("/{id}/price", price.Create)
+		r.With(ctr.Permission(models.PermissionStockRead)).Get("/{id}/stock", stock.Find)
+		r.With(ctr.Permission(models.PermissionStockRead)).Get("/{id}/stock/movement", stock.Movements)
+		r.With(ctr.Permission(models.PermissionStockWrite)).Post("/{id}/stock/movement", stock.CreateMovement)
+		r.With(helper.IssuedBy("order")).Post("/{id}/stock/order", stock.CreateOrderMovement)
 	})
 
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
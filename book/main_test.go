@@ -1,28 +1,30 @@
 package main
 
 import (
-	"encoding/base64"
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/ariefsn/book-store/book/controllers"
+	"github.com/ariefsn/book-store/book/helper"
+	"github.com/ariefsn/book-store/book/migrations"
+	"github.com/ariefsn/book-store/book/models"
+	"github.com/ariefsn/book-store/book/services"
+	"github.com/go-chi/render"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
 )
 
-func buildClaims() string {
-	id := 0
-	email := "administrator@mail.com"
-
-	claimsString := fmt.Sprintf("%v*%s", id, email)
-	data := []byte(claimsString)
-	encoded := base64.StdEncoding.EncodeToString([]byte(data))
-
-	return encoded
-}
-
 type TestCase struct {
 	name       string
 	method     string
@@ -43,36 +45,369 @@ func TestRootHandler(t *testing.T) {
 			statusCode: 200,
 			message:    "response body not contains api info",
 		},
-		{
-			name:   "should have claims",
-			method: http.MethodGet,
-			headers: map[string]string{
-				"Claims": buildClaims(),
-			},
-			want:       buildClaims(),
-			statusCode: 200,
-			message:    "claims should be exists",
-		},
 	}
 
-	for i, c := range tc {
+	for _, c := range tc {
 		t.Run(c.name, func(t *testing.T) {
 			req := httptest.NewRequest(c.method, "/", nil)
 			res := httptest.NewRecorder()
 
-			if c.headers["Claims"] != "" {
-				req.Header.Add("Claims", c.headers["Claims"])
-			}
-
 			controllers.NewBookController().Hi(res, req)
 
 			assert.Equal(c.statusCode, res.Result().StatusCode, fmt.Sprintf("status code should be %v instead of %v", c.statusCode, res.Result().StatusCode))
 
-			if i == 0 {
-				assert.Equal(c.want, strings.TrimSpace(res.Body.String()), c.message)
+			assert.Equal(c.want, strings.TrimSpace(res.Body.String()), c.message)
+		})
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	assert := assert.New(t)
+
+	tc := []struct {
+		name    string
+		query   string
+		page    int
+		limit   int
+		sort    string
+		desc    bool
+		wantErr bool
+	}{
+		{name: "should use default", query: "", page: 1, limit: 20, sort: "id"},
+		{name: "should parse page and limit", query: "page=3&limit=5", page: 3, limit: 5, sort: "id"},
+		{name: "should parse descending sort", query: "sort=-publicationYear", page: 1, limit: 20, sort: "publicationYear", desc: true},
+		{name: "should reject unknown sort", query: "sort=password", wantErr: true},
+		{name: "should reject limit over max", query: "limit=1000", wantErr: true},
+		{name: "should reject invalid cursor", query: "cursor=not-a-cursor!", wantErr: true},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/book?"+c.query, nil)
+
+			p, err := helper.ParsePagination(req, models.BookSortable...)
+
+			if c.wantErr {
+				assert.Error(err)
+				return
+			}
+
+			assert.NoError(err)
+			assert.Equal(c.page, p.Page)
+			assert.Equal(c.limit, p.Limit)
+			assert.Equal(c.sort, p.Sort)
+			assert.Equal(c.desc, p.Desc)
+		})
+	}
+}
+
+func TestPaginateCursor(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/book?limit=2&sort=title", nil)
+
+	p, _ := helper.ParsePagination(req, models.BookSortable...)
+
+	books := []models.BookModel{{ID: 1, Title: "A"}, {ID: 2, Title: "B"}, {ID: 3, Title: "C"}}
+
+	cursor := p.Paginate(&books)
+
+	assert.Len(books, 2, "extra row should be trimmed")
+	assert.NotEmpty(cursor)
+
+	req = httptest.NewRequest(http.MethodGet, "/book?limit=2&sort=title&cursor="+cursor, nil)
+
+	p, err := helper.ParsePagination(req, models.BookSortable...)
+
+	assert.NoError(err)
+	assert.Equal("B", p.Cursor.Value)
+	assert.Equal(2, p.Cursor.ID)
+
+	t.Run("should skip cursor when sort column isn't a field", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/book?limit=2&sort=rating", nil)
+
+		p, _ := helper.ParsePagination(req, "rating")
+
+		books := []models.BookModel{{ID: 1}, {ID: 2}, {ID: 3}}
+
+		assert.Empty(p.Paginate(&books))
+		assert.Len(books, 2, "extra row should be trimmed")
+	})
+}
+
+// Signing and verifying cases are covered by the auth service, which shares the identity helper
+func TestIdentityVerifier(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("SERVICE_SECRET", "test secret")
+
+	helper.InitIdentity("book")
+
+	valid, _ := helper.SignIdentity(helper.Identity{Subject: "1", Roles: []string{"admin"}}, "book")
+	otherAudience, _ := helper.SignIdentity(helper.Identity{Subject: "1"}, "auth")
+
+	for identity, statusCode := range map[string]int{valid: http.StatusOK, otherAudience: http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(helper.IdentityHeader, identity)
+		res := httptest.NewRecorder()
+
+		helper.IdentityVerifier(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(res, req)
+
+		assert.Equal(statusCode, res.Result().StatusCode)
+	}
+
+	t.Run("should allow only identity issued by the service", func(t *testing.T) {
+		helper.InitIdentity("order")
+		fromOrder, _ := helper.SignIdentity(helper.Identity{Subject: "1"}, "book")
+
+		helper.InitIdentity("api")
+		fromApi, _ := helper.SignIdentity(helper.Identity{Subject: "1"}, "book")
+
+		helper.InitIdentity("book")
+
+		handler := helper.IdentityVerifier(helper.IssuedBy("order")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+		for identity, statusCode := range map[string]int{fromOrder: http.StatusOK, fromApi: http.StatusForbidden} {
+			req := httptest.NewRequest(http.MethodPost, "/book/1/stock/order", nil)
+			req.Header.Set(helper.IdentityHeader, identity)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			assert.Equal(statusCode, res.Result().StatusCode)
+		}
+	})
+}
+
+func TestUserPermissions(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("SERVICE_SECRET", "test secret")
+	helper.InitIdentity("book")
+
+	body := ""
+
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer auth.Close()
+
+	authService := helper.GetUpstream("auth")
+	authURL := authService.URL
+	authService.URL, _ = url.Parse(auth.URL)
+	defer func() { authService.URL = authURL }()
+
+	tc := []struct {
+		name       string
+		body       string
+		statusCode int
+	}{
+		{name: "should read permissions", body: `{"code":200,"success":true,"data":["book:read"],"message":""}`, statusCode: http.StatusOK},
+		{name: "should pass on rejection of user", body: `{"code":403,"success":false,"data":null,"message":"permission denied"}`, statusCode: http.StatusForbidden},
+		{name: "should reject failure of auth", body: `{"code":500,"success":false,"data":null,"message":"database down"}`, statusCode: http.StatusBadGateway},
+		{name: "should reject permissions which aren't a list", body: `{"code":200,"success":true,"data":"book:read","message":""}`, statusCode: http.StatusBadGateway},
+		{name: "should reject body which isn't json", body: "<html>", statusCode: http.StatusBadGateway},
+		{name: "should reject empty body", body: "", statusCode: http.StatusBadGateway},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			body = c.body
+
+			permissions, statusCode, err := services.GetUserPermissions(httptest.NewRequest(http.MethodGet, "/book", nil))
+
+			assert.Equal(c.statusCode, statusCode)
+
+			if c.statusCode == http.StatusOK {
+				assert.Nil(err)
+				assert.Equal([]string{"book:read"}, permissions)
 			} else {
-				assert.Equal(c.want, req.Header.Get("Claims"), c.message)
+				assert.NotNil(err)
 			}
 		})
 	}
 }
+
+func TestOrderMovement(t *testing.T) {
+	assert := assert.New(t)
+
+	stock := controllers.NewStockController()
+
+	for key, statusCode := range map[string]int{"": 422, strings.Repeat("k", 101): 422} {
+		req := httptest.NewRequest(http.MethodPost, "/book/1/stock/order", strings.NewReader(`{"type":"sell","quantity":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(models.IdempotencyKeyHeader, key)
+		res := httptest.NewRecorder()
+
+		stock.CreateOrderMovement(res, req)
+
+		assert.Equal(statusCode, res.Code, "movement without valid idempotency key should be rejected")
+		assert.Contains(res.Body.String(), "idempotency key is required")
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	assert := assert.New(t)
+
+	versions := map[int]bool{}
+
+	for _, m := range migrations.Migrations {
+		assert.False(versions[m.Version], fmt.Sprintf("version %d should be unique", m.Version))
+		assert.NotEmpty(m.Name, fmt.Sprintf("migration %d should have name", m.Version))
+		assert.NotEmpty(m.Up, fmt.Sprintf("migration %d should have up", m.Version))
+		assert.NotEmpty(m.Down, fmt.Sprintf("migration %d should have down", m.Version))
+
+		versions[m.Version] = true
+	}
+}
+
+func TestBookValidation(t *testing.T) {
+	tc := []struct {
+		name  string
+		book  models.BookModel
+		codes map[string]string
+	}{
+		{name: "should accept valid book", book: models.BookModel{Title: "Dune", Author: "Frank Herbert", PublicationYear: 1965, Price: 1999, Currency: "USD"}, codes: map[string]string{}},
+		{name: "should require title and author", book: models.BookModel{Title: "  "}, codes: map[string]string{"title": helper.CodeRequired, "author": helper.CodeRequired}},
+		{name: "should limit length to column size", book: models.BookModel{Title: strings.Repeat("é", 101), Author: "A", Description: strings.Repeat("x", 201)}, codes: map[string]string{"title": helper.CodeTooLong, "description": helper.CodeTooLong}},
+		{name: "should reject publication year in the future", book: models.BookModel{Title: "T", Author: "A", PublicationYear: 3000}, codes: map[string]string{"publicationYear": helper.CodeInFuture}},
+		{name: "should reject publication year out of range", book: models.BookModel{Title: "T", Author: "A", PublicationYear: 999}, codes: map[string]string{"publicationYear": helper.CodeOutOfRange}},
+		{name: "should check price", book: models.BookModel{Title: "T", Author: "A", Price: -1, Currency: "XXY"}, codes: map[string]string{"price": helper.CodeOutOfRange, "currency": helper.CodeInvalid}},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.book.Bind(nil)
+			codes := map[string]string{}
+
+			if validation, ok := err.(*helper.ValidationError); ok {
+				for _, f := range validation.Fields {
+					codes[f.Field] = f.Code
+				}
+			} else {
+				assert.Nil(t, err)
+			}
+
+			assert.Equal(t, c.codes, codes)
+		})
+	}
+
+	t.Run("should list fields in response", func(t *testing.T) {
+		book := models.BookModel{}
+		res := helper.ResponseError(422, book.Bind(nil)).(*helper.ResponseModel)
+
+		assert.Len(t, res.Data, 2)
+	})
+
+	t.Run("should update only fields sent", func(t *testing.T) {
+		update := models.BookUpdateModel{}
+		assert.Nil(t, json.Unmarshal([]byte(`{"description":"Epic","publicationYear":1966}`), &update))
+		assert.Nil(t, update.Bind(nil))
+
+		book := models.BookModel{Title: "Dune", Author: "Frank Herbert", Publisher: "Chilton", Price: 1999, Currency: "USD"}
+		update.Apply(&book)
+
+		assert.Equal(t, map[string]interface{}{"description": "Epic", "publicationYear": 1966}, update.Fields())
+		assert.Equal(t, models.BookModel{Title: "Dune", Description: "Epic", Author: "Frank Herbert", Publisher: "Chilton", PublicationYear: 1966, Price: 1999, Currency: "USD"}, book)
+	})
+
+	t.Run("should reject blank fields sent on update", func(t *testing.T) {
+		update := models.BookUpdateModel{}
+		assert.Nil(t, json.Unmarshal([]byte(`{"title":" ","author":""}`), &update))
+
+		validation, ok := update.Bind(nil).(*helper.ValidationError)
+
+		assert.True(t, ok)
+		assert.Len(t, validation.Fields, 2)
+	})
+}
+
+func TestProblemDetails(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("should map errors to status", func(t *testing.T) {
+		assert.Equal(http.StatusNotFound, helper.ErrorStatus(fmt.Errorf("%w: book 1", helper.ErrNotFound)))
+		assert.Equal(http.StatusConflict, helper.ErrorStatus(helper.ErrConflict))
+		assert.Equal(http.StatusUnprocessableEntity, helper.ErrorStatus((&models.BookModel{}).Bind(nil)))
+		assert.Equal(http.StatusInternalServerError, helper.ErrorStatus(fmt.Errorf("boom")))
+	})
+
+	tc := []struct {
+		name        string
+		accept      string
+		contentType string
+		want        string
+	}{
+		{name: "should render problem details by default", contentType: helper.ProblemContentType, want: `"type":"urn:book-store:problem:validation"`},
+		{name: "should render problem details when asked", accept: "application/problem+json, application/json", contentType: helper.ProblemContentType, want: `"errors":[{"field":"title"`},
+		{name: "should render envelope for application/json", accept: "application/json", contentType: "application/json", want: `"success":false`},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/book?x=1", nil)
+			res := httptest.NewRecorder()
+
+			if c.accept != "" {
+				req.Header.Set("Accept", c.accept)
+			}
+
+			render.Render(res, req, helper.ResponseError(422, (&models.BookModel{}).Bind(nil)))
+
+			assert.Equal(422, res.Code)
+			assert.Contains(res.Header().Get("Content-Type"), c.contentType)
+			assert.Contains(res.Body.String(), c.want)
+		})
+	}
+
+	t.Run("should describe request as instance", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/book/1?x=1", nil)
+		problem := helper.ResponseError(404, helper.ErrNotFound).(*helper.ResponseModel).Problem(req)
+
+		assert.Equal("/book/1?x=1", problem.Instance)
+		assert.Equal("Not Found", problem.Title)
+		assert.Equal("not found", problem.Detail)
+	})
+}
+
+func TestQueryTracing(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root:root@tcp(127.0.0.1:3306)/book_store", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	assert.Nil(err)
+	assert.Nil(helper.InstrumentDB(db, "test"))
+
+	book := models.NewBookModel()
+
+	// outside of a traced request
+	db.Table(book.TableName()).Where("id = ?", 1).First(&book)
+
+	assert.Empty(recorder.Ended())
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "GET /book/{id}")
+	db.WithContext(ctx).Table(book.TableName()).Where("id = ?", 1).First(&book)
+	span.End()
+
+	spans := recorder.Ended()
+
+	if assert.Len(spans, 2) {
+		query := spans[0]
+
+		assert.Equal("query "+book.TableName(), query.Name())
+		assert.Equal(span.SpanContext().SpanID(), query.Parent().SpanID())
+
+		attributes := map[string]string{}
+
+		for _, a := range query.Attributes() {
+			attributes[string(a.Key)] = a.Value.Emit()
+		}
+
+		assert.Equal("mysql", attributes["db.system.name"])
+		assert.Contains(attributes["db.query.text"], "WHERE id = ?")
+		assert.NotContains(attributes["db.query.text"], "id = 1")
+	}
+}
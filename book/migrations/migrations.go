@@ -0,0 +1,121 @@
+package migrations
+
+import "github.com/ariefsn/book-store/book/helper"
+
+// Schema of tables owned by book service.
+// Released migrations must not be changed, add a new one instead.
+var Migrations = []helper.Migration{
+	{
+		Version: 1,
+		Name:    "create_books",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS books (
+  id int NOT NULL AUTO_INCREMENT,
+  title VARCHAR(100) NOT NULL,
+  description VARCHAR(200),
+  author VARCHAR(100) NOT NULL,
+  publisher VARCHAR(100),
+  publicationYear int,
+  createdAt DATETIME,
+  updatedAt DATETIME,
+  PRIMARY KEY(id)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS books`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_book_stocks",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS book_stocks (
+  bookId int NOT NULL,
+  quantity int NOT NULL DEFAULT 0,
+  updatedAt DATETIME,
+  PRIMARY KEY(bookId),
+  CHECK (quantity >= 0)
+)`,
+			`CREATE TABLE IF NOT EXISTS stock_movements (
+  id int NOT NULL AUTO_INCREMENT,
+  bookId int NOT NULL,
+  type ENUM('receive', 'sell', 'adjust', 'return') NOT NULL,
+  quantity int NOT NULL,
+  balance int NOT NULL,
+  note VARCHAR(200),
+  userId int,
+  createdAt DATETIME,
+  PRIMARY KEY(id),
+  KEY(bookId, id),
+  KEY(createdAt)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS stock_movements`,
+			`DROP TABLE IF EXISTS book_stocks`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_book_prices",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS book_prices (
+  id int NOT NULL AUTO_INCREMENT,
+  bookId int NOT NULL,
+  price BIGINT NOT NULL,
+  currency CHAR(3) NOT NULL,
+  effectiveAt DATETIME NOT NULL,
+  appliedAt DATETIME,
+  createdAt DATETIME,
+  PRIMARY KEY(id),
+  KEY(bookId, effectiveAt),
+  KEY(appliedAt, effectiveAt)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS book_prices`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add_books_indexes",
+		Up: []string{
+			`CREATE INDEX books_title ON books (title)`,
+			`CREATE INDEX books_author ON books (author)`,
+			`CREATE INDEX books_publisher ON books (publisher)`,
+			`CREATE INDEX books_publication_year ON books (publicationYear)`,
+			`CREATE INDEX books_created_at ON books (createdAt)`,
+		},
+		Down: []string{
+			`DROP INDEX books_created_at ON books`,
+			`DROP INDEX books_publication_year ON books`,
+			`DROP INDEX books_publisher ON books`,
+			`DROP INDEX books_author ON books`,
+			`DROP INDEX books_title ON books`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_books_price",
+		Up: []string{
+			`ALTER TABLE books ADD COLUMN price BIGINT NOT NULL DEFAULT 0, ADD COLUMN currency CHAR(3)`,
+			`CREATE INDEX books_price ON books (price)`,
+		},
+		Down: []string{
+			`DROP INDEX books_price ON books`,
+			`ALTER TABLE books DROP COLUMN price, DROP COLUMN currency`,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add_stock_movements_idempotency_key",
+		Up: []string{
+			`ALTER TABLE stock_movements ADD COLUMN idempotencyKey VARCHAR(100)`,
+			`CREATE UNIQUE INDEX stock_movements_idempotency_key ON stock_movements (idempotencyKey)`,
+		},
+		Down: []string{
+			`DROP INDEX stock_movements_idempotency_key ON stock_movements`,
+			`ALTER TABLE stock_movements DROP COLUMN idempotencyKey`,
+		},
+	},
+}
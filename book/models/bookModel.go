@@ -1,27 +1,153 @@
 package models
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/ariefsn/book-store/book/helper"
 )
 
 type BookModel struct {
 	ID              int        `json:"id" gorm:"autoIncrement"`
-	Title           string     `json:"title"`
-	Description     string     `json:"description"`
-	Author          string     `json:"author"`
-	Publisher       string     `json:"publisher"`
-	PublicationYear int        `json:"publicationYear" gorm:"column:publicationYear"`
+	Title           string     `json:"title" validate:"required,max=100"`
+	Description     string     `json:"description" validate:"max=200"`
+	Author          string     `json:"author" validate:"required,max=100"`
+	Publisher       string     `json:"publisher" validate:"max=100"`
+	PublicationYear int        `json:"publicationYear" gorm:"column:publicationYear" validate:"min=1000,notfuture"`
+	Price           int64      `json:"price"`
+	Currency        string     `json:"currency"`
 	CreatedAt       *time.Time `json:"createdAt" gorm:"column:createdAt"`
 	UpdatedAt       *time.Time `json:"updatedAt" gorm:"column:updatedAt"`
 }
 
+// Fields of book sent on update, fields which aren't sent are kept
+type BookUpdateModel struct {
+	Title           *string `json:"title" validate:"notblank,max=100"`
+	Description     *string `json:"description" validate:"max=200"`
+	Author          *string `json:"author" validate:"notblank,max=100"`
+	Publisher       *string `json:"publisher" validate:"max=100"`
+	PublicationYear *int    `json:"publicationYear" validate:"min=1000,notfuture"`
+	Price           int64   `json:"price"`
+	Currency        string  `json:"currency"`
+}
+
 type BookListModel struct {
-	Books []BookModel `json:"list"`
+	Books      []BookModel `json:"list"`
+	Total      int64       `json:"total"`
+	Page       int         `json:"page"`
+	Limit      int         `json:"limit"`
+	NextCursor string      `json:"nextCursor"`
 }
 
+type BookHitModel struct {
+	Book       BookModel           `json:"book"`
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights"`
+}
+
+type BookSearchModel struct {
+	Hits  []BookHitModel `json:"list"`
+	Total uint64         `json:"total"`
+	Page  int            `json:"page"`
+	Limit int            `json:"limit"`
+}
+
+type BookFilterModel struct {
+	Author              string
+	Publisher           string
+	PublicationYearFrom int
+	PublicationYearTo   int
+}
+
+// Columns allowed for sort, every one of them is indexed
+var BookSortable = []string{"title", "author", "publisher", "publicationYear", "price", "createdAt"}
+
 func (u *BookModel) Bind(r *http.Request) error {
-	return nil
+	result := helper.Validate(u)
+
+	validatePrice(result, u.Price, u.Currency)
+
+	return result.Err()
+}
+
+func (u *BookUpdateModel) Bind(r *http.Request) error {
+	result := helper.Validate(u)
+
+	validatePrice(result, u.Price, u.Currency)
+
+	return result.Err()
+}
+
+// Columns of fields sent
+func (u *BookUpdateModel) Fields() map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	if u.Title != nil {
+		fields["title"] = *u.Title
+	}
+
+	if u.Description != nil {
+		fields["description"] = *u.Description
+	}
+
+	if u.Author != nil {
+		fields["author"] = *u.Author
+	}
+
+	if u.Publisher != nil {
+		fields["publisher"] = *u.Publisher
+	}
+
+	if u.PublicationYear != nil {
+		fields["publicationYear"] = *u.PublicationYear
+	}
+
+	return fields
+}
+
+// Set fields sent on book, price only when currency is sent
+func (u *BookUpdateModel) Apply(book *BookModel) {
+	if u.Title != nil {
+		book.Title = *u.Title
+	}
+
+	if u.Description != nil {
+		book.Description = *u.Description
+	}
+
+	if u.Author != nil {
+		book.Author = *u.Author
+	}
+
+	if u.Publisher != nil {
+		book.Publisher = *u.Publisher
+	}
+
+	if u.PublicationYear != nil {
+		book.PublicationYear = *u.PublicationYear
+	}
+
+	if u.Currency != "" {
+		book.Price = u.Price
+		book.Currency = u.Currency
+	}
+}
+
+// Price is in minor units of the currency, e.g. cents for USD
+func validatePrice(result *helper.ValidationError, price int64, currency string) {
+	if price < 0 {
+		result.Add("price", helper.CodeOutOfRange, "price can't be negative")
+	}
+
+	if currency == "" && price != 0 {
+		result.Add("currency", helper.CodeRequired, "currency is required when price is set")
+	}
+
+	if currency != "" && !helper.IsCurrency(currency) {
+		result.Add("currency", helper.CodeInvalid, "currency must be an ISO 4217 code")
+	}
 }
 
 func (u *BookModel) Render(w http.ResponseWriter, r *http.Request) error {
@@ -36,6 +162,31 @@ func (u *BookModel) TableName() string {
 	return "books"
 }
 
+// Parse book filter from query params
+func NewBookFilterModel(r *http.Request) (*BookFilterModel, error) {
+	query := r.URL.Query()
+
+	f := new(BookFilterModel)
+	f.Author = query.Get("author")
+	f.Publisher = query.Get("publisher")
+
+	var err error
+
+	if s := query.Get("publicationYearFrom"); s != "" {
+		if f.PublicationYearFrom, err = strconv.Atoi(s); err != nil {
+			return nil, errors.New("publicationYearFrom must be a number")
+		}
+	}
+
+	if s := query.Get("publicationYearTo"); s != "" {
+		if f.PublicationYearTo, err = strconv.Atoi(s); err != nil {
+			return nil, errors.New("publicationYearTo must be a number")
+		}
+	}
+
+	return f, nil
+}
+
 func NewBookModel() *BookModel {
 	s := new(BookModel)
 
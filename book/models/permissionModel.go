@@ -0,0 +1,9 @@
+package models
+
+// Permissions granted by auth service roles
+const (
+	PermissionBookRead   = "book:read"
+	PermissionBookWrite  = "book:write"
+	PermissionStockRead  = "stock:read"
+	PermissionStockWrite = "stock:write"
+)
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ariefsn/book-store/book/helper"
+)
+
+// Price of book from effectiveAt until the next price takes effect.
+// Rows are never changed except appliedAt, so they form the price history.
+type PriceModel struct {
+	ID          int        `json:"id" gorm:"autoIncrement"`
+	BookID      int        `json:"bookId" gorm:"column:bookId"`
+	Price       int64      `json:"price"`
+	Currency    string     `json:"currency"`
+	EffectiveAt *time.Time `json:"effectiveAt" gorm:"column:effectiveAt"`
+	AppliedAt   *time.Time `json:"appliedAt" gorm:"column:appliedAt"`
+	CreatedAt   *time.Time `json:"createdAt" gorm:"column:createdAt"`
+}
+
+type PriceListModel struct {
+	Prices     []PriceModel `json:"list"`
+	Total      int64        `json:"total"`
+	Page       int          `json:"page"`
+	Limit      int          `json:"limit"`
+	NextCursor string       `json:"nextCursor"`
+}
+
+func (p *PriceModel) Bind(r *http.Request) error {
+	result := &helper.ValidationError{}
+
+	if p.Currency == "" {
+		result.Add("currency", helper.CodeRequired, "currency can't be empty")
+
+		return result
+	}
+
+	validatePrice(result, p.Price, p.Currency)
+
+	return result.Err()
+}
+
+func (p *PriceModel) TableName() string {
+	return "book_prices"
+}
+
+func NewPriceModel() *PriceModel {
+	s := new(PriceModel)
+
+	return s
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Header carrying the idempotency key of a stock movement
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const (
+	MovementReceive = "receive"
+	MovementSell    = "sell"
+	MovementAdjust  = "adjust"
+	MovementReturn  = "return"
+)
+
+type StockModel struct {
+	BookID    int        `json:"bookId" gorm:"column:bookId;primaryKey"`
+	Quantity  int        `json:"quantity"`
+	UpdatedAt *time.Time `json:"updatedAt" gorm:"column:updatedAt"`
+}
+
+type StockMovementModel struct {
+	ID        int        `json:"id" gorm:"autoIncrement"`
+	BookID    int        `json:"bookId" gorm:"column:bookId"`
+	Type      string     `json:"type"`
+	Quantity  int        `json:"quantity"`
+	Balance   int        `json:"balance"`
+	Note      string     `json:"note"`
+	UserID    int        `json:"userId" gorm:"column:userId"`
+	CreatedAt *time.Time `json:"createdAt" gorm:"column:createdAt"`
+
+	// Key the caller sends with a movement, a movement sent again with the same key isn't applied twice
+	IdempotencyKey *string `json:"-" gorm:"column:idempotencyKey"`
+}
+
+type StockMovementListModel struct {
+	Movements  []StockMovementModel `json:"list"`
+	Total      int64                `json:"total"`
+	Page       int                  `json:"page"`
+	Limit      int                  `json:"limit"`
+	NextCursor string               `json:"nextCursor"`
+}
+
+func (s *StockMovementModel) Bind(r *http.Request) error {
+	switch s.Type {
+	case MovementReceive, MovementSell, MovementReturn:
+		if s.Quantity <= 0 {
+			return errors.New("quantity must be positive")
+		}
+	case MovementAdjust:
+		if s.Quantity == 0 {
+			return errors.New("quantity can't be zero")
+		}
+	default:
+		return errors.New("type must be one of receive, sell, adjust, return")
+	}
+
+	return nil
+}
+
+func (s *StockModel) TableName() string {
+	return "book_stocks"
+}
+
+func (s *StockMovementModel) TableName() string {
+	return "stock_movements"
+}
+
+// Change applied to stock level, sell is the only movement taking stock out.
+// Adjust is signed by the caller.
+func (s *StockMovementModel) Delta() int {
+	if s.Type == MovementSell {
+		return -s.Quantity
+	}
+
+	return s.Quantity
+}
+
+func NewStockMovementModel() *StockMovementModel {
+	s := new(StockMovementModel)
+
+	return s
+}
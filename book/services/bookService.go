@@ -1,12 +1,12 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
 	"time"
 
 	"github.com/ariefsn/book-store/book/helper"
@@ -19,7 +19,7 @@ import (
 
 var db *gorm.DB
 
-var baseUrl = "http://" + os.Getenv("URL_AUTH")
+var authService = helper.GetUpstream("auth")
 
 // Init service and register new connection
 func InitService(sqlDb *sql.DB) (err error) {
@@ -43,83 +43,191 @@ func InitService(sqlDb *sql.DB) (err error) {
 		return err
 	}
 
+	if err = helper.InstrumentDB(db, "book"); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// Find user by id
-func GetUserByID(r *http.Request, id int) (map[string]interface{}, int, error) {
+// Find permissions of active user
+func GetUserPermissions(r *http.Request) ([]string, int, error) {
 	header := req.Header{
-		"Accept": "application/json",
-		"Claims": r.Header.Get("Claims"),
+		"Accept":              "application/json",
+		helper.IdentityHeader: helper.ForwardIdentity(r, "auth"),
 	}
 
-	req := req.New()
-
-	idS := strconv.Itoa(id)
+	res, err := authService.Request().Get(authService.Url("/user/me/permission"), header, r.Context())
 
-	res, err := req.Get(baseUrl+"/user/"+idS, header)
+	if err != nil {
+		err = authService.Failure(err)
 
-	if err != nil || res.Response().StatusCode != 200 {
-		return nil, res.Response().StatusCode, errors.New(res.Response().Status)
+		return nil, helper.ErrorStatus(err), err
 	}
 
 	newRes := helper.ResponseModel{}
 
-	res.ToJSON(&newRes)
+	if err := authService.Decode(res, &newRes); err != nil {
+		return nil, helper.ErrorStatus(err), err
+	}
 
 	if !newRes.Success {
+		// rejections of the user are passed on, anything else is a failure of auth
+		if newRes.HTTPStatusCode < 400 || newRes.HTTPStatusCode >= 500 {
+			err := authService.Failure(errors.New(newRes.Message))
+
+			return nil, helper.ErrorStatus(err), err
+		}
+
 		return nil, newRes.HTTPStatusCode, errors.New(newRes.Message)
 	}
 
-	user := newRes.Data.(map[string]interface{})
+	data, ok := newRes.Data.([]interface{})
+
+	if !ok {
+		err := authService.Failure(errors.New("permissions aren't a list"))
+
+		return nil, helper.ErrorStatus(err), err
+	}
+
+	permissions := []string{}
+
+	for _, p := range data {
+		if permission, ok := p.(string); ok {
+			permissions = append(permissions, permission)
+		}
+	}
 
-	return user, 200, nil
+	return permissions, http.StatusOK, nil
 }
 
 // Find book by id
-func GetBookByID(id int) (*models.BookModel, error) {
+func GetBookByID(ctx context.Context, id int) (*models.BookModel, error) {
 	user := models.NewBookModel()
 
-	res := db.Table(user.TableName()).Where("id = ?", id).First(&user)
+	res := db.WithContext(ctx).Table(user.TableName()).Where("id = ?", id).First(&user)
 
 	return user, res.Error
 }
 
-// Find book by email
-func GetBookByEmail(email string) (*models.BookModel, error) {
-	user := models.NewBookModel()
+// Find books matching filter, one page at a time
+func GetBooks(ctx context.Context, filter *models.BookFilterModel, page *helper.Pagination) (*models.BookListModel, error) {
+	list := &models.BookListModel{
+		Books: []models.BookModel{},
+		Page:  page.Page,
+		Limit: page.Limit,
+	}
 
-	res := db.Table(user.TableName()).Where("email = ?", email).First(&user)
+	scope := func(tx *gorm.DB) *gorm.DB {
+		if filter.Author != "" {
+			tx = tx.Where("author LIKE ?", "%"+filter.Author+"%")
+		}
 
-	return user, res.Error
-}
+		if filter.Publisher != "" {
+			tx = tx.Where("publisher LIKE ?", "%"+filter.Publisher+"%")
+		}
+
+		if filter.PublicationYearFrom != 0 {
+			tx = tx.Where("publicationYear >= ?", filter.PublicationYearFrom)
+		}
+
+		if filter.PublicationYearTo != 0 {
+			tx = tx.Where("publicationYear <= ?", filter.PublicationYearTo)
+		}
+
+		return tx
+	}
+
+	table := models.NewBookModel().TableName()
 
-// Find all books
-func GetBooks() ([]models.BookModel, error) {
-	users := []models.BookModel{}
+	if res := db.WithContext(ctx).Table(table).Scopes(scope).Count(&list.Total); res.Error != nil {
+		return nil, res.Error
+	}
 
-	res := db.Table(models.NewBookModel().TableName()).Find(&users)
+	if res := db.WithContext(ctx).Table(table).Scopes(scope, page.Scope).Find(&list.Books); res.Error != nil {
+		return nil, res.Error
+	}
 
-	return users, res.Error
+	list.NextCursor = page.Paginate(&list.Books)
+
+	return list, nil
 }
 
 // Create new book
-func CreateBook(user *models.BookModel) (int64, error) {
-	res := db.Table(user.TableName()).Create(&user)
+func CreateBook(ctx context.Context, user *models.BookModel) (int64, error) {
+	var rows int64
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(user.TableName()).Create(&user)
+
+		if res.Error != nil {
+			return res.Error
+		}
 
-	return res.RowsAffected, res.Error
+		rows = res.RowsAffected
+
+		return recordPrice(tx, user, nil)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	booksCreated.Inc()
+
+	logIndexError(indexBook(user))
+
+	return rows, nil
 }
 
-// Update book
-func UpdateBook(id int, data *models.BookModel) int64 {
-	res := db.Where("id = ?", id).Save(&data)
+// Update fields of book which are sent, price change is recorded on price history.
+// Price is kept when no currency is given.
+func UpdateBook(ctx context.Context, id int, data *models.BookUpdateModel) (int64, error) {
+	previous, err := GetBookByID(ctx, id)
 
-	return res.RowsAffected
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+
+	book := *previous
+	data.Apply(&book)
+	book.UpdatedAt = &now
+
+	fields := data.Fields()
+	fields["updatedAt"] = now
+
+	var rows int64
+
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(book.TableName()).Where("id = ?", id).Updates(fields)
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		rows = res.RowsAffected
+
+		return recordPrice(tx, &book, previous)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	logIndexError(indexBook(&book))
+
+	return rows, nil
 }
 
 // Delete book
-func DeleteBook(data *models.BookModel) int64 {
-	res := db.Delete(&data)
+func DeleteBook(ctx context.Context, data *models.BookModel) int64 {
+	res := db.WithContext(ctx).Delete(&data)
+
+	if res.Error == nil {
+		logIndexError(unindexBook(data.ID))
+	}
 
 	return res.RowsAffected
 }
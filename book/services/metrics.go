@@ -0,0 +1,12 @@
+package services
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Business counters, served with the request metrics at /metrics
+var booksCreated = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "book_books_created_total",
+	Help: "Books added to the catalog.",
+})
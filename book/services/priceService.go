@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ariefsn/book-store/book/helper"
+	"github.com/ariefsn/book-store/book/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Record price of book, price is applied now when effectiveAt is empty or has passed,
+// otherwise it's scheduled and applied by ApplyScheduledPrices
+func CreatePrice(ctx context.Context, price *models.PriceModel) error {
+	now := time.Now()
+
+	if price.EffectiveAt == nil || price.EffectiveAt.Before(now) {
+		price.EffectiveAt = &now
+	}
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		price.ID = 0
+
+		if err := tx.Table(price.TableName()).Create(&price).Error; err != nil {
+			return err
+		}
+
+		if price.EffectiveAt.After(now) {
+			return nil
+		}
+
+		return applyPrice(tx, price, now)
+	})
+}
+
+// Record current price of book after it's created or updated, nothing is recorded when price didn't change
+func recordPrice(tx *gorm.DB, book *models.BookModel, previous *models.BookModel) error {
+	if previous != nil && previous.Price == book.Price && previous.Currency == book.Currency {
+		return nil
+	}
+
+	if book.Currency == "" {
+		return nil
+	}
+
+	now := time.Now()
+
+	price := models.NewPriceModel()
+	price.BookID = book.ID
+	price.Price = book.Price
+	price.Currency = book.Currency
+	price.EffectiveAt = &now
+
+	if err := tx.Table(price.TableName()).Create(&price).Error; err != nil {
+		return err
+	}
+
+	return applyPrice(tx, price, now)
+}
+
+// Set price on book and mark it applied.
+// Scheduled prices which should have taken effect before it are superseded.
+func applyPrice(tx *gorm.DB, price *models.PriceModel, now time.Time) error {
+	res := tx.Table(models.NewBookModel().TableName()).
+		Where("id = ?", price.BookID).
+		Updates(map[string]interface{}{"price": price.Price, "currency": price.Currency})
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	res = tx.Table(price.TableName()).
+		Where("bookId = ? AND appliedAt IS NULL AND (id = ? OR effectiveAt < ?)", price.BookID, price.ID, price.EffectiveAt).
+		Update("appliedAt", now)
+
+	price.AppliedAt = &now
+
+	return res.Error
+}
+
+// Apply scheduled prices whose effective date has passed, in order of their effective date
+func ApplyScheduledPrices() (int, error) {
+	count := 0
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		prices := []models.PriceModel{}
+
+		now := time.Now()
+
+		res := tx.Table(models.NewPriceModel().TableName()).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("appliedAt IS NULL AND effectiveAt <= ?", now).
+			Order("effectiveAt, id").
+			Find(&prices)
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		for i := range prices {
+			if err := applyPrice(tx, &prices[i], now); err != nil {
+				return err
+			}
+		}
+
+		count = len(prices)
+
+		return nil
+	})
+
+	return count, err
+}
+
+// Run ApplyScheduledPrices every interval
+func SchedulePrices(interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := ApplyScheduledPrices(); err != nil {
+			fmt.Println("[Error] apply scheduled prices:", err.Error())
+		}
+	}
+}
+
+// Find price history of book, including scheduled prices
+func GetPrices(ctx context.Context, bookId int, page *helper.Pagination) (*models.PriceListModel, error) {
+	list := &models.PriceListModel{
+		Prices: []models.PriceModel{},
+		Page:   page.Page,
+		Limit:  page.Limit,
+	}
+
+	table := models.NewPriceModel().TableName()
+
+	scope := func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("bookId = ?", bookId)
+	}
+
+	if res := db.WithContext(ctx).Table(table).Scopes(scope).Count(&list.Total); res.Error != nil {
+		return nil, res.Error
+	}
+
+	if res := db.WithContext(ctx).Table(table).Scopes(scope, page.Scope).Find(&list.Prices); res.Error != nil {
+		return nil, res.Error
+	}
+
+	list.NextCursor = page.Paginate(&list.Prices)
+
+	return list, nil
+}
+
+// Find price of book effective at the given time
+func GetPriceAt(ctx context.Context, bookId int, at time.Time) (*models.PriceModel, error) {
+	price := models.NewPriceModel()
+
+	res := db.WithContext(ctx).Table(price.TableName()).
+		Where("bookId = ? AND effectiveAt <= ?", bookId, at).
+		Order("effectiveAt DESC, id DESC").
+		First(&price)
+
+	return price, res.Error
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ariefsn/book-store/book/helper"
+	"github.com/ariefsn/book-store/book/models"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"gorm.io/gorm"
+)
+
+var index bleve.Index
+
+// Searchable fields and their boost on relevance
+var searchFields = map[string]float64{
+	"title":       3,
+	"author":      2,
+	"publisher":   1,
+	"description": 1,
+}
+
+// Location of search index, configurable through SEARCH_INDEX_PATH
+func searchIndexPath() string {
+	path := "data/books.bleve"
+
+	if os.Getenv("SEARCH_INDEX_PATH") != "" {
+		path = os.Getenv("SEARCH_INDEX_PATH")
+	}
+
+	return path
+}
+
+func searchMapping() mapping.IndexMapping {
+	text := bleve.NewTextFieldMapping()
+	text.Analyzer = "en"
+
+	book := bleve.NewDocumentStaticMapping()
+
+	for field := range searchFields {
+		book.AddFieldMappingsAt(field, text)
+	}
+
+	m := bleve.NewIndexMapping()
+	m.DefaultMapping = book
+
+	return m
+}
+
+// Open search index, a new index is built from database when it doesn't exist yet
+func InitSearchIndex() (err error) {
+	path := searchIndexPath()
+
+	index, err = bleve.Open(path)
+
+	if err == nil {
+		return nil
+	}
+
+	if err != bleve.ErrorIndexPathDoesNotExist {
+		return err
+	}
+
+	index, err = bleve.New(path, searchMapping())
+
+	if err != nil {
+		return err
+	}
+
+	_, err = indexAllBooks()
+
+	return err
+}
+
+// Drop search index and build it again from database
+func RebuildSearchIndex() (int, error) {
+	path := searchIndexPath()
+
+	if index != nil {
+		index.Close()
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		return 0, err
+	}
+
+	var err error
+
+	index, err = bleve.New(path, searchMapping())
+
+	if err != nil {
+		return 0, err
+	}
+
+	return indexAllBooks()
+}
+
+func indexAllBooks() (int, error) {
+	books := []models.BookModel{}
+	count := 0
+
+	res := db.Table(models.NewBookModel().TableName()).FindInBatches(&books, 500, func(tx *gorm.DB, batch int) error {
+		b := index.NewBatch()
+
+		for _, book := range books {
+			if err := b.Index(strconv.Itoa(book.ID), book); err != nil {
+				return err
+			}
+		}
+
+		count += len(books)
+
+		return index.Batch(b)
+	})
+
+	return count, res.Error
+}
+
+// Add or replace book on search index
+func indexBook(book *models.BookModel) error {
+	return index.Index(strconv.Itoa(book.ID), book)
+}
+
+// Remove book from search index
+func unindexBook(id int) error {
+	return index.Delete(strconv.Itoa(id))
+}
+
+// Search books by relevance across title, author, publisher and description.
+// Terms are matched with an edit distance of 1 to tolerate typos.
+func SearchBooks(q string, page *helper.Pagination) (*models.BookSearchModel, error) {
+	queries := []query.Query{}
+
+	for field, boost := range searchFields {
+		match := bleve.NewMatchQuery(q)
+		match.SetField(field)
+		match.SetFuzziness(1)
+		match.SetBoost(boost)
+
+		queries = append(queries, match)
+	}
+
+	request := bleve.NewSearchRequestOptions(bleve.NewDisjunctionQuery(queries...), page.Limit, (page.Page-1)*page.Limit, false)
+	request.Highlight = bleve.NewHighlightWithStyle("html")
+
+	for field := range searchFields {
+		request.Highlight.AddField(field)
+	}
+
+	res, err := index.Search(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.BookSearchModel{
+		Hits:  []models.BookHitModel{},
+		Total: res.Total,
+		Page:  page.Page,
+		Limit: page.Limit,
+	}
+
+	if len(res.Hits) == 0 {
+		return result, nil
+	}
+
+	ids := []int{}
+
+	for _, hit := range res.Hits {
+		id, _ := strconv.Atoi(hit.ID)
+		ids = append(ids, id)
+	}
+
+	books := []models.BookModel{}
+
+	if res := db.Table(models.NewBookModel().TableName()).Where("id IN ?", ids).Find(&books); res.Error != nil {
+		return nil, res.Error
+	}
+
+	byId := map[string]models.BookModel{}
+
+	for _, book := range books {
+		byId[strconv.Itoa(book.ID)] = book
+	}
+
+	for _, hit := range res.Hits {
+		book, ok := byId[hit.ID]
+
+		if !ok {
+			// stale entry, book was removed outside of this service
+			continue
+		}
+
+		result.Hits = append(result.Hits, models.BookHitModel{
+			Book:       book,
+			Score:      hit.Score,
+			Highlights: hit.Fragments,
+		})
+	}
+
+	return result, nil
+}
+
+// Log index failure, database stays the source of truth and the index can be rebuilt
+func logIndexError(err error) {
+	if err != nil {
+		fmt.Println("[Error] search index:", err.Error())
+	}
+}
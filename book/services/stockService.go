@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ariefsn/book-store/book/helper"
+	"github.com/ariefsn/book-store/book/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// Find current stock of book, book without movement has no stock
+func GetStock(ctx context.Context, bookId int) (*models.StockModel, error) {
+	stock := &models.StockModel{BookID: bookId}
+
+	res := db.WithContext(ctx).Table(stock.TableName()).Where("bookId = ?", bookId).Limit(1).Find(&stock)
+
+	return stock, res.Error
+}
+
+// Find stock movements of book, newest first
+func GetStockMovements(ctx context.Context, bookId int, page *helper.Pagination) (*models.StockMovementListModel, error) {
+	list := &models.StockMovementListModel{
+		Movements: []models.StockMovementModel{},
+		Page:      page.Page,
+		Limit:     page.Limit,
+	}
+
+	table := models.NewStockMovementModel().TableName()
+
+	scope := func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("bookId = ?", bookId)
+	}
+
+	if res := db.WithContext(ctx).Table(table).Scopes(scope).Count(&list.Total); res.Error != nil {
+		return nil, res.Error
+	}
+
+	if res := db.WithContext(ctx).Table(table).Scopes(scope, page.Scope).Find(&list.Movements); res.Error != nil {
+		return nil, res.Error
+	}
+
+	list.NextCursor = page.Paginate(&list.Movements)
+
+	return list, nil
+}
+
+// Append movement to the ledger and update stock level.
+// Stock row is locked for the whole transaction, so concurrent movements are applied one by one
+// and stock never goes below zero. A movement with the key of one already applied is answered with that one.
+func CreateStockMovement(ctx context.Context, movement *models.StockMovementModel) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stock := &models.StockModel{BookID: movement.BookID}
+
+		res := tx.Table(stock.TableName()).Clauses(clause.OnConflict{DoNothing: true}).Create(&stock)
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		res = tx.Table(stock.TableName()).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("bookId = ?", movement.BookID).
+			First(&stock)
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if movement.IdempotencyKey != nil {
+			applied := models.NewStockMovementModel()
+
+			res = tx.Table(applied.TableName()).Where("idempotencyKey = ?", *movement.IdempotencyKey).Limit(1).Find(&applied)
+
+			if res.Error != nil {
+				return res.Error
+			}
+
+			if res.RowsAffected > 0 {
+				*movement = *applied
+
+				return nil
+			}
+		}
+
+		balance := stock.Quantity + movement.Delta()
+
+		if balance < 0 {
+			return ErrInsufficientStock
+		}
+
+		res = tx.Table(stock.TableName()).
+			Where("bookId = ?", movement.BookID).
+			Updates(map[string]interface{}{"quantity": balance, "updatedAt": time.Now()})
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		movement.ID = 0
+		movement.Balance = balance
+
+		return tx.Table(movement.TableName()).Create(&movement).Error
+	})
+}
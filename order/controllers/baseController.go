@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ariefsn/book-store/order/helper"
+	"github.com/ariefsn/book-store/order/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type BaseController struct{}
+
+// Identity of active user, verified by helper.IdentityVerifier
+func (b *BaseController) Identity(r *http.Request) *helper.Identity {
+	return helper.IdentityFromContext(r.Context())
+}
+
+// Id of active user
+func (b *BaseController) UserId(r *http.Request) int {
+	return b.Identity(r).UserID()
+}
+
+func (b *BaseController) ValidateId(r *http.Request) (int, int, error) {
+	if chi.URLParam(r, "id") == "" {
+		return 0, http.StatusInternalServerError, errors.New("id can't be empty")
+	}
+
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	return id, http.StatusOK, nil
+}
+
+// Check active user has the permission through its roles
+func (b *BaseController) HasPermission(r *http.Request, permission string) (bool, int, error) {
+	permissions, code, err := services.GetUserPermissions(r)
+
+	if err != nil {
+		return false, code, err
+	}
+
+	for _, p := range permissions {
+		if p == permission {
+			return true, http.StatusOK, nil
+		}
+	}
+
+	return false, http.StatusOK, nil
+}
+
+// Middleware for allow only user which has one of the permissions through its roles.
+// Permissions are limited to the scopes of the API key the user authenticated with.
+func (b *BaseController) Permission(permissions ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			granted, code, err := services.GetUserPermissions(r)
+
+			if err != nil {
+				render.Render(w, r, helper.ResponseError(code, err))
+				return
+			}
+
+			for _, p := range granted {
+				for _, permission := range permissions {
+					if p == permission {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			render.Render(w, r, helper.ResponseError(http.StatusForbidden, errors.New("permission denied")))
+		})
+	}
+}
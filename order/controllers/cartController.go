@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ariefsn/book-store/order/helper"
+	"github.com/ariefsn/book-store/order/models"
+	"github.com/ariefsn/book-store/order/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type CartController struct {
+	BaseController
+}
+
+func NewCartController() *CartController {
+	c := new(CartController)
+
+	return c
+}
+
+// Handler for get cart of active user
+func (c *CartController) Find(w http.ResponseWriter, r *http.Request) {
+	cart, err := services.GetCart(r.Context(), c.UserId(r))
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(cart))
+}
+
+// Handler for add book to cart
+func (c *CartController) AddItem(w http.ResponseWriter, r *http.Request) {
+	payload := models.CartItemModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	if _, code, err := services.GetBookByID(r, payload.BookID); err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	payload.ID = 0
+	payload.UserID = c.UserId(r)
+
+	if err := services.AddCartItem(r.Context(), &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	cart, err := services.GetCart(r.Context(), payload.UserID)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(cart))
+}
+
+// Handler for set quantity of book in cart
+func (c *CartController) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	payload := models.CartItemModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	bookId, _ := strconv.Atoi(chi.URLParam(r, "bookId"))
+
+	row := services.UpdateCartItem(r.Context(), c.UserId(r), bookId, payload.Quantity)
+
+	if row == 0 {
+		render.Render(w, r, helper.ResponseError(http.StatusNotFound, errors.New("book not in cart")))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(row))
+}
+
+// Handler for remove book from cart
+func (c *CartController) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	bookId, _ := strconv.Atoi(chi.URLParam(r, "bookId"))
+
+	row := services.DeleteCartItem(r.Context(), c.UserId(r), bookId)
+
+	render.Render(w, r, helper.ResponseSuccess(row))
+}
+
+// Handler for remove all books from cart
+func (c *CartController) Clear(w http.ResponseWriter, r *http.Request) {
+	row := services.ClearCart(r.Context(), c.UserId(r))
+
+	render.Render(w, r, helper.ResponseSuccess(row))
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ariefsn/book-store/order/helper"
+	"github.com/ariefsn/book-store/order/models"
+	"github.com/ariefsn/book-store/order/services"
+	"github.com/go-chi/render"
+)
+
+type OrderController struct {
+	BaseController
+}
+
+func NewOrderController() *OrderController {
+	c := new(OrderController)
+
+	return c
+}
+
+func (c *OrderController) Hi(w http.ResponseWriter, r *http.Request) {
+	render.Render(w, r, helper.ResponseSuccess("Hi, Welcome to Order Service Version 1"))
+}
+
+// Handler for checkout cart of active user
+func (c *OrderController) Checkout(w http.ResponseWriter, r *http.Request) {
+	order, code, err := services.Checkout(r, c.UserId(r))
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(order))
+}
+
+// Handler for get orders of active user
+func (c *OrderController) Mine(w http.ResponseWriter, r *http.Request) {
+	c.list(w, r, c.UserId(r))
+}
+
+// Handler for get orders of all users
+func (c *OrderController) All(w http.ResponseWriter, r *http.Request) {
+	c.list(w, r, 0)
+}
+
+func (c *OrderController) list(w http.ResponseWriter, r *http.Request, userId int) {
+	page, err := helper.ParsePagination(r, "createdAt", "total")
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(http.StatusBadRequest, err))
+		return
+	}
+
+	orders, err := services.GetOrders(r.Context(), userId, r.URL.Query().Get("status"), page)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(orders))
+}
+
+// Handler for find order, other users' orders need order:read
+func (c *OrderController) Find(w http.ResponseWriter, r *http.Request) {
+	order, code, err := c.findOrder(r, models.PermissionOrderRead)
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(order))
+}
+
+// Handler for change order status.
+// Owner may cancel its pending order, every other change needs order:write.
+func (c *OrderController) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	payload := models.OrderStatusModel{}
+
+	if err := render.Bind(r, &payload); err != nil {
+		render.Render(w, r, helper.ResponseError(422, err))
+		return
+	}
+
+	order, code, err := c.findOrder(r, "")
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(code, err))
+		return
+	}
+
+	ownerCancel := order.UserID == c.UserId(r) && payload.Status == models.StatusCancelled
+
+	if !ownerCancel {
+		allowed, code, err := c.HasPermission(r, models.PermissionOrderWrite)
+
+		if err != nil {
+			render.Render(w, r, helper.ResponseError(code, err))
+			return
+		}
+
+		if !allowed {
+			render.Render(w, r, helper.ResponseError(http.StatusForbidden, errors.New("permission denied")))
+			return
+		}
+	}
+
+	err = services.UpdateOrderStatus(r.Context(), order, payload.Status)
+
+	if errors.Is(err, services.ErrInvalidStatus) {
+		render.Render(w, r, helper.ResponseError(http.StatusConflict, err))
+		return
+	}
+
+	if err != nil {
+		render.Render(w, r, helper.ResponseError(helper.ErrorStatus(err), err))
+		return
+	}
+
+	if order.Status == models.StatusCancelled {
+		services.ReturnOrderStock(r, order)
+	}
+
+	render.Render(w, r, helper.ResponseSuccess(order))
+}
+
+// Find order from url, order of another user is only returned with the permission.
+// Empty permission skips the check and leaves it to the caller.
+func (c *OrderController) findOrder(r *http.Request, permission string) (*models.OrderModel, int, error) {
+	id, code, err := c.ValidateId(r)
+
+	if err != nil {
+		return nil, code, err
+	}
+
+	order, err := services.GetOrderByID(r.Context(), id)
+
+	if err != nil {
+		return nil, helper.ErrorStatus(err), err
+	}
+
+	if permission == "" || order.UserID == c.UserId(r) {
+		return order, http.StatusOK, nil
+	}
+
+	allowed, code, err := c.HasPermission(r, permission)
+
+	if err != nil {
+		return nil, code, err
+	}
+
+	if !allowed {
+		return nil, http.StatusForbidden, errors.New("permission denied")
+	}
+
+	return order, http.StatusOK, nil
+}
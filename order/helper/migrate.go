@@ -0,0 +1,370 @@
+package helper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Schema change of a service, statements are run in order.
+// Down must revert everything Up does.
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+// Migration to run and its direction
+type MigrationStep struct {
+	Migration
+	Revert bool
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Applies migrations of a service, versions are recorded per service in schema_migrations
+type Migrator struct {
+	db         *sql.DB
+	service    string
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, service string, migrations []Migration) *Migrator {
+	sorted := append([]Migration{}, migrations...)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return &Migrator{db: db, service: service, migrations: sorted}
+}
+
+// Check migrations should be applied on startup, enabled through DB_MIGRATE
+func AutoMigrate() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("DB_MIGRATE"))
+
+	return enabled
+}
+
+// Latest version known by the service
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Steps to move from applied versions to target version.
+// Pending migrations up to target are applied in ascending order, applied ones above target are reverted in descending order.
+func (m *Migrator) Plan(applied map[int]bool, target int) []MigrationStep {
+	steps := []MigrationStep{}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		if mg := m.migrations[i]; mg.Version > target && applied[mg.Version] {
+			steps = append(steps, MigrationStep{Migration: mg, Revert: true})
+		}
+	}
+
+	for _, mg := range m.migrations {
+		if mg.Version <= target && !applied[mg.Version] {
+			steps = append(steps, MigrationStep{Migration: mg})
+		}
+	}
+
+	return steps
+}
+
+// Apply all pending migrations
+func (m *Migrator) Up() ([]MigrationStep, error) {
+	return m.To(m.Latest())
+}
+
+// Revert the last applied migration
+func (m *Migrator) Down() ([]MigrationStep, error) {
+	var steps []MigrationStep
+
+	err := m.locked(func(conn *sql.Conn) error {
+		applied, err := m.applied(conn)
+
+		if err != nil {
+			return err
+		}
+
+		last := 0
+
+		for version := range applied {
+			if version > last {
+				last = version
+			}
+		}
+
+		if last == 0 {
+			return nil
+		}
+
+		previous := 0
+
+		for _, mg := range m.migrations {
+			if mg.Version < last && mg.Version > previous {
+				previous = mg.Version
+			}
+		}
+
+		steps = m.Plan(applied, previous)
+
+		return m.run(conn, steps)
+	})
+
+	return steps, err
+}
+
+// Apply or revert migrations until version is the latest applied one
+func (m *Migrator) To(version int) ([]MigrationStep, error) {
+	if version != 0 && !m.exists(version) {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+
+	var steps []MigrationStep
+
+	err := m.locked(func(conn *sql.Conn) error {
+		applied, err := m.applied(conn)
+
+		if err != nil {
+			return err
+		}
+
+		steps = m.Plan(applied, version)
+
+		return m.run(conn, steps)
+	})
+
+	return steps, err
+}
+
+// Known migrations and when they were applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	status := []MigrationStatus{}
+
+	err := m.locked(func(conn *sql.Conn) error {
+		rows, err := conn.QueryContext(context.Background(), "SELECT version, appliedAt FROM schema_migrations WHERE service = ?", m.service)
+
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+
+		appliedAt := map[int]time.Time{}
+
+		for rows.Next() {
+			var version int
+			var at time.Time
+
+			if err := rows.Scan(&version, &at); err != nil {
+				return err
+			}
+
+			appliedAt[version] = at
+		}
+
+		for _, mg := range m.migrations {
+			s := MigrationStatus{Migration: mg}
+
+			if at, ok := appliedAt[mg.Version]; ok {
+				s.AppliedAt = &at
+			}
+
+			status = append(status, s)
+		}
+
+		return rows.Err()
+	})
+
+	return status, err
+}
+
+func (m *Migrator) exists(version int) bool {
+	for _, mg := range m.migrations {
+		if mg.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Run fn holding a lock per service, so replicas starting together don't apply the same migration twice
+func (m *Migrator) locked(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+
+	conn, err := m.db.Conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	lock := "schema_migrations:" + m.service
+
+	var acquired sql.NullInt64
+
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 60)", lock).Scan(&acquired); err != nil {
+		return err
+	}
+
+	if acquired.Int64 != 1 {
+		return errors.New("timeout waiting for migration lock")
+	}
+
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lock)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+  service VARCHAR(50) NOT NULL,
+  version int NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  appliedAt DATETIME NOT NULL,
+  PRIMARY KEY(service, version)
+)`)
+
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) applied(conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT version FROM schema_migrations WHERE service = ?", m.service)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := map[int]bool{}
+
+	for rows.Next() {
+		var version int
+
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// Run statements of every step and record it.
+// MySQL commits DDL implicitly, a failed step stops the run and is reported with its version so it can be fixed by hand.
+func (m *Migrator) run(conn *sql.Conn, steps []MigrationStep) error {
+	ctx := context.Background()
+
+	for _, step := range steps {
+		statements := step.Up
+
+		if step.Revert {
+			statements = step.Down
+		}
+
+		for _, statement := range statements {
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("migration %d %s: %w", step.Version, step.Name, err)
+			}
+		}
+
+		var err error
+
+		if step.Revert {
+			_, err = conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE service = ? AND version = ?", m.service, step.Version)
+		} else {
+			_, err = conn.ExecContext(ctx, "INSERT INTO schema_migrations (service, version, name, appliedAt) VALUES (?, ?, ?, ?)", m.service, step.Version, step.Name, time.Now())
+		}
+
+		if err != nil {
+			return fmt.Errorf("migration %d %s: %w", step.Version, step.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Run migrate subcommand: up, down, status or to <version>
+func RunMigrate(m *Migrator, args []string) error {
+	command := "up"
+
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	var steps []MigrationStep
+	var err error
+
+	switch command {
+	case "up":
+		steps, err = m.Up()
+	case "down":
+		steps, err = m.Down()
+	case "to":
+		if len(args) < 2 {
+			return errors.New("usage: migrate to <version>")
+		}
+
+		version, convErr := strconv.Atoi(args[1])
+
+		if convErr != nil {
+			return fmt.Errorf("invalid version %s", args[1])
+		}
+
+		steps, err = m.To(version)
+	case "status":
+		status, err := m.Status()
+
+		if err != nil {
+			return err
+		}
+
+		for _, s := range status {
+			appliedAt := "pending"
+
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Printf("\t%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+
+		return nil
+	default:
+		return errors.New("usage: migrate [up|down|status|to <version>]")
+	}
+
+	for _, step := range steps {
+		direction := "up"
+
+		if step.Revert {
+			direction = "down"
+		}
+
+		fmt.Printf("\t%s\t%d\t%s\n", direction, step.Version, step.Name)
+	}
+
+	if len(steps) == 0 && err == nil {
+		fmt.Println("Nothing to migrate")
+	}
+
+	return err
+}
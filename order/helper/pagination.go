@@ -0,0 +1,214 @@
+package helper
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+type Pagination struct {
+	Page   int
+	Limit  int
+	Sort   string
+	Desc   bool
+	Cursor *Cursor
+}
+
+// Position after the last row of a page, value of sort column and id as tiebreaker
+type Cursor struct {
+	Value interface{} `json:"v"`
+	ID    int         `json:"id"`
+}
+
+// Parse page, limit, sort and cursor query params.
+// Sort is a column name prefixed with "-" for descending order, and must be one of sortable.
+func ParsePagination(r *http.Request, sortable ...string) (*Pagination, error) {
+	query := r.URL.Query()
+
+	p := &Pagination{
+		Page:  1,
+		Limit: defaultLimit,
+		Sort:  "id",
+	}
+
+	if s := query.Get("page"); s != "" {
+		page, err := strconv.Atoi(s)
+
+		if err != nil || page < 1 {
+			return nil, errors.New("page must be a positive number")
+		}
+
+		p.Page = page
+	}
+
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+
+		if err != nil || limit < 1 || limit > maxLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+
+		p.Limit = limit
+	}
+
+	if s := query.Get("sort"); s != "" {
+		p.Desc = strings.HasPrefix(s, "-")
+		p.Sort = strings.TrimPrefix(s, "-")
+
+		if p.Sort != "id" && !contains(sortable, p.Sort) {
+			return nil, fmt.Errorf("can't sort by %s", p.Sort)
+		}
+	}
+
+	if s := query.Get("cursor"); s != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(s)
+
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+
+		p.Cursor = new(Cursor)
+
+		if err := json.Unmarshal(decoded, p.Cursor); err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+	}
+
+	return p, nil
+}
+
+// Scope for ordering, cursor or offset and limit.
+// One extra row is fetched so the caller knows whether there is a next page.
+func (p *Pagination) Scope(tx *gorm.DB) *gorm.DB {
+	direction := "ASC"
+
+	if p.Desc {
+		direction = "DESC"
+	}
+
+	if p.Cursor != nil {
+		cond, args := p.cursorCondition()
+
+		tx = tx.Where(cond, args...)
+	} else {
+		tx = tx.Offset((p.Page - 1) * p.Limit)
+	}
+
+	if p.Sort != "id" {
+		tx = tx.Order(fmt.Sprintf("%s %s", p.Sort, direction))
+	}
+
+	return tx.Order("id " + direction).Limit(p.Limit + 1)
+}
+
+// Rows are sorted by (sort, id), NULL sorts first on ascending order and last on descending order
+func (p *Pagination) cursorCondition() (string, []interface{}) {
+	op := ">"
+
+	if p.Desc {
+		op = "<"
+	}
+
+	if p.Sort == "id" {
+		return "id " + op + " ?", []interface{}{p.Cursor.ID}
+	}
+
+	col := p.Sort
+
+	if p.Cursor.Value == nil {
+		if p.Desc {
+			return fmt.Sprintf("(%s IS NULL AND id < ?)", col), []interface{}{p.Cursor.ID}
+		}
+
+		return fmt.Sprintf("((%s IS NULL AND id > ?) OR %s IS NOT NULL)", col, col), []interface{}{p.Cursor.ID}
+	}
+
+	cond := fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", col, op, col, op)
+
+	if p.Desc {
+		cond = fmt.Sprintf("(%s OR %s IS NULL)", cond, col)
+	}
+
+	return cond, []interface{}{p.Cursor.Value, p.Cursor.Value, p.Cursor.ID}
+}
+
+// Trim the extra row fetched by Scope and build cursor for the next page.
+// rows must be a pointer to slice of models whose json names match column names,
+// without a field for id or sort column there is no cursor and the next page is only reachable by page.
+func (p *Pagination) Paginate(rows interface{}) string {
+	v := reflect.ValueOf(rows).Elem()
+
+	if v.Len() <= p.Limit {
+		return ""
+	}
+
+	v.Set(v.Slice(0, p.Limit))
+
+	last := v.Index(p.Limit - 1)
+
+	id, value := fieldByColumn(last, "id"), fieldByColumn(last, p.Sort)
+
+	if !id.IsValid() || !value.IsValid() {
+		return ""
+	}
+
+	cursor := Cursor{
+		ID:    int(id.Int()),
+		Value: cursorValue(value),
+	}
+
+	encoded, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func cursorValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+
+		v = v.Elem()
+	}
+
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format("2006-01-02 15:04:05.999999")
+	}
+
+	return v.Interface()
+}
+
+func fieldByColumn(v reflect.Value, column string) reflect.Value {
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+
+		if name == column {
+			return v.Field(i)
+		}
+	}
+
+	return reflect.Value{}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
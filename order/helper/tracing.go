@@ -0,0 +1,128 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const dbSpanKey = "tracing:span"
+
+var tracer = otel.Tracer("github.com/ariefsn/book-store/order/helper")
+
+// Start tracing of service. TRACING_EXPORTER decides where spans go: "otlp" to the collector at
+// OTEL_EXPORTER_OTLP_ENDPOINT, "stdout", or nowhere when empty. W3C trace context is propagated either way.
+// The returned function flushes spans which weren't exported yet.
+func InitTracing(service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch exp := os.Getenv("TRACING_EXPORTER"); exp {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background())
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	default:
+		err = fmt.Errorf("unknown tracing exporter %q", exp)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(semconv.ServiceName(service)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Middleware for trace requests, continuing the trace of the caller if any.
+// Spans are named by route pattern, e.g. "GET /book/{id}", like requests are labeled in metrics.
+func Tracing(next http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		route := routePattern(r)
+		span := trace.SpanFromContext(r.Context())
+
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+	})
+
+	return otelhttp.NewHandler(named, "http.request")
+}
+
+// Transport for requests to other services, sending the trace context along
+func TracingTransport(name string, base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method + " " + name
+	}))
+}
+
+// Start span of query made within a traced request, queries made outside of one aren't traced
+func startQuerySpan(tx *gorm.DB) {
+	ctx := tx.Statement.Context
+
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+
+	_, span := tracer.Start(ctx, "db.query", trace.WithSpanKind(trace.SpanKindClient))
+
+	tx.InstanceSet(dbSpanKey, span)
+}
+
+// End span of query started by startQuerySpan, with the statement but none of its values
+func endQuerySpan(tx *gorm.DB, operation string, table string) {
+	started, ok := tx.InstanceGet(dbSpanKey)
+
+	if !ok {
+		return
+	}
+
+	span := started.(trace.Span)
+
+	span.SetName(operation + " " + table)
+	span.SetAttributes(
+		semconv.DBSystemNameMySQL,
+		semconv.DBOperationName(operation),
+		semconv.DBCollectionName(table),
+		semconv.DBQueryText(tx.Statement.SQL.String()),
+	)
+
+	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+
+	span.End()
+}
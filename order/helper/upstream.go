@@ -0,0 +1,312 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imroc/req"
+)
+
+// Upstream service called by order service, with a timeout, retries of idempotent requests and a circuit breaker
+type Upstream struct {
+	Name      string
+	URL       *url.URL
+	Timeout   time.Duration
+	Retries   int
+	Backoff   time.Duration
+	breaker   *breaker
+	transport http.RoundTripper
+}
+
+// Failure of upstream, rendered as 502 Bad Gateway, 503 Service Unavailable or 504 Gateway Timeout
+type UpstreamError struct {
+	Service    string
+	Status     int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	switch e.Status {
+	case http.StatusServiceUnavailable:
+		return e.Service + " service unavailable"
+	case http.StatusGatewayTimeout:
+		return e.Service + " service timed out"
+	}
+
+	return e.Service + " service failed"
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return ErrUpstream
+}
+
+var (
+	upstreams   = map[string]*Upstream{}
+	upstreamsMu sync.Mutex
+)
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n >= 0 {
+		return n
+	}
+
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+
+	return fallback
+}
+
+// Create upstream for host, e.g. "auth-service:3002", configured through UPSTREAM_TIMEOUT, UPSTREAM_RETRIES,
+// UPSTREAM_RETRY_BACKOFF, UPSTREAM_BREAKER_FAILURES and UPSTREAM_BREAKER_COOLDOWN
+func NewUpstream(name string, host string) *Upstream {
+	return &Upstream{
+		Name:      name,
+		URL:       &url.URL{Scheme: "http", Host: host},
+		Timeout:   envDuration("UPSTREAM_TIMEOUT", 10*time.Second),
+		Retries:   envInt("UPSTREAM_RETRIES", 2),
+		Backoff:   envDuration("UPSTREAM_RETRY_BACKOFF", 100*time.Millisecond),
+		breaker:   newBreaker(envInt("UPSTREAM_BREAKER_FAILURES", 5), envDuration("UPSTREAM_BREAKER_COOLDOWN", 30*time.Second)),
+		transport: TracingTransport(name, http.DefaultTransport),
+	}
+}
+
+// Upstream of name at host, shared by every caller so they share its circuit breaker
+func UseUpstream(name string, host string) *Upstream {
+	upstreamsMu.Lock()
+	defer upstreamsMu.Unlock()
+
+	key := name + "@" + host
+
+	if u, ok := upstreams[key]; ok {
+		return u
+	}
+
+	upstreams[key] = NewUpstream(name, host)
+
+	return upstreams[key]
+}
+
+// Upstream of name at its host from the environment, e.g. "auth" at URL_AUTH
+func GetUpstream(name string) *Upstream {
+	return UseUpstream(name, os.Getenv("URL_"+strings.ToUpper(name)))
+}
+
+// URL of path on upstream
+func (u *Upstream) Url(path string) string {
+	return u.URL.String() + path
+}
+
+// Client for requests to upstream
+func (u *Upstream) Request() *req.Req {
+	r := req.New()
+	r.SetClient(&http.Client{Transport: u})
+
+	return r
+}
+
+// Error of failed call to upstream, without the URL which is of no use to the client
+func (u *Upstream) Failure(err error) error {
+	upstreamErr := &UpstreamError{}
+
+	if errors.As(err, &upstreamErr) {
+		return upstreamErr
+	}
+
+	return &UpstreamError{Service: u.Name, Status: http.StatusBadGateway, Err: err}
+}
+
+// Decode response envelope of upstream, a body which isn't one is a bad gateway
+func (u *Upstream) Decode(res *req.Resp, v *ResponseModel) error {
+	if err := res.ToJSON(v); err != nil || v.HTTPStatusCode == 0 {
+		return &UpstreamError{Service: u.Name, Status: http.StatusBadGateway, Err: err}
+	}
+
+	return nil
+}
+
+// Send request to upstream. Requests without a deadline get the upstream timeout, idempotent requests are retried
+// with jittered backoff on connection errors and 502, 503 or 504, and nothing is sent while the breaker is open.
+func (u *Upstream) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, cancel := r.Context(), context.CancelFunc(func() {})
+
+	if _, ok := ctx.Deadline(); !ok && u.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, u.Timeout)
+	}
+
+	r, err := replayable(r)
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			upstreamRetries.WithLabelValues(u.Name).Inc()
+		}
+
+		if !u.breaker.allow() {
+			upstreamRequests.WithLabelValues(u.Name, r.Method, "circuit_open").Inc()
+			cancel()
+			return nil, &UpstreamError{Service: u.Name, Status: http.StatusServiceUnavailable, RetryAfter: u.breaker.retryAfter()}
+		}
+
+		outReq := r.WithContext(ctx)
+
+		if attempt > 0 && r.GetBody != nil {
+			body, err := r.GetBody()
+
+			if err != nil {
+				u.breaker.release()
+				cancel()
+				return nil, err
+			}
+
+			outReq.Body = body
+		}
+
+		start := time.Now()
+		res, err := u.transport.RoundTrip(outReq)
+		failed := err != nil || unavailableStatus(res.StatusCode)
+
+		u.observe(r, res, start)
+
+		switch {
+		case errors.Is(r.Context().Err(), context.Canceled):
+			u.breaker.release()
+		case failed:
+			u.breaker.failure()
+		default:
+			u.breaker.success()
+		}
+
+		upstreamCircuit.WithLabelValues(u.Name).Set(float64(u.breaker.current()))
+
+		if err == nil && (!failed || attempt >= u.Retries || !retryable(r)) {
+			res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+			return res, nil
+		}
+
+		if err != nil && (attempt >= u.Retries || !retryable(r) || ctx.Err() != nil) {
+			cancel()
+			return nil, u.failure(ctx, err)
+		}
+
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-time.After(u.backoff(attempt)):
+		case <-ctx.Done():
+			cancel()
+			return nil, u.failure(ctx, ctx.Err())
+		}
+	}
+}
+
+// Record attempt of request started at start, res is nil when no response came
+func (u *Upstream) observe(r *http.Request, res *http.Response, start time.Time) {
+	status := "error"
+
+	if res != nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+
+	upstreamRequests.WithLabelValues(u.Name, r.Method, status).Inc()
+	upstreamDuration.WithLabelValues(u.Name, r.Method).Observe(time.Since(start).Seconds())
+}
+
+// Error of failed request, 504 when it ran out of time
+func (u *Upstream) failure(ctx context.Context, err error) error {
+	netErr := net.Error(nil)
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return &UpstreamError{Service: u.Name, Status: http.StatusGatewayTimeout, Err: err}
+	}
+
+	return &UpstreamError{Service: u.Name, Status: http.StatusBadGateway, Err: err}
+}
+
+// Random wait before retry, up to twice as long as the previous one
+func (u *Upstream) backoff(attempt int) time.Duration {
+	max := u.Backoff << uint(attempt)
+
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+func unavailableStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// Check request is idempotent, by its method or an Idempotency-Key header
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return r.Header.Get("Idempotency-Key") != ""
+}
+
+// Check request is idempotent and its body, if any, can be sent again
+func retryable(r *http.Request) bool {
+	return idempotent(r) && (r.Body == nil || r.Body == http.NoBody || r.GetBody != nil)
+}
+
+// Request with its body read, so it can be sent again. Clients like req set a body which can only be read once.
+func replayable(r *http.Request) (*http.Request, error) {
+	if !idempotent(r) || r.Body == nil || r.Body == http.NoBody || r.GetBody != nil {
+		return r, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	r.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	r = r.Clone(r.Context())
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	return r, nil
+}
+
+// Body of response, the timeout of its request ends when it's closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
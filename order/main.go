@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ariefsn/book-store/order/controllers"
+	"github.com/ariefsn/book-store/order/helper"
+	"github.com/ariefsn/book-store/order/migrations"
+	"github.com/ariefsn/book-store/order/models"
+	"github.com/ariefsn/book-store/order/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+func main() {
+	db, err := helper.InitDB()
+
+	if err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
+
+	migrator := helper.NewMigrator(db, "order", migrations.Migrations)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := helper.RunMigrate(migrator, os.Args[2:]); err != nil {
+			fmt.Println("[Error]", err.Error())
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if helper.AutoMigrate() {
+		if _, err := migrator.Up(); err != nil {
+			fmt.Println("[Error]", err.Error())
+			return
+		}
+	}
+
+	if err := helper.InitIdentity("order"); err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
+
+	shutdown, err := helper.InitTracing("order")
+
+	if err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
+
+	defer shutdown(context.Background())
+
+	err = services.InitService(db)
+
+	if err != nil {
+		fmt.Println("[Error]", err.Error())
+		return
+	}
+
+	returnInterval := time.Minute
+
+	if d, err := time.ParseDuration(os.Getenv("STOCK_RETURN_INTERVAL")); err == nil && d > 0 {
+		returnInterval = d
+	}
+
+	go services.RetryStockReturns(returnInterval)
+
+	r := chi.NewRouter()
+
+	r.Use(middleware.Logger)
+	r.Use(middleware.Heartbeat("/ping"))
+	r.Use(helper.Metrics)
+	r.Use(helper.Tracing)
+	r.Use(helper.IdentityVerifier)
+
+	ctr := controllers.NewOrderController()
+	cart := controllers.NewCartController()
+
+	r.Get("/", ctr.Hi)
+
+	r.Route("/cart", func(r chi.Router) {
+		r.Use(ctr.Permission(models.PermissionOrderCreate))
+
+		r.Get("/", cart.Find)
+		r.Delete("/", cart.Clear)
+		r.Post("/item", cart.AddItem)
+		r.Put("/item/{bookId}", cart.UpdateItem)
+		r.Delete("/item/{bookId}", cart.DeleteItem)
+	})
+
+	r.Route("/order", func(r chi.Router) {
+		r.With(ctr.Permission(models.PermissionOrderOwn)).Get("/", ctr.Mine)
+		r.With(ctr.Permission(models.PermissionOrderRead)).Get("/all", ctr.All)
+		r.With(ctr.Permission(models.PermissionOrderCreate)).Post("/checkout", ctr.Checkout)
+		r.With(ctr.Permission(models.PermissionOrderOwn, models.PermissionOrderRead)).Get("/{id}", ctr.Find)
+		r.With(ctr.Permission(models.PermissionOrderOwn, models.PermissionOrderWrite)).Put("/{id}/status", ctr.UpdateStatus)
+	})
+
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		render.Render(w, r, helper.ResponseError(http.StatusNotFound, errors.New("route not found")))
+	})
+
+	fmt.Println("\nRegistered Routes")
+
+	walkFunc := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.Replace(route, "/*/", "/", -1)
+		fmt.Printf("\t%s\t%s\n", method, route)
+		return nil
+	}
+
+	if err := chi.Walk(r, walkFunc); err != nil {
+		fmt.Printf("Logging err: %s\n", err.Error())
+	}
+
+	port := "3004"
+
+	if os.Getenv("PORT") != "" {
+		port = os.Getenv("PORT")
+	}
+
+	fmt.Println("\nServer start on port", port)
+
+	http.ListenAndServe(fmt.Sprintf(":%s", port), r)
+}
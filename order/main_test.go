@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ariefsn/book-store/order/controllers"
+	"github.com/ariefsn/book-store/order/helper"
+	"github.com/ariefsn/book-store/order/migrations"
+	"github.com/ariefsn/book-store/order/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/imroc/req"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type TestCase struct {
+	name       string
+	method     string
+	headers    map[string]string
+	want       string
+	statusCode int
+	message    string
+}
+
+func TestRootHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	c := TestCase{
+		name:       "should return api info",
+		method:     http.MethodGet,
+		want:       `{"code":200,"success":true,"data":"Hi, Welcome to Order Service Version 1","message":""}`,
+		statusCode: 200,
+		message:    "response body not contains api info",
+	}
+
+	t.Run(c.name, func(t *testing.T) {
+		req := httptest.NewRequest(c.method, "/", nil)
+		res := httptest.NewRecorder()
+
+		controllers.NewOrderController().Hi(res, req)
+
+		assert.Equal(c.statusCode, res.Result().StatusCode, fmt.Sprintf("status code should be %v instead of %v", c.statusCode, res.Result().StatusCode))
+		assert.Equal(c.want, strings.TrimSpace(res.Body.String()), c.message)
+	})
+}
+
+func TestOrderStatusTransition(t *testing.T) {
+	assert := assert.New(t)
+
+	tc := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{models.StatusPending, models.StatusPaid, true},
+		{models.StatusPending, models.StatusCancelled, true},
+		{models.StatusPending, models.StatusShipped, false},
+		{models.StatusPaid, models.StatusShipped, true},
+		{models.StatusPaid, models.StatusCancelled, false},
+		{models.StatusShipped, models.StatusRefunded, true},
+		{models.StatusCancelled, models.StatusPaid, false},
+		{models.StatusRefunded, models.StatusShipped, false},
+	}
+
+	for _, c := range tc {
+		t.Run(c.from+" to "+c.to, func(t *testing.T) {
+			order := models.NewOrderModel()
+			order.Status = c.from
+
+			assert.Equal(c.want, order.CanTransitionTo(c.to))
+		})
+	}
+}
+
+// Signing and verifying cases are covered by the auth service, which shares the identity helper
+func TestIdentityVerifier(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("SERVICE_SECRET", "test secret")
+
+	helper.InitIdentity("order")
+
+	valid, _ := helper.SignIdentity(helper.Identity{Subject: "1", Roles: []string{"admin"}}, "order")
+	otherAudience, _ := helper.SignIdentity(helper.Identity{Subject: "1"}, "book")
+
+	for identity, statusCode := range map[string]int{valid: http.StatusOK, otherAudience: http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(helper.IdentityHeader, identity)
+		res := httptest.NewRecorder()
+
+		helper.IdentityVerifier(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(res, req)
+
+		assert.Equal(statusCode, res.Result().StatusCode)
+	}
+}
+
+func TestUpstream(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("UPSTREAM_RETRY_BACKOFF", "1ms")
+	os.Setenv("UPSTREAM_BREAKER_FAILURES", "3")
+	os.Setenv("UPSTREAM_BREAKER_COOLDOWN", "1m")
+	defer os.Unsetenv("UPSTREAM_RETRY_BACKOFF")
+	defer os.Unsetenv("UPSTREAM_BREAKER_FAILURES")
+	defer os.Unsetenv("UPSTREAM_BREAKER_COOLDOWN")
+
+	// responds 503 to the first requests, then 200
+	calls, failures := 0, 2
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		if calls <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprint(w, `{"code":200,"success":true,"data":["order:own"],"message":""}`)
+	}))
+	defer server.Close()
+
+	t.Run("should retry idempotent request", func(t *testing.T) {
+		upstream := helper.NewUpstream("auth", strings.TrimPrefix(server.URL, "http://"))
+
+		res, err := upstream.Request().Get(upstream.Url("/user/me/permission"))
+
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.Response().StatusCode)
+		assert.Equal(3, calls)
+	})
+
+	t.Run("should retry post only with idempotency key", func(t *testing.T) {
+		upstream := helper.NewUpstream("book", strings.TrimPrefix(server.URL, "http://"))
+		body := map[string]interface{}{"type": "sell", "quantity": 1}
+
+		calls = 0
+		res, err := upstream.Request().Post(upstream.Url("/book/1/stock/order"), req.BodyJSON(body))
+
+		assert.Nil(err)
+		assert.Equal(http.StatusServiceUnavailable, res.Response().StatusCode)
+		assert.Equal(1, calls)
+
+		calls = 0
+		upstream = helper.NewUpstream("book", strings.TrimPrefix(server.URL, "http://"))
+		res, err = upstream.Request().Post(upstream.Url("/book/1/stock/order"), req.Header{"Idempotency-Key": "checkout-1-sell"}, req.BodyJSON(body))
+
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.Response().StatusCode)
+		assert.Equal(3, calls)
+	})
+
+	t.Run("should open circuit after failures", func(t *testing.T) {
+		calls, failures = 0, 3
+
+		upstream := helper.NewUpstream("book", strings.TrimPrefix(server.URL, "http://"))
+		upstream.Retries = 0
+
+		for i := 0; i < 3; i++ {
+			res, err := upstream.Request().Get(upstream.Url("/book/1"))
+
+			assert.Nil(err)
+			assert.Equal(http.StatusServiceUnavailable, res.Response().StatusCode)
+		}
+
+		_, err := upstream.Request().Get(upstream.Url("/book/1"))
+
+		assert.Equal(http.StatusServiceUnavailable, helper.ErrorStatus(upstream.Failure(err)))
+		assert.Contains(upstream.Failure(err).Error(), "book service unavailable")
+		assert.Equal(3, calls, "open circuit should not reach upstream")
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":200,"success":true,"data":{"id":1},"message":""}`)
+	}))
+	defer server.Close()
+
+	upstream := helper.NewUpstream("metrics", strings.TrimPrefix(server.URL, "http://"))
+
+	r := chi.NewRouter()
+	r.Use(helper.Metrics)
+	r.Get("/order/{id}", func(w http.ResponseWriter, r *http.Request) {
+		upstream.Request().Get(upstream.Url("/book/1"), r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, id := range []string{"1", "2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/order/"+id, nil))
+	}
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, helper.MetricsPath, nil))
+
+	body := res.Body.String()
+
+	assert.Equal(http.StatusOK, res.Code)
+	assert.Contains(body, `http_requests_total{method="GET",route="/order/{id}",status="204"} 2`)
+	assert.Contains(body, `upstream_requests_total{method="GET",status="200",upstream="metrics"} 2`)
+	assert.NotContains(body, `route="/metrics"`)
+}
+
+func TestTracing(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	traceparent := ""
+
+	book := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		fmt.Fprint(w, `{"code":200,"success":true,"data":{"id":1},"message":""}`)
+	}))
+	defer book.Close()
+
+	upstream := helper.NewUpstream("book", strings.TrimPrefix(book.URL, "http://"))
+
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root:root@tcp(127.0.0.1:3306)/book_store", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	assert.Nil(err)
+	assert.Nil(helper.InstrumentDB(db, "test"))
+
+	r := chi.NewRouter()
+	r.Use(helper.Tracing)
+	r.Get("/order/{id}", func(w http.ResponseWriter, r *http.Request) {
+		order := models.NewOrderModel()
+
+		db.WithContext(r.Context()).Table(order.TableName()).Where("id = ?", 1).First(&order)
+		res, err := upstream.Request().Get(upstream.Url("/book/1"), r.Context())
+
+		if assert.Nil(err) {
+			// client span ends once the body is read
+			assert.Nil(upstream.Decode(res, &helper.ResponseModel{}))
+		}
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/order/1", nil))
+
+	names := map[string]sdktrace.ReadOnlySpan{}
+
+	for _, span := range recorder.Ended() {
+		names[span.Name()] = span
+	}
+
+	if assert.Contains(names, "GET /order/{id}") && assert.Contains(names, "query orders") && assert.Contains(names, "GET book") {
+		traceId := names["GET /order/{id}"].SpanContext().TraceID()
+
+		assert.Equal(traceId, names["query orders"].SpanContext().TraceID())
+		assert.Equal(traceId, names["GET book"].SpanContext().TraceID())
+		assert.Contains(traceparent, traceId.String(), "trace context should be sent to book")
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	assert := assert.New(t)
+
+	versions := map[int]bool{}
+
+	for _, m := range migrations.Migrations {
+		assert.False(versions[m.Version], fmt.Sprintf("version %d should be unique", m.Version))
+		assert.NotEmpty(m.Name, fmt.Sprintf("migration %d should have name", m.Version))
+		assert.NotEmpty(m.Up, fmt.Sprintf("migration %d should have up", m.Version))
+		assert.NotEmpty(m.Down, fmt.Sprintf("migration %d should have down", m.Version))
+
+		versions[m.Version] = true
+	}
+}
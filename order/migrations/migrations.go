@@ -0,0 +1,94 @@
+package migrations
+
+import "github.com/ariefsn/book-store/order/helper"
+
+// Schema of tables owned by order service.
+// Released migrations must not be changed, add a new one instead.
+var Migrations = []helper.Migration{
+	{
+		Version: 1,
+		Name:    "create_cart_items",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS cart_items (
+  id int NOT NULL AUTO_INCREMENT,
+  userId int NOT NULL,
+  bookId int NOT NULL,
+  quantity int NOT NULL,
+  createdAt DATETIME,
+  updatedAt DATETIME,
+  PRIMARY KEY(id),
+  UNIQUE KEY(userId, bookId)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS cart_items`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_orders",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS orders (
+  id int NOT NULL AUTO_INCREMENT,
+  userId int NOT NULL,
+  status ENUM('pending', 'paid', 'shipped', 'cancelled', 'refunded') NOT NULL,
+  total BIGINT NOT NULL,
+  currency CHAR(3),
+  createdAt DATETIME,
+  updatedAt DATETIME,
+  PRIMARY KEY(id),
+  KEY(userId),
+  KEY(status),
+  KEY(createdAt),
+  KEY(total)
+)`,
+			`CREATE TABLE IF NOT EXISTS order_items (
+  id int NOT NULL AUTO_INCREMENT,
+  orderId int NOT NULL,
+  bookId int NOT NULL,
+  title VARCHAR(100) NOT NULL,
+  price BIGINT NOT NULL,
+  currency CHAR(3),
+  quantity int NOT NULL,
+  subtotal BIGINT NOT NULL,
+  PRIMARY KEY(id),
+  KEY(orderId)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS order_items`,
+			`DROP TABLE IF EXISTS orders`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add_orders_checkout_key",
+		Up: []string{
+			`ALTER TABLE orders ADD COLUMN checkoutKey VARCHAR(64)`,
+			`UPDATE orders SET checkoutKey = CONCAT('order-', id)`,
+		},
+		Down: []string{
+			`ALTER TABLE orders DROP COLUMN checkoutKey`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_stock_returns",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS stock_returns (
+  id int NOT NULL AUTO_INCREMENT,
+  bookId int NOT NULL,
+  quantity int NOT NULL,
+  checkoutKey VARCHAR(64) NOT NULL,
+  sold BOOLEAN NOT NULL,
+  note VARCHAR(200),
+  createdAt DATETIME,
+  PRIMARY KEY(id),
+  UNIQUE KEY(checkoutKey, bookId)
+)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS stock_returns`,
+		},
+	},
+}
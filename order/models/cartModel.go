@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+type CartItemModel struct {
+	ID        int        `json:"id" gorm:"autoIncrement"`
+	UserID    int        `json:"userId" gorm:"column:userId"`
+	BookID    int        `json:"bookId" gorm:"column:bookId"`
+	Quantity  int        `json:"quantity"`
+	CreatedAt *time.Time `json:"createdAt" gorm:"column:createdAt"`
+	UpdatedAt *time.Time `json:"updatedAt" gorm:"column:updatedAt"`
+}
+
+type CartModel struct {
+	UserID int             `json:"userId"`
+	Items  []CartItemModel `json:"items"`
+}
+
+func (c *CartItemModel) Bind(r *http.Request) error {
+	if c.Quantity <= 0 {
+		return errors.New("quantity must be positive")
+	}
+
+	return nil
+}
+
+func (c *CartModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (c *CartItemModel) TableName() string {
+	return "cart_items"
+}
+
+func NewCartItemModel() *CartItemModel {
+	s := new(CartItemModel)
+
+	return s
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusPaid      = "paid"
+	StatusShipped   = "shipped"
+	StatusCancelled = "cancelled"
+	StatusRefunded  = "refunded"
+)
+
+// Allowed status changes, cancelled and refunded are final
+var StatusTransitions = map[string][]string{
+	StatusPending: {StatusPaid, StatusCancelled},
+	StatusPaid:    {StatusShipped, StatusRefunded},
+	StatusShipped: {StatusRefunded},
+}
+
+type OrderModel struct {
+	ID        int              `json:"id" gorm:"autoIncrement"`
+	UserID    int              `json:"userId" gorm:"column:userId"`
+	Status    string           `json:"status"`
+	Total     int64            `json:"total"`
+	Currency  string           `json:"currency"`
+	Items     []OrderItemModel `json:"items" gorm:"foreignKey:OrderID"`
+	CreatedAt *time.Time       `json:"createdAt" gorm:"column:createdAt"`
+	UpdatedAt *time.Time       `json:"updatedAt" gorm:"column:updatedAt"`
+
+	// Base of the idempotency keys of stock movements of the order
+	CheckoutKey string `json:"-" gorm:"column:checkoutKey"`
+}
+
+// Book as it was at checkout, later price changes don't affect the order
+type OrderItemModel struct {
+	ID       int    `json:"id" gorm:"autoIncrement"`
+	OrderID  int    `json:"orderId" gorm:"column:orderId"`
+	BookID   int    `json:"bookId" gorm:"column:bookId"`
+	Title    string `json:"title"`
+	Price    int64  `json:"price"`
+	Currency string `json:"currency"`
+	Quantity int    `json:"quantity"`
+	Subtotal int64  `json:"subtotal"`
+}
+
+type OrderListModel struct {
+	Orders     []OrderModel `json:"list"`
+	Total      int64        `json:"total"`
+	Page       int          `json:"page"`
+	Limit      int          `json:"limit"`
+	NextCursor string       `json:"nextCursor"`
+}
+
+type OrderStatusModel struct {
+	Status string `json:"status"`
+}
+
+func (o *OrderModel) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (o *OrderStatusModel) Bind(r *http.Request) error {
+	if _, ok := StatusTransitions[o.Status]; !ok && o.Status != StatusCancelled && o.Status != StatusRefunded {
+		return errors.New("unknown status")
+	}
+
+	return nil
+}
+
+func (o *OrderModel) TableName() string {
+	return "orders"
+}
+
+func (o *OrderItemModel) TableName() string {
+	return "order_items"
+}
+
+// Check order may move to status
+func (o *OrderModel) CanTransitionTo(status string) bool {
+	for _, s := range StatusTransitions[o.Status] {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+func NewOrderModel() *OrderModel {
+	s := new(OrderModel)
+
+	s.Status = StatusPending
+
+	return s
+}
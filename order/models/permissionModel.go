@@ -0,0 +1,9 @@
+package models
+
+// Permissions granted by auth service roles
+const (
+	PermissionOrderCreate = "order:create"
+	PermissionOrderOwn    = "order:own"
+	PermissionOrderRead   = "order:read"
+	PermissionOrderWrite  = "order:write"
+)
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Stock of a checkout owed back to book service, kept until book service has taken it back.
+// Sold is false when it's unknown whether the sale reached book service.
+type StockReturnModel struct {
+	ID          int        `json:"id" gorm:"autoIncrement"`
+	BookID      int        `json:"bookId" gorm:"column:bookId"`
+	Quantity    int        `json:"quantity"`
+	CheckoutKey string     `json:"checkoutKey" gorm:"column:checkoutKey"`
+	Sold        bool       `json:"sold"`
+	Note        string     `json:"note"`
+	CreatedAt   *time.Time `json:"createdAt" gorm:"column:createdAt"`
+}
+
+func (s *StockReturnModel) TableName() string {
+	return "stock_returns"
+}
+
+func NewStockReturnModel() *StockReturnModel {
+	s := new(StockReturnModel)
+
+	return s
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"github.com/ariefsn/book-store/order/models"
+	"gorm.io/gorm/clause"
+)
+
+// Find cart items of user
+func GetCart(ctx context.Context, userId int) (*models.CartModel, error) {
+	cart := &models.CartModel{
+		UserID: userId,
+		Items:  []models.CartItemModel{},
+	}
+
+	res := db.WithContext(ctx).Table(models.NewCartItemModel().TableName()).Where("userId = ?", userId).Order("id").Find(&cart.Items)
+
+	return cart, res.Error
+}
+
+// Add book to cart, quantity is added to the existing item of the same book
+func AddCartItem(ctx context.Context, item *models.CartItemModel) error {
+	res := db.WithContext(ctx).Table(item.TableName()).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"quantity":  clause.Expr{SQL: "quantity + VALUES(quantity)"},
+			"updatedAt": clause.Expr{SQL: "VALUES(updatedAt)"},
+		}),
+	}).Create(&item)
+
+	return res.Error
+}
+
+// Set quantity of book in cart
+func UpdateCartItem(ctx context.Context, userId int, bookId int, quantity int) int64 {
+	res := db.WithContext(ctx).Table(models.NewCartItemModel().TableName()).
+		Where("userId = ? AND bookId = ?", userId, bookId).
+		Update("quantity", quantity)
+
+	return res.RowsAffected
+}
+
+// Remove book from cart
+func DeleteCartItem(ctx context.Context, userId int, bookId int) int64 {
+	item := models.NewCartItemModel()
+
+	res := db.WithContext(ctx).Table(item.TableName()).Where("userId = ? AND bookId = ?", userId, bookId).Delete(&item)
+
+	return res.RowsAffected
+}
+
+// Remove all books from cart
+func ClearCart(ctx context.Context, userId int) int64 {
+	item := models.NewCartItemModel()
+
+	res := db.WithContext(ctx).Table(item.TableName()).Where("userId = ?", userId).Delete(&item)
+
+	return res.RowsAffected
+}
@@ -0,0 +1,12 @@
+package services
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Business counters, served with the request metrics at /metrics
+var ordersCreated = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "order_orders_created_total",
+	Help: "Orders placed at checkout.",
+})
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ariefsn/book-store/order/helper"
+	"github.com/ariefsn/book-store/order/models"
+	"github.com/imroc/req"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var db *gorm.DB
+
+var authService = helper.GetUpstream("auth")
+
+var bookService = helper.GetUpstream("book")
+
+var (
+	ErrEmptyCart        = errors.New("cart is empty")
+	ErrCurrencyMismatch = errors.New("books in cart have different currencies")
+	ErrNotForSale       = errors.New("book has no price")
+	ErrInvalidStatus    = errors.New("order can't move to this status")
+)
+
+// Init service and register new connection
+func InitService(sqlDb *sql.DB) (err error) {
+	newLogger := logger.New(
+		log.New(os.Stdout, "\r\n", log.LstdFlags),
+		logger.Config{
+			SlowThreshold:             time.Second,
+			LogLevel:                  logger.Info,
+			IgnoreRecordNotFoundError: true,
+			Colorful:                  true,
+		},
+	)
+
+	db, err = gorm.Open(mysql.New(mysql.Config{
+		Conn: sqlDb,
+	}), &gorm.Config{
+		Logger: newLogger,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err = helper.InstrumentDB(db, "order"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Find permissions of active user
+func GetUserPermissions(r *http.Request) ([]string, int, error) {
+	header := req.Header{
+		"Accept":              "application/json",
+		helper.IdentityHeader: helper.ForwardIdentity(r, "auth"),
+	}
+
+	res, err := authService.Request().Get(authService.Url("/user/me/permission"), header, r.Context())
+
+	if err != nil {
+		err = authService.Failure(err)
+
+		return nil, helper.ErrorStatus(err), err
+	}
+
+	newRes := helper.ResponseModel{}
+
+	if err := authService.Decode(res, &newRes); err != nil {
+		return nil, helper.ErrorStatus(err), err
+	}
+
+	if !newRes.Success {
+		// rejections of the user are passed on, anything else is a failure of auth
+		if newRes.HTTPStatusCode < 400 || newRes.HTTPStatusCode >= 500 {
+			err := authService.Failure(errors.New(newRes.Message))
+
+			return nil, helper.ErrorStatus(err), err
+		}
+
+		return nil, newRes.HTTPStatusCode, errors.New(newRes.Message)
+	}
+
+	data, ok := newRes.Data.([]interface{})
+
+	if !ok {
+		err := authService.Failure(errors.New("permissions aren't a list"))
+
+		return nil, helper.ErrorStatus(err), err
+	}
+
+	permissions := []string{}
+
+	for _, p := range data {
+		if permission, ok := p.(string); ok {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	return permissions, http.StatusOK, nil
+}
+
+// Find book by id on book service
+func GetBookByID(r *http.Request, id int) (map[string]interface{}, int, error) {
+	header := req.Header{
+		"Accept":              "application/json",
+		helper.IdentityHeader: helper.ForwardIdentity(r, "book"),
+	}
+
+	res, err := bookService.Request().Get(bookService.Url("/book/"+strconv.Itoa(id)), header, r.Context())
+
+	if err != nil {
+		err = bookService.Failure(err)
+
+		return nil, helper.ErrorStatus(err), err
+	}
+
+	newRes := helper.ResponseModel{}
+
+	if err := bookService.Decode(res, &newRes); err != nil {
+		return nil, helper.ErrorStatus(err), err
+	}
+
+	if !newRes.Success {
+		return nil, newRes.HTTPStatusCode, errors.New(newRes.Message)
+	}
+
+	book, ok := newRes.Data.(map[string]interface{})
+
+	if !ok {
+		err := bookService.Failure(errors.New("book isn't an object"))
+
+		return nil, helper.ErrorStatus(err), err
+	}
+
+	return book, http.StatusOK, nil
+}
+
+// Turn cart into a pending order, title and price of every book are copied into the order
+func Checkout(r *http.Request, userId int) (*models.OrderModel, int, error) {
+	cart, err := GetCart(r.Context(), userId)
+
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if len(cart.Items) == 0 {
+		return nil, 422, ErrEmptyCart
+	}
+
+	order := models.NewOrderModel()
+	order.UserID = userId
+
+	for i, cartItem := range cart.Items {
+		book, code, err := GetBookByID(r, cartItem.BookID)
+
+		if err != nil {
+			return nil, code, err
+		}
+
+		item := models.OrderItemModel{
+			BookID:   cartItem.BookID,
+			Quantity: cartItem.Quantity,
+		}
+
+		item.Title, _ = book["title"].(string)
+		item.Currency, _ = book["currency"].(string)
+
+		if price, ok := book["price"].(float64); ok {
+			item.Price = int64(price)
+		}
+
+		if item.Price <= 0 || item.Currency == "" {
+			return nil, 422, fmt.Errorf("%w: %s", ErrNotForSale, item.Title)
+		}
+
+		item.Subtotal = item.Price * int64(item.Quantity)
+
+		if i == 0 {
+			order.Currency = item.Currency
+		}
+
+		if item.Currency != order.Currency {
+			return nil, 422, ErrCurrencyMismatch
+		}
+
+		order.Total += item.Subtotal
+		order.Items = append(order.Items, item)
+	}
+
+	order.CheckoutKey = newCheckoutKey()
+
+	if code, err := sellStock(r, order.CheckoutKey, order.Items); err != nil {
+		return nil, code, err
+	}
+
+	err = db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(order.TableName()).Create(&order).Error; err != nil {
+			return err
+		}
+
+		item := models.NewCartItemModel()
+
+		return tx.Table(item.TableName()).Where("userId = ?", userId).Delete(&item).Error
+	})
+
+	if err != nil {
+		returnStock(r.Context(), order.CheckoutKey, order.Items, true, "checkout failed")
+
+		return nil, http.StatusInternalServerError, err
+	}
+
+	ordersCreated.Inc()
+
+	return order, http.StatusOK, nil
+}
+
+// Find order by id with its items
+func GetOrderByID(ctx context.Context, id int) (*models.OrderModel, error) {
+	order := models.NewOrderModel()
+
+	res := db.WithContext(ctx).Table(order.TableName()).Preload("Items").Where("id = ?", id).First(&order)
+
+	return order, res.Error
+}
+
+// Find orders, only of the user when userId isn't zero
+func GetOrders(ctx context.Context, userId int, status string, page *helper.Pagination) (*models.OrderListModel, error) {
+	list := &models.OrderListModel{
+		Orders: []models.OrderModel{},
+		Page:   page.Page,
+		Limit:  page.Limit,
+	}
+
+	scope := func(tx *gorm.DB) *gorm.DB {
+		if userId != 0 {
+			tx = tx.Where("userId = ?", userId)
+		}
+
+		if status != "" {
+			tx = tx.Where("status = ?", status)
+		}
+
+		return tx
+	}
+
+	table := models.NewOrderModel().TableName()
+
+	if res := db.WithContext(ctx).Table(table).Scopes(scope).Count(&list.Total); res.Error != nil {
+		return nil, res.Error
+	}
+
+	if res := db.WithContext(ctx).Table(table).Preload("Items").Scopes(scope, page.Scope).Find(&list.Orders); res.Error != nil {
+		return nil, res.Error
+	}
+
+	list.NextCursor = page.Paginate(&list.Orders)
+
+	return list, nil
+}
+
+// Move order to status, fails when order has been changed by another request in the meantime
+func UpdateOrderStatus(ctx context.Context, order *models.OrderModel, status string) error {
+	if !order.CanTransitionTo(status) {
+		return ErrInvalidStatus
+	}
+
+	res := db.WithContext(ctx).Table(order.TableName()).
+		Where("id = ? AND status = ?", order.ID, order.Status).
+		Updates(map[string]interface{}{"status": status, "updatedAt": time.Now()})
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrInvalidStatus
+	}
+
+	order.Status = status
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ariefsn/book-store/order/helper"
+	"github.com/ariefsn/book-store/order/models"
+	"github.com/imroc/req"
+)
+
+const (
+	movementSell   = "sell"
+	movementReturn = "return"
+)
+
+// Key of a checkout, set before any stock is sold
+func newCheckoutKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Key of stock movement of book for checkout, book service applies a movement with the same key once
+func movementKey(checkoutKey string, bookId int, movement string) string {
+	return fmt.Sprintf("%s-%d-%s", checkoutKey, bookId, movement)
+}
+
+// Check book service rejected the request, it won't succeed when sent again
+func rejected(code int) bool {
+	return code >= 400 && code < 500
+}
+
+// Sell stock of items on book service.
+// When a sale fails, stock already sold is returned, as is stock of the failed sale unless book service rejected it.
+func sellStock(r *http.Request, checkoutKey string, items []models.OrderItemModel) (int, error) {
+	for i, item := range items {
+		code, err := moveStock(r.Context(), helper.ForwardIdentity(r, "book"), item.BookID, movementSell, item.Quantity, "checkout", movementKey(checkoutKey, item.BookID, movementSell))
+
+		if err == nil {
+			continue
+		}
+
+		returnStock(r.Context(), checkoutKey, items[:i], true, "checkout failed")
+
+		if !rejected(code) {
+			returnStock(r.Context(), checkoutKey, items[i:i+1], false, "checkout failed")
+		}
+
+		return code, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// Put stock of cancelled order back on book service
+func ReturnOrderStock(r *http.Request, order *models.OrderModel) {
+	returnStock(r.Context(), order.CheckoutKey, order.Items, true, fmt.Sprintf("order %d cancelled", order.ID))
+}
+
+// Record stock of items to return to book service and return it, returns which fail are retried by RetryStockReturns.
+// Sold is false when it's unknown whether the sale reached book service.
+func returnStock(ctx context.Context, checkoutKey string, items []models.OrderItemModel, sold bool, note string) {
+	// the return is owed even when the client is gone
+	ctx = context.WithoutCancel(ctx)
+
+	for _, item := range items {
+		ret := &models.StockReturnModel{BookID: item.BookID, Quantity: item.Quantity, CheckoutKey: checkoutKey, Sold: sold, Note: note}
+
+		if err := db.WithContext(ctx).Table(ret.TableName()).Create(ret).Error; err != nil {
+			log.Printf("[Error] record stock return of book %d: %s", item.BookID, err)
+		}
+
+		if err := applyStockReturn(ctx, ret); err != nil {
+			log.Printf("[Error] return stock of book %d, will be retried: %s", item.BookID, err)
+		}
+	}
+}
+
+// Return stock of a sale to book service and forget the return.
+// A sale which isn't known to have been made is sent again with its key first, so stock is only returned when it was taken.
+// Failures other than rejections of book service are returned, the return is kept to be retried.
+func applyStockReturn(ctx context.Context, ret *models.StockReturnModel) error {
+	identity, _ := helper.SignIdentity(helper.Identity{}, "book")
+
+	sold := ret.Sold
+
+	if !sold {
+		code, err := moveStock(ctx, identity, ret.BookID, movementSell, ret.Quantity, ret.Note, movementKey(ret.CheckoutKey, ret.BookID, movementSell))
+
+		if err != nil && !rejected(code) {
+			return err
+		}
+
+		sold = err == nil
+	}
+
+	if sold {
+		code, err := moveStock(ctx, identity, ret.BookID, movementReturn, ret.Quantity, ret.Note, movementKey(ret.CheckoutKey, ret.BookID, movementReturn))
+
+		if err != nil && !rejected(code) {
+			return err
+		}
+
+		if err != nil {
+			log.Printf("[Error] return stock of book %d rejected: %s", ret.BookID, err)
+		}
+	}
+
+	if ret.ID == 0 {
+		return nil
+	}
+
+	return db.WithContext(ctx).Table(ret.TableName()).Where("id = ?", ret.ID).Delete(ret).Error
+}
+
+// Apply stock returns left to be retried
+func ApplyStockReturns() (int, error) {
+	returns := []models.StockReturnModel{}
+
+	if err := db.Table(models.NewStockReturnModel().TableName()).Order("id").Find(&returns).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for i := range returns {
+		if err := applyStockReturn(context.Background(), &returns[i]); err != nil {
+			log.Printf("[Error] return stock of book %d, will be retried: %s", returns[i].BookID, err)
+			continue
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// Run ApplyStockReturns every interval
+func RetryStockReturns(interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := ApplyStockReturns(); err != nil {
+			fmt.Println("[Error] retry stock returns:", err.Error())
+		}
+	}
+}
+
+// Post stock movement of book on book service with its idempotency key, sell fails with 409 when there isn't enough stock
+func moveStock(ctx context.Context, identity string, bookId int, movement string, quantity int, note string, key string) (int, error) {
+	header := req.Header{
+		"Accept":              "application/json",
+		"Idempotency-Key":     key,
+		helper.IdentityHeader: identity,
+	}
+
+	body := req.BodyJSON(map[string]interface{}{"type": movement, "quantity": quantity, "note": note})
+
+	res, err := bookService.Request().Post(bookService.Url("/book/"+strconv.Itoa(bookId)+"/stock/order"), header, body, ctx)
+
+	if err != nil {
+		err = bookService.Failure(err)
+
+		return helper.ErrorStatus(err), err
+	}
+
+	newRes := helper.ResponseModel{}
+
+	if err := bookService.Decode(res, &newRes); err != nil {
+		return helper.ErrorStatus(err), err
+	}
+
+	if !newRes.Success {
+		return newRes.HTTPStatusCode, errors.New(newRes.Message)
+	}
+
+	return http.StatusOK, nil
+}